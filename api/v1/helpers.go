@@ -18,7 +18,12 @@ package v1
 
 import (
 	"encoding/json"
+	"sort"
+	"strings"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 )
 
@@ -41,10 +46,20 @@ const (
 	FileWait
 	Owner
 	ScheduleRun
+	Trigger
+	Check
+	Target
+	Quota
 )
 
 func (d SubResource) String() string {
-	return [...]string{"PVC", "EnvMap", "KmakeMap", "Main", "Kmake", "Job", "Runs", "Schedule", "SchEnvMap", "Dummy", "FileWait", "Owner", "Kmsr"}[d]
+	return [...]string{"PVC", "EnvMap", "KmakeMap", "Main", "Kmake", "Job", "Runs", "Schedule", "SchEnvMap", "Dummy", "FileWait", "Owner", "Kmsr", "Trigger", "Check", "Target", "Quota"}[d]
+}
+
+// ChildKind is the kind of the child object the subresource's name is, empty
+// when the name isn't one
+func (d SubResource) ChildKind() string {
+	return [...]string{"PersistentVolumeClaim", "ConfigMap", "ConfigMap", "", "", "Job", "", "", "ConfigMap", "", "", "ConfigMap", "", "", "Job", "", ""}[d]
 }
 
 type Phase int
@@ -69,6 +84,44 @@ func (d Phase) String() string {
 	return [...]string{"Provision", "Delete", "BackOff", "Update", "Error", "Active", "Success", "Abort", "Wait", "Stop", "Restart", "Ready", "Get"}[d]
 }
 
+// Reason is the reason of the phase's events
+func (d Phase) Reason() Reason {
+	return [...]Reason{ProvisionedReason, DeletedReason, BackOffReason, UpdatedReason, FailedReason, ActiveReason, SucceededReason, AbortedReason, WaitingReason, StoppedReason, RestartedReason, ReadyReason, GetFailedReason}[d]
+}
+
+// EventType is Warning for the phases that went wrong, Normal for the rest
+func (d Phase) EventType() string {
+	switch d {
+	case Error, Abort, Get:
+		return corev1.EventTypeWarning
+	}
+	return corev1.EventTypeNormal
+}
+
+// Reason is what an event is about, the subresource and name are in its
+// message and annotations so the similar events aggregate
+type Reason int
+
+const (
+	ProvisionedReason Reason = iota
+	DeletedReason
+	BackOffReason
+	UpdatedReason
+	FailedReason
+	ActiveReason
+	SucceededReason
+	AbortedReason
+	WaitingReason
+	StoppedReason
+	RestartedReason
+	ReadyReason
+	GetFailedReason
+)
+
+func (d Reason) String() string {
+	return [...]string{"Provisioned", "Deleted", "BackOff", "Updated", "Failed", "Active", "Succeeded", "Aborted", "Waiting", "Stopped", "Restarted", "Ready", "GetFailed"}[d]
+}
+
 type Label int
 
 const (
@@ -80,12 +133,43 @@ const (
 	ScheduleEnvLabel
 	WorkloadLabel
 	ScheduleRunLabel
+	KmakeNamespaceLabel
+	ScheduleRunNamespaceLabel
+	AllowedNamespacesLabel
+	TriggerHashLabel
+	TargetLabel
+	SubResourceLabel
+	ChildKindLabel
+	ChildNamespaceLabel
+	ChildNameLabel
 )
 
 func (d Label) String() string {
-	return [...]string{"kmake", "status", "run", "scheduler", "schedule-instance", "schedule-env", "workload", "schedulerun"}[d]
+	return [...]string{"kmake", "status", "run", "scheduler", "schedule-instance", "schedule-env", "workload", "schedulerun", "kmake-namespace", "schedulerun-namespace", "allowed-namespaces", "trigger-hash", "target", "subresource", "child-kind", "child-namespace", "child-name"}[d]
 }
 
+// KmakeObject is what the kinds with a KmakeStatus have in common, so their
+// controllers can share how they handle them
+// +kubebuilder:object:generate=false
+type KmakeObject interface {
+	metav1.Object
+	runtime.Object
+	IsBeingDeleted() bool
+	HasFinalizer(finalizerName string) bool
+	AddFinalizer(finalizerName string)
+	RemoveFinalizer(finalizerName string)
+	GetStatus() string
+	GetKmakeStatus() *KmakeStatus
+}
+
+var (
+	_ KmakeObject = &Kmake{}
+	_ KmakeObject = &KmakeRun{}
+	_ KmakeObject = &KmakeScheduleRun{}
+	_ KmakeObject = &KmakeNowScheduler{}
+	_ KmakeObject = &KmakeTriggerScheduler{}
+)
+
 func containsString(slice []string, s string) bool {
 	for _, item := range slice {
 		if item == s {
@@ -105,10 +189,24 @@ func removeString(slice []string, s string) (result []string) {
 	return
 }
 
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func MakeDomainString(entry Label) string {
 	return kmakeDomain + entry.String()
 }
 
+// IsDomainLabel is whether the label key is one of ours
+func IsDomainLabel(key string) bool {
+	return strings.HasPrefix(key, kmakeDomain)
+}
+
 func SetDomainLabel(labels map[string]string, label Label, value string) map[string]string {
 	if labels == nil {
 		labels = make(map[string]string)
@@ -153,12 +251,49 @@ func GetDomainAnnotation(annotations map[string]string) string {
 	return ""
 }
 
+// TraceCarrier keeps the trace context in an object's domain annotations, it's
+// an OpenTelemetry propagation.TextMapCarrier
+// +kubebuilder:object:generate=false
+type TraceCarrier struct {
+	Object metav1.Object
+}
+
+func (c TraceCarrier) Get(key string) string {
+	return c.Object.GetAnnotations()[kmakeDomain+key]
+}
+
+func (c TraceCarrier) Set(key string, value string) {
+	annotations := c.Object.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[kmakeDomain+key] = value
+	c.Object.SetAnnotations(annotations)
+}
+
+func (c TraceCarrier) Keys() []string {
+	keys := make([]string, 0)
+	for _, k := range sortedKeys(c.Object.GetAnnotations()) {
+		if strings.HasPrefix(k, kmakeDomain) {
+			keys = append(keys, strings.TrimPrefix(k, kmakeDomain))
+		}
+	}
+	return keys
+}
+
 // KmakeStatus defines the observed state of Kmake things
 type KmakeStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	Status    string            `json:"status,omitempty"`
 	Resources map[string]string `json:"resources,omitempty"`
+	Warnings  []string          `json:"warnings,omitempty"`
+	// StartTime is when a schedule run made its first job
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	// CompletionTime is when a schedule run ended
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// Targets is the phase of each target of a fanned out job
+	Targets map[string]string `json:"targets,omitempty"`
 }
 
 func (status *KmakeStatus) UpdateSubResource(subresource SubResource, name string) {
@@ -136,6 +136,26 @@ var _ = Describe("helpers", func() {
 			Expect(Ready.String()).To(Equal("Ready"))
 		})
 
+		It("should give events a reason, type and child", func() {
+			By("checking the reasons are stable")
+			Expect(Provision.Reason().String()).To(Equal("Provisioned"))
+			Expect(Error.Reason().String()).To(Equal("Failed"))
+			Expect(Get.Reason().String()).To(Equal("GetFailed"))
+			Expect(Wait.Reason().String()).To(Equal("Waiting"))
+
+			By("checking failures are warnings")
+			Expect(Error.EventType()).To(Equal("Warning"))
+			Expect(Abort.EventType()).To(Equal("Warning"))
+			Expect(Get.EventType()).To(Equal("Warning"))
+			Expect(Success.EventType()).To(Equal("Normal"))
+
+			By("checking the child kinds")
+			Expect(Job.ChildKind()).To(Equal("Job"))
+			Expect(PVC.ChildKind()).To(Equal("PersistentVolumeClaim"))
+			Expect(EnvMap.ChildKind()).To(Equal("ConfigMap"))
+			Expect(Main.ChildKind()).To(Equal(""))
+		})
+
 	})
 
 })
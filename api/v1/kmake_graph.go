@@ -0,0 +1,429 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// KmakeGraphNode is a single target in the build graph
+// +kubebuilder:object:generate=false
+type KmakeGraphNode struct {
+	Target  string
+	Prereqs []string
+	// Rule is false for prereqs that no rule builds (ie files)
+	Rule    bool
+	Pattern bool
+	// Outcome is the status of the last schedule run that built this target
+	Outcome string
+}
+
+// KmakeGraph is the target dependency graph of a Kmake
+// +kubebuilder:object:generate=false
+type KmakeGraph struct {
+	Nodes map[string]*KmakeGraphNode
+	// Goal is the default goal, the first non special non pattern target
+	Goal  string
+	order []string
+}
+
+// ToGraph turns the rules into a target dependency graph
+func (kmake *KmakeSpec) ToGraph() *KmakeGraph {
+	g := &KmakeGraph{
+		Nodes: map[string]*KmakeGraphNode{},
+	}
+
+	patterns := make([]KmakeRule, 0)
+
+	for _, rule := range kmake.Rules {
+		for _, target := range rule.Targets {
+			prereqs := rule.Prereqs
+
+			if rule.TargetPattern != "" {
+				// static pattern rule - the prereqs are patterns
+				stem, ok := MatchPattern(rule.TargetPattern, target)
+				if !ok {
+					continue
+				}
+				prereqs = make([]string, 0)
+				for _, p := range rule.Prereqs {
+					prereqs = append(prereqs, strings.Replace(p, "%", stem, 1))
+				}
+			}
+			node := g.addNode(target)
+			node.Rule = true
+			node.Pattern = strings.Contains(target, "%")
+
+			for _, p := range prereqs {
+				node.addPrereq(p)
+			}
+			if node.Pattern {
+				patterns = append(patterns, rule)
+			} else if g.Goal == "" && !IsSpecialTarget(target) {
+				g.Goal = target
+			}
+		}
+	}
+
+	// now every prereq becomes a node, those with no rule use any pattern rule
+	for i := 0; i < len(g.order); i++ {
+		for _, p := range g.Nodes[g.order[i]].Prereqs {
+			if _, ok := g.Nodes[p]; ok {
+				continue
+			}
+			node := g.addNode(p)
+			for _, rule := range patterns {
+				for _, target := range rule.Targets {
+					if stem, ok := MatchPattern(target, p); ok {
+						node.Rule = true
+						for _, pp := range rule.Prereqs {
+							node.addPrereq(strings.Replace(pp, "%", stem, 1))
+						}
+					}
+				}
+			}
+		}
+	}
+	return g
+}
+
+func (g *KmakeGraph) addNode(target string) *KmakeGraphNode {
+	if node, ok := g.Nodes[target]; ok {
+		return node
+	}
+	node := &KmakeGraphNode{
+		Target:  target,
+		Prereqs: make([]string, 0),
+	}
+	g.Nodes[target] = node
+	g.order = append(g.order, target)
+	return node
+}
+
+func (node *KmakeGraphNode) addPrereq(prereq string) {
+	if !containsString(node.Prereqs, prereq) {
+		node.Prereqs = append(node.Prereqs, prereq)
+	}
+}
+
+// Targets returns the node names in the order they were defined
+func (g *KmakeGraph) Targets() []string {
+	return append([]string{}, g.order...)
+}
+
+// Cycles returns every dependency cycle as the list of targets making it up
+func (g *KmakeGraph) Cycles() [][]string {
+	const (
+		white = iota
+		grey
+		black
+	)
+	colour := map[string]int{}
+	stack := make([]string, 0)
+	cycles := make([][]string, 0)
+
+	var visit func(string)
+	visit = func(name string) {
+		colour[name] = grey
+		stack = append(stack, name)
+
+		for _, p := range g.Nodes[name].Prereqs {
+			switch colour[p] {
+			case white:
+				visit(p)
+			case grey:
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == p {
+						cycle := append([]string{}, stack[i:]...)
+						cycles = append(cycles, append(cycle, p))
+						break
+					}
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		colour[name] = black
+	}
+
+	for _, name := range g.order {
+		if colour[name] == white {
+			visit(name)
+		}
+	}
+	return cycles
+}
+
+// Reachable returns every target that building the roots would consider.
+// With no roots the default goal is used
+func (g *KmakeGraph) Reachable(roots ...string) map[string]bool {
+	if len(roots) == 0 && g.Goal != "" {
+		roots = []string{g.Goal}
+	}
+	seen := map[string]bool{}
+
+	var visit func(string)
+	visit = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		if node, ok := g.Nodes[name]; ok {
+			for _, p := range node.Prereqs {
+				visit(p)
+			}
+		}
+	}
+	for _, root := range roots {
+		visit(root)
+	}
+	return seen
+}
+
+// Unreachable returns the rule targets not reachable from the roots.
+// Special and pattern targets are never reported
+func (g *KmakeGraph) Unreachable(roots ...string) []string {
+	seen := g.Reachable(roots...)
+	ret := make([]string, 0)
+
+	for _, name := range g.order {
+		node := g.Nodes[name]
+		if !node.Rule || node.Pattern || IsSpecialTarget(name) || seen[name] {
+			continue
+		}
+		ret = append(ret, name)
+	}
+	return ret
+}
+
+// KmakeFanOut maps each target of a fanned out job to the targets it waits for
+// +kubebuilder:object:generate=false
+type KmakeFanOut map[string][]string
+
+// FanOut returns the rule targets building the roots needs, each with the
+// rule targets it must wait for. With no roots the default goal is used.
+// Special and pattern targets are left to make
+func (g *KmakeGraph) FanOut(roots ...string) (KmakeFanOut, error) {
+	seen := g.Reachable(roots...)
+
+	for _, cycle := range g.Cycles() {
+		if seen[cycle[0]] {
+			return nil, fmt.Errorf("dependency cycle %v", strings.Join(cycle, " -> "))
+		}
+	}
+
+	fanout := KmakeFanOut{}
+	for name := range seen {
+		if !g.isFanOutTarget(name) {
+			continue
+		}
+		prereqs := make([]string, 0)
+		for _, p := range g.Nodes[name].Prereqs {
+			if g.isFanOutTarget(p) {
+				prereqs = append(prereqs, p)
+			}
+		}
+		fanout[name] = prereqs
+	}
+	return fanout, nil
+}
+
+func (g *KmakeGraph) isFanOutTarget(name string) bool {
+	node, ok := g.Nodes[name]
+	return ok && node.Rule && !node.Pattern && !IsSpecialTarget(name)
+}
+
+// Targets returns the targets in name order
+func (fanout KmakeFanOut) Targets() []string {
+	ret := make([]string, 0, len(fanout))
+	for target := range fanout {
+		ret = append(ret, target)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Ready returns the targets waiting to start whose prereqs have all succeeded,
+// given the phase of each target
+func (fanout KmakeFanOut) Ready(phases map[string]string) []string {
+	ret := make([]string, 0)
+	for _, target := range fanout.Targets() {
+		if phases[target] != Wait.String() {
+			continue
+		}
+		ready := true
+		for _, p := range fanout[target] {
+			if phases[p] != Success.String() {
+				ready = false
+				break
+			}
+		}
+		if ready {
+			ret = append(ret, target)
+		}
+	}
+	return ret
+}
+
+// Overlay sets the outcome of the last finished schedule run on each of
+// the targets of its KmakeRun
+func (g *KmakeGraph) Overlay(runs []KmakeRun, kmsrs []KmakeScheduleRun) {
+	targets := map[string][]string{}
+	for _, run := range runs {
+		if run.Spec.KmakeRunOperation.Job != nil {
+			targets[run.GetName()] = run.Spec.KmakeRunOperation.Job.Targets
+		}
+	}
+
+	ended := make([]KmakeScheduleRun, 0)
+	for _, kmsr := range kmsrs {
+		if kmsr.HasEnded() {
+			ended = append(ended, kmsr)
+		}
+	}
+	sort.SliceStable(ended, func(i, j int) bool {
+		return ended[i].CreationTimestamp.Before(&ended[j].CreationTimestamp)
+	})
+
+	for _, kmsr := range ended {
+		run := kmsr.GetKmakeRunName()
+		t, ok := targets[run]
+		if !ok {
+			continue
+		}
+		if len(t) == 0 && g.Goal != "" {
+			t = []string{g.Goal}
+		}
+		for _, target := range t {
+			if node, ok := g.Nodes[target]; ok {
+				node.Outcome = GetDomainLabel(kmsr.Labels, StatusLabel)
+			}
+		}
+	}
+}
+
+// ToDot renders the graph in graphviz dot format
+func (g *KmakeGraph) ToDot() string {
+	var b strings.Builder
+
+	fmt.Fprint(&b, "digraph kmake {\n")
+	for _, name := range g.order {
+		node := g.Nodes[name]
+		attrs := make([]string, 0)
+		styles := make([]string, 0)
+
+		if !node.Rule {
+			attrs = append(attrs, "shape=note")
+		} else if node.Pattern {
+			styles = append(styles, "dashed")
+		}
+		colour := outcomeColour(node.Outcome)
+		if colour != "" {
+			styles = append(styles, "filled")
+		}
+		// dot takes the last of a repeated attribute, so the styles go in one
+		if len(styles) > 0 {
+			attrs = append(attrs, fmt.Sprintf("style=%q", strings.Join(styles, ",")))
+		}
+		if colour != "" {
+			attrs = append(attrs, fmt.Sprintf("fillcolor=%s", colour))
+			attrs = append(attrs, fmt.Sprintf("tooltip=%q", node.Outcome))
+		}
+		if len(attrs) > 0 {
+			fmt.Fprintf(&b, "\t%q [%s];\n", name, strings.Join(attrs, ","))
+		} else {
+			fmt.Fprintf(&b, "\t%q;\n", name)
+		}
+	}
+	for _, name := range g.order {
+		for _, p := range g.Nodes[name].Prereqs {
+			fmt.Fprintf(&b, "\t%q -> %q;\n", name, p)
+		}
+	}
+	fmt.Fprint(&b, "}\n")
+	return b.String()
+}
+
+// ToMermaid renders the graph as a mermaid flowchart
+func (g *KmakeGraph) ToMermaid() string {
+	var b strings.Builder
+
+	ids := map[string]string{}
+	for i, name := range g.order {
+		ids[name] = fmt.Sprintf("n%d", i)
+	}
+
+	fmt.Fprint(&b, "graph TD\n")
+	for _, name := range g.order {
+		node := g.Nodes[name]
+		label := strings.Replace(name, `"`, "#quot;", -1)
+
+		if !node.Rule {
+			fmt.Fprintf(&b, "\t%s[/\"%s\"/]\n", ids[name], label)
+		} else {
+			fmt.Fprintf(&b, "\t%s[\"%s\"]\n", ids[name], label)
+		}
+	}
+	for _, name := range g.order {
+		for _, p := range g.Nodes[name].Prereqs {
+			fmt.Fprintf(&b, "\t%s --> %s\n", ids[name], ids[p])
+		}
+	}
+	for _, name := range g.order {
+		if colour := outcomeColour(g.Nodes[name].Outcome); colour != "" {
+			fmt.Fprintf(&b, "\tstyle %s fill:%s\n", ids[name], colour)
+		}
+	}
+	return b.String()
+}
+
+func outcomeColour(outcome string) string {
+	switch {
+	case outcome == "":
+		return ""
+	case strings.Contains(outcome, Success.String()):
+		return "palegreen"
+	case strings.Contains(outcome, Error.String()):
+		return "salmon"
+	case strings.Contains(outcome, Abort.String()):
+		return "orange"
+	}
+	return "lightgrey"
+}
+
+// IsSpecialTarget is true for make's built in targets like .PHONY
+func IsSpecialTarget(target string) bool {
+	return strings.HasPrefix(target, ".")
+}
+
+// MatchPattern matches a make pattern containing a single % against a name
+// returning the stem
+func MatchPattern(pattern, name string) (string, bool) {
+	i := strings.Index(pattern, "%")
+	if i < 0 {
+		return "", pattern == name
+	}
+	prefix := pattern[:i]
+	suffix := pattern[i+1:]
+
+	if len(name) < len(prefix)+len(suffix) ||
+		!strings.HasPrefix(name, prefix) ||
+		!strings.HasSuffix(name, suffix) {
+		return "", false
+	}
+	return name[len(prefix) : len(name)-len(suffix)], true
+}
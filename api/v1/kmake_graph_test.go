@@ -0,0 +1,260 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// go test ./api/v1 -update rewrites the golden files in testdata
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// expectGolden compares what was rendered with the named file in testdata
+func expectGolden(name string, got string) {
+	path := filepath.Join("testdata", name)
+	if *update {
+		Expect(os.WriteFile(path, []byte(got), 0644)).Should(Succeed())
+	}
+	want, err := os.ReadFile(path)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(got).To(Equal(string(want)))
+}
+
+var _ = Describe("KmakeGraph", func() {
+	spec := &KmakeSpec{
+		Rules: []KmakeRule{
+			KmakeRule{
+				Targets: []string{"all"},
+				Prereqs: []string{"build", "test"},
+			},
+			KmakeRule{
+				Targets: []string{"build"},
+				Prereqs: []string{"main.o"},
+			},
+			KmakeRule{
+				Targets: []string{"%.o"},
+				Prereqs: []string{"%.c"},
+			},
+			KmakeRule{
+				Targets: []string{"test"},
+				Prereqs: []string{"build"},
+			},
+			KmakeRule{
+				Targets: []string{"orphan"},
+			},
+			KmakeRule{
+				Targets: []string{".PHONY"},
+				Prereqs: []string{"all"},
+			},
+		},
+	}
+
+	Context("Build the graph", func() {
+		It("should find the goal and pattern prereqs", func() {
+			g := spec.ToGraph()
+			Expect(g.Goal).To(Equal("all"))
+			Expect(g.Nodes["main.o"].Rule).To(BeTrue())
+			Expect(g.Nodes["main.o"].Prereqs).To(Equal([]string{"main.c"}))
+			Expect(g.Nodes["main.c"].Rule).To(BeFalse())
+		})
+
+		It("should expand static pattern rules", func() {
+			s := &KmakeSpec{
+				Rules: []KmakeRule{
+					KmakeRule{
+						Targets:       []string{"a.o", "b.o"},
+						TargetPattern: "%.o",
+						Prereqs:       []string{"%.c"},
+					},
+				},
+			}
+			g := s.ToGraph()
+			Expect(g.Nodes["b.o"].Prereqs).To(Equal([]string{"b.c"}))
+		})
+
+		It("should find unreachable targets", func() {
+			Expect(spec.ToGraph().Unreachable()).To(Equal([]string{"orphan"}))
+			Expect(spec.ToGraph().Unreachable("orphan")).To(Equal([]string{"all", "build", "test", "main.o"}))
+		})
+
+		It("should find cycles", func() {
+			Expect(spec.ToGraph().Cycles()).To(BeEmpty())
+
+			s := &KmakeSpec{
+				Rules: []KmakeRule{
+					KmakeRule{Targets: []string{"a"}, Prereqs: []string{"b"}},
+					KmakeRule{Targets: []string{"b"}, Prereqs: []string{"c"}},
+					KmakeRule{Targets: []string{"c"}, Prereqs: []string{"a"}},
+				},
+			}
+			Expect(s.ToGraph().Cycles()).To(Equal([][]string{{"a", "b", "c", "a"}}))
+		})
+	})
+
+	Context("Fan out the graph", func() {
+		It("should find the rule targets to build and what they wait for", func() {
+			fanout, err := spec.ToGraph().FanOut()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fanout).To(Equal(KmakeFanOut{
+				"all":    []string{"build", "test"},
+				"build":  []string{"main.o"},
+				"test":   []string{"build"},
+				"main.o": []string{},
+			}))
+
+			fanout, err = spec.ToGraph().FanOut("test")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(fanout.Targets()).To(Equal([]string{"build", "main.o", "test"}))
+		})
+
+		It("should start targets once their prereqs succeed", func() {
+			fanout, _ := spec.ToGraph().FanOut()
+			phases := map[string]string{"all": "Wait", "build": "Wait", "test": "Wait", "main.o": "Wait"}
+			Expect(fanout.Ready(phases)).To(Equal([]string{"main.o"}))
+
+			phases["main.o"] = "Active"
+			Expect(fanout.Ready(phases)).To(BeEmpty())
+
+			phases["main.o"] = "Success"
+			Expect(fanout.Ready(phases)).To(Equal([]string{"build"}))
+
+			phases["build"] = "Error"
+			Expect(fanout.Ready(phases)).To(BeEmpty())
+		})
+
+		It("should refuse cycles", func() {
+			s := &KmakeSpec{
+				Rules: []KmakeRule{
+					KmakeRule{Targets: []string{"a"}, Prereqs: []string{"b"}},
+					KmakeRule{Targets: []string{"b"}, Prereqs: []string{"a"}},
+				},
+			}
+			_, err := s.ToGraph().FanOut()
+			Expect(err).To(MatchError("dependency cycle a -> b -> a"))
+		})
+	})
+
+	Context("Render the graph", func() {
+		It("should overlay the last outcome", func() {
+			g := spec.ToGraph()
+			runs := []KmakeRun{
+				KmakeRun{
+					ObjectMeta: metav1.ObjectMeta{Name: "run1"},
+					Spec: KmakeRunSpec{
+						KmakeRunOperation: KmakeRunOperation{
+							Job: &KmakeRunJob{Targets: []string{"build"}},
+						},
+					},
+				},
+			}
+			now := time.Now()
+			kmsrs := []KmakeScheduleRun{
+				KmakeScheduleRun{
+					ObjectMeta: metav1.ObjectMeta{
+						CreationTimestamp: metav1.NewTime(now),
+						Labels: map[string]string{
+							MakeDomainString(RunLabel):    "run1",
+							MakeDomainString(StatusLabel): "Success",
+						},
+					},
+				},
+				KmakeScheduleRun{
+					ObjectMeta: metav1.ObjectMeta{
+						CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+						Labels: map[string]string{
+							MakeDomainString(RunLabel):    "run1",
+							MakeDomainString(StatusLabel): "Error",
+						},
+					},
+				},
+			}
+			g.Overlay(runs, kmsrs)
+			Expect(g.Nodes["build"].Outcome).To(Equal("Success"))
+			Expect(g.ToDot()).To(ContainSubstring(`"build" [style="filled",fillcolor=palegreen,tooltip="Success"];`))
+			Expect(g.ToDot()).To(ContainSubstring(`"all" -> "build";`))
+			Expect(g.ToMermaid()).To(ContainSubstring("n0 --> n1"))
+			Expect(g.ToMermaid()).To(ContainSubstring("style n1 fill:palegreen"))
+		})
+	})
+
+	Context("Render against the golden files", func() {
+		It("should style, shape and colour each kind of target", func() {
+			g := spec.ToGraph()
+			runs := []KmakeRun{
+				KmakeRun{
+					ObjectMeta: metav1.ObjectMeta{Name: "run1"},
+					Spec: KmakeRunSpec{
+						KmakeRunOperation: KmakeRunOperation{
+							Job: &KmakeRunJob{Targets: []string{"%.o", "test"}},
+						},
+					},
+				},
+				KmakeRun{
+					ObjectMeta: metav1.ObjectMeta{Name: "run2"},
+					Spec: KmakeRunSpec{
+						KmakeRunOperation: KmakeRunOperation{
+							Job: &KmakeRunJob{Targets: []string{"orphan"}},
+						},
+					},
+				},
+			}
+			kmsrs := []KmakeScheduleRun{
+				KmakeScheduleRun{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{
+							MakeDomainString(RunLabel):    "run1",
+							MakeDomainString(StatusLabel): "Success",
+						},
+					},
+				},
+				KmakeScheduleRun{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{
+							MakeDomainString(RunLabel):    "run2",
+							MakeDomainString(StatusLabel): "Error",
+						},
+					},
+				},
+			}
+			g.Overlay(runs, kmsrs)
+
+			expectGolden("kmake_graph.dot", g.ToDot())
+			expectGolden("kmake_graph.mmd", g.ToMermaid())
+		})
+	})
+
+	Context("Match patterns", func() {
+		It("should return the stem", func() {
+			stem, ok := MatchPattern("Rule%", "Rule1")
+			Expect(ok).To(BeTrue())
+			Expect(stem).To(Equal("1"))
+
+			_, ok = MatchPattern("%.o", "main.c")
+			Expect(ok).To(BeFalse())
+
+			_, ok = MatchPattern("main.o", "main.o")
+			Expect(ok).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,245 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type LintSeverity int
+
+const (
+	LintWarning LintSeverity = iota
+	LintError
+)
+
+func (d LintSeverity) String() string {
+	return [...]string{"Warning", "Error"}[d]
+}
+
+type LintCheck int
+
+const (
+	UndefinedPrereq LintCheck = iota
+	MixedColons
+	UnusedVariable
+	UndefinedTarget
+	UnmatchedPattern
+)
+
+func (d LintCheck) String() string {
+	return [...]string{"UndefinedPrereq", "MixedColons", "UnusedVariable", "UndefinedTarget", "UnmatchedPattern"}[d]
+}
+
+// LintFinding is a single problem found in the rules
+// +kubebuilder:object:generate=false
+type LintFinding struct {
+	Severity LintSeverity
+	Check    LintCheck
+	Name     string
+	Message  string
+}
+
+func (f LintFinding) String() string {
+	return fmt.Sprintf("%v %v (%v): %v", f.Severity.String(), f.Check.String(), f.Name, f.Message)
+}
+
+// LintFindings is the result of linting a kmake
+// +kubebuilder:object:generate=false
+type LintFindings []LintFinding
+
+// Strings returns the findings in the form stored in status
+func (findings LintFindings) Strings() []string {
+	ret := make([]string, 0)
+	for _, f := range findings {
+		ret = append(ret, f.String())
+	}
+	return ret
+}
+
+// Severe returns an error made up of every LintError finding, or nil
+func (findings LintFindings) Severe() error {
+	m := make([]string, 0)
+	for _, f := range findings {
+		if f.Severity == LintError {
+			m = append(m, f.String())
+		}
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return fmt.Errorf("kmake rules invalid: %s", strings.Join(m, "; "))
+}
+
+var variableRef = regexp.MustCompile(`\$[({]([^)}]*)|\$([A-Za-z0-9_])`)
+var variableWord = regexp.MustCompile(`[^\s,:=]+`)
+
+// Lint checks the rules for the mistakes make would only find when the job runs
+func (kmake *KmakeSpec) Lint() LintFindings {
+	findings := make(LintFindings, 0)
+	g := kmake.ToGraph()
+
+	phony := make([]string, 0)
+	colons := map[string]bool{}
+
+	for _, rule := range kmake.Rules {
+		for _, target := range rule.Targets {
+			if target == ".PHONY" {
+				phony = append(phony, rule.Prereqs...)
+			}
+			if dc, ok := colons[target]; ok && dc != rule.DoubleColon {
+				findings = append(findings, LintFinding{
+					Severity: LintError,
+					Check:    MixedColons,
+					Name:     target,
+					Message:  "target has both : and :: rules",
+				})
+			}
+			colons[target] = rule.DoubleColon
+
+			if rule.TargetPattern != "" {
+				if _, ok := MatchPattern(rule.TargetPattern, target); !ok {
+					findings = append(findings, LintFinding{
+						Severity: LintError,
+						Check:    UnmatchedPattern,
+						Name:     target,
+						Message:  fmt.Sprintf("target does not match the target pattern %s", rule.TargetPattern),
+					})
+				}
+			}
+		}
+	}
+
+	// prereqs nothing builds that don't look like files
+	for _, name := range g.Targets() {
+		node := g.Nodes[name]
+		if node.Rule || isFileLike(name) {
+			continue
+		}
+		severity := LintWarning
+		if containsString(phony, name) {
+			severity = LintError
+		}
+		findings = append(findings, LintFinding{
+			Severity: severity,
+			Check:    UndefinedPrereq,
+			Name:     name,
+			Message:  "no rule to make prerequisite",
+		})
+	}
+
+	// pattern rules nothing uses
+	for _, name := range g.Targets() {
+		if !g.Nodes[name].Pattern {
+			continue
+		}
+		matched := false
+		for _, other := range g.Targets() {
+			if other == name || strings.Contains(other, "%") {
+				continue
+			}
+			if _, ok := MatchPattern(name, other); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			findings = append(findings, LintFinding{
+				Severity: LintWarning,
+				Check:    UnmatchedPattern,
+				Name:     name,
+				Message:  "pattern rule matches no target or prerequisite",
+			})
+		}
+	}
+
+	// variables nothing references
+	used := map[string]bool{}
+	texts := make([]string, 0)
+	for _, rule := range kmake.Rules {
+		texts = append(texts, rule.Targets...)
+		texts = append(texts, rule.Prereqs...)
+		texts = append(texts, rule.Commands...)
+	}
+	for _, v := range kmake.Variables {
+		texts = append(texts, v)
+	}
+	for _, text := range texts {
+		// be generous, any word in a reference like $(call FN, x) counts
+		for _, m := range variableRef.FindAllStringSubmatch(text, -1) {
+			for _, w := range variableWord.FindAllString(m[1]+m[2], -1) {
+				used[w] = true
+			}
+		}
+	}
+	for _, k := range sortedKeys(kmake.Variables) {
+		if !used[k] {
+			findings = append(findings, LintFinding{
+				Severity: LintWarning,
+				Check:    UnusedVariable,
+				Name:     k,
+				Message:  "variable is never referenced",
+			})
+		}
+	}
+	return findings
+}
+
+// LintTargets checks the targets a KmakeRun asks for are built by the rules
+func (kmake *KmakeSpec) LintTargets(targets []string) LintFindings {
+	findings := make(LintFindings, 0)
+
+	for _, target := range kmake.MissingTargets(targets) {
+		findings = append(findings, LintFinding{
+			Severity: LintError,
+			Check:    UndefinedTarget,
+			Name:     target,
+			Message:  "no rule to make target",
+		})
+	}
+	return findings
+}
+
+// MissingTargets returns the targets no rule, or pattern rule, can build
+func (kmake *KmakeSpec) MissingTargets(targets []string) []string {
+	g := kmake.ToGraph()
+	ret := make([]string, 0)
+
+	for _, target := range targets {
+		if node, ok := g.Nodes[target]; ok && node.Rule {
+			continue
+		}
+		found := false
+		for _, name := range g.Targets() {
+			if g.Nodes[name].Pattern {
+				if _, ok := MatchPattern(name, target); ok {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			ret = append(ret, target)
+		}
+	}
+	return ret
+}
+
+func isFileLike(name string) bool {
+	return strings.ContainsAny(name, "./$%")
+}
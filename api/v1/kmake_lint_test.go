@@ -0,0 +1,139 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("KmakeLint", func() {
+	Context("Lint the rules", func() {
+		It("should pass good rules", func() {
+			spec := &KmakeSpec{
+				Variables: map[string]string{
+					"VAR1": "Value1",
+					"VAR2": "$(VAR1)",
+					"FN":   "echo $(1)",
+				},
+				Rules: []KmakeRule{
+					KmakeRule{
+						Targets:  []string{"all"},
+						Prereqs:  []string{"main.o", "file1"},
+						Commands: []string{"@echo $(VAR2)", "$(call FN, x)"},
+					},
+					KmakeRule{
+						Targets: []string{"%.o"},
+						Prereqs: []string{"%.c"},
+					},
+					KmakeRule{
+						Targets:     []string{"file1"},
+						DoubleColon: true,
+					},
+				},
+			}
+			findings := spec.Lint()
+			Expect(findings).To(BeEmpty())
+			Expect(findings.Severe()).To(BeNil())
+		})
+
+		It("should find problems", func() {
+			spec := &KmakeSpec{
+				Variables: map[string]string{
+					"UNUSED": "x",
+				},
+				Rules: []KmakeRule{
+					KmakeRule{
+						Targets: []string{"all"},
+						Prereqs: []string{"missing", "phony"},
+					},
+					KmakeRule{
+						Targets:     []string{"all"},
+						DoubleColon: true,
+					},
+					KmakeRule{
+						Targets: []string{"%.x"},
+					},
+					KmakeRule{
+						Targets:       []string{"a.y"},
+						TargetPattern: "%.z",
+					},
+					KmakeRule{
+						Targets: []string{".PHONY"},
+						Prereqs: []string{"phony"},
+					},
+				},
+			}
+			findings := spec.Lint()
+			Expect(findings.Strings()).To(Equal([]string{
+				"Error MixedColons (all): target has both : and :: rules",
+				"Error UnmatchedPattern (a.y): target does not match the target pattern %.z",
+				"Warning UndefinedPrereq (missing): no rule to make prerequisite",
+				"Error UndefinedPrereq (phony): no rule to make prerequisite",
+				"Warning UnmatchedPattern (%.x): pattern rule matches no target or prerequisite",
+				"Warning UnusedVariable (UNUSED): variable is never referenced",
+			}))
+			Expect(findings.Severe()).ToNot(BeNil())
+		})
+	})
+
+	Context("Lint the run targets", func() {
+		It("should find missing targets", func() {
+			spec := &KmakeSpec{
+				Rules: []KmakeRule{
+					KmakeRule{
+						Targets: []string{"Rule1"},
+					},
+					KmakeRule{
+						Targets: []string{"build-%"},
+					},
+				},
+			}
+			Expect(spec.MissingTargets([]string{"Rule1", "build-x", "Rule2"})).To(Equal([]string{"Rule2"}))
+			Expect(spec.LintTargets([]string{"Rule2"}).Strings()).To(Equal([]string{
+				"Error UndefinedTarget (Rule2): no rule to make target",
+			}))
+		})
+	})
+
+	Context("Validate in the webhook", func() {
+		It("should reject severe findings", func() {
+			kmake := &Kmake{
+				Spec: KmakeSpec{
+					Rules: []KmakeRule{
+						KmakeRule{Targets: []string{"all"}},
+						KmakeRule{Targets: []string{"all"}, DoubleColon: true},
+					},
+				},
+			}
+			v := &kmakeValidator{}
+			ctx := context.Background()
+
+			_, err := v.ValidateCreate(ctx, kmake)
+			Expect(err).ToNot(BeNil())
+			_, err = v.ValidateUpdate(ctx, kmake.DeepCopy(), kmake)
+			Expect(err).ToNot(BeNil())
+			_, err = v.ValidateDelete(ctx, kmake)
+			Expect(err).To(BeNil())
+
+			kmake.Spec.Rules[1].DoubleColon = false
+			_, err = v.ValidateCreate(ctx, kmake)
+			Expect(err).To(BeNil())
+		})
+	})
+})
@@ -98,6 +98,35 @@ func (kmake *Kmake) GetStatus() string {
 	return kmake.Status.Status
 }
 
+func (kmake *Kmake) GetKmakeStatus() *KmakeStatus {
+	return &kmake.Status
+}
+
+// IsReady is true once the kmake has its PVC and config maps provisioned
+func (kmake *Kmake) IsReady() bool {
+	return strings.HasPrefix(kmake.Status.Status, Ready.String()) &&
+		kmake.Status.GetSubReference(PVC) != ""
+}
+
+// AllowsNamespace is true for the kmake's own namespace and any listed in its
+// allowed-namespaces annotation, comma separated with * for all
+func (kmake *Kmake) AllowsNamespace(namespace string) bool {
+	if namespace == kmake.GetNamespace() {
+		return true
+	}
+	allowed, ok := kmake.Annotations[MakeDomainString(AllowedNamespacesLabel)]
+	if !ok {
+		return false
+	}
+	for _, ns := range strings.Split(allowed, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "*" || ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
 // +kubebuilder:object:root=true
 // KmakeList contains a list of Kmake
 type KmakeList struct {
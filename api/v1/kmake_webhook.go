@@ -0,0 +1,79 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// kmakelog is for logging in this package.
+var kmakelog = logf.Log.WithName("kmake-resource")
+
+func (kmake *Kmake) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(kmake).
+		WithValidator(&kmakeValidator{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:verbs=create;update,path=/validate-bythepowerof-github-com-v1-kmake,mutating=false,failurePolicy=fail,groups=bythepowerof.github.com,resources=kmakes,versions=v1,name=vkmake.bythepowerof.github.com,sideEffects=None,admissionReviewVersions=v1
+
+// kmakeValidator rejects kmakes whose rules have severe lint findings
+// +kubebuilder:object:generate=false
+type kmakeValidator struct{}
+
+var _ admission.CustomValidator = &kmakeValidator{}
+
+func toKmake(obj runtime.Object) (*Kmake, error) {
+	kmake, ok := obj.(*Kmake)
+	if !ok {
+		return nil, fmt.Errorf("expected a Kmake but got a %T", obj)
+	}
+	return kmake, nil
+}
+
+// ValidateCreate rejects rules with severe lint findings
+func (v *kmakeValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	kmake, err := toKmake(obj)
+	if err != nil {
+		return nil, err
+	}
+	kmakelog.Info("validate create", "name", kmake.Name)
+
+	return nil, kmake.Spec.Lint().Severe()
+}
+
+// ValidateUpdate rejects rules with severe lint findings
+func (v *kmakeValidator) ValidateUpdate(ctx context.Context, old runtime.Object, obj runtime.Object) (admission.Warnings, error) {
+	kmake, err := toKmake(obj)
+	if err != nil {
+		return nil, err
+	}
+	kmakelog.Info("validate update", "name", kmake.Name)
+
+	return nil, kmake.Spec.Lint().Severe()
+}
+
+// ValidateDelete allows every delete
+func (v *kmakeValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
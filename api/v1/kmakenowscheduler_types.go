@@ -28,6 +28,37 @@ type KmakeNowSchedulerSpec struct {
 	// Important: Run "make" to regenerate code after modifying this file
 	Variables map[string]string `json:"variables,omitempty"`
 	Monitor   []string          `json:"monitor"`
+
+	// SuccessfulRunsHistoryLimit is how many successful schedule runs to keep
+	SuccessfulRunsHistoryLimit *int32 `json:"successfulRunsHistoryLimit,omitempty"`
+	// FailedRunsHistoryLimit is how many failed or aborted schedule runs to keep
+	FailedRunsHistoryLimit *int32 `json:"failedRunsHistoryLimit,omitempty"`
+	// TTLSecondsAfterFinished is copied to the schedule runs this creates
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+	// ActiveDeadlineSeconds is copied to the schedule runs this creates
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+
+	// Suspend stops new schedule runs being made, the existing ones are kept
+	Suspend bool `json:"suspend,omitempty"`
+	// SuspendPending also holds the schedule runs that haven't started yet
+	// while suspended
+	SuspendPending bool `json:"suspendPending,omitempty"`
+
+	// WebhookSecret names the secret whose WebhookSecretKey signs the push
+	// webhooks that start this scheduler's runs, none are taken without it
+	WebhookSecret string `json:"webhookSecret,omitempty"`
+}
+
+// WebhookSecretKey is the key of a scheduler's webhook secret
+const WebhookSecretKey = "secret"
+
+// KmakeNowSchedulerStatus adds the runs already scheduled to KmakeStatus
+type KmakeNowSchedulerStatus struct {
+	KmakeStatus `json:",inline"`
+
+	// Scheduled is the uids of the runs given a schedule run, remembered
+	// after the schedule runs are deleted
+	Scheduled []string `json:"scheduled,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -38,8 +69,8 @@ type KmakeNowScheduler struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec   KmakeNowSchedulerSpec `json:"spec,omitempty"`
-	Status KmakeStatus           `json:"status,omitempty"`
+	Spec   KmakeNowSchedulerSpec   `json:"spec,omitempty"`
+	Status KmakeNowSchedulerStatus `json:"status,omitempty"`
 }
 
 func (kmns *KmakeNowScheduler) IsBeingDeleted() bool {
@@ -77,6 +108,19 @@ func (kmakenowscheduler *KmakeNowScheduler) GetStatus() string {
 	return kmakenowscheduler.Status.Status
 }
 
+func (kmakenowscheduler *KmakeNowScheduler) GetKmakeStatus() *KmakeStatus {
+	return &kmakenowscheduler.Status.KmakeStatus
+}
+
+func (kmakenowscheduler *KmakeNowScheduler) IsSuspended() bool {
+	return kmakenowscheduler.Spec.Suspend
+}
+
+// HoldsPending is true if the schedule runs that haven't started should wait
+func (kmakenowscheduler *KmakeNowScheduler) HoldsPending() bool {
+	return kmakenowscheduler.Spec.Suspend && kmakenowscheduler.Spec.SuspendPending
+}
+
 // +kubebuilder:object:root=true
 
 // KmakeNowSchedulerList contains a list of KmakeNowScheduler
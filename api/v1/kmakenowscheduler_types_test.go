@@ -108,6 +108,22 @@ var _ = Describe("Kmake", func() {
 			Expect(len(kmakenowscheduler.GetFinalizers())).To(Equal(0))
 			Expect(kmakenowscheduler.HasFinalizer(KmakeFinalizerName)).To(BeFalse())
 		})
+
+		It("should only hold pending runs while suspended", func() {
+			kmakenowscheduler := &KmakeNowScheduler{}
+			Expect(kmakenowscheduler.IsSuspended()).To(BeFalse())
+			Expect(kmakenowscheduler.HoldsPending()).To(BeFalse())
+
+			kmakenowscheduler.Spec.SuspendPending = true
+			Expect(kmakenowscheduler.HoldsPending()).To(BeFalse())
+
+			kmakenowscheduler.Spec.Suspend = true
+			Expect(kmakenowscheduler.IsSuspended()).To(BeTrue())
+			Expect(kmakenowscheduler.HoldsPending()).To(BeTrue())
+
+			kmakenowscheduler.Spec.SuspendPending = false
+			Expect(kmakenowscheduler.HoldsPending()).To(BeFalse())
+		})
 	})
 
 })
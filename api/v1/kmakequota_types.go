@@ -0,0 +1,151 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KmakeQuotaSpec limits the jobs of the kmakes in its namespace. Schedule runs
+// over the limits wait until there is room
+type KmakeQuotaSpec struct {
+	// Kmake limits just the named kmake rather than every kmake in the namespace
+	Kmake string `json:"kmake,omitempty"`
+	// MaxActiveJobs is how many jobs may be going at once
+	MaxActiveJobs *int32 `json:"maxActiveJobs,omitempty"`
+	// MaxRequests bounds the resources, such as cpu and memory, requested by
+	// the jobs going at once
+	MaxRequests corev1.ResourceList `json:"maxRequests,omitempty"`
+	// MaxDailyRuns is how many schedule runs may start in 24 hours
+	MaxDailyRuns *int32 `json:"maxDailyRuns,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +k8s:openapi-gen=true
+// KmakeQuota is the Schema for the kmakequotas API
+type KmakeQuota struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec KmakeQuotaSpec `json:"spec,omitempty"`
+}
+
+// Applies is true if the quota limits the kmake
+func (quota *KmakeQuota) Applies(kmake string) bool {
+	return quota.Spec.Kmake == "" || quota.Spec.Kmake == kmake
+}
+
+// Exceeded says why starting a job with the requests would break the quota,
+// given the jobs already there and the schedule runs it limits. It is empty
+// when there is room. The jobs are all those of the schedule runs, the check
+// and fanned out target jobs too
+func (quota *KmakeQuota) Exceeded(jobs []batchv1.Job, kmsrs []KmakeScheduleRun, requests corev1.ResourceList, now time.Time) string {
+	active := make([]batchv1.Job, 0)
+	for i := range jobs {
+		if !IsJobFinished(&jobs[i]) {
+			active = append(active, jobs[i])
+		}
+	}
+
+	if quota.Spec.MaxActiveJobs != nil && int32(len(active)) >= *quota.Spec.MaxActiveJobs {
+		return fmt.Sprintf("%d active jobs", len(active))
+	}
+
+	if len(quota.Spec.MaxRequests) > 0 {
+		used := corev1.ResourceList{}
+		for _, job := range active {
+			addResources(used, JobRequests(&job.Spec.Template))
+		}
+		addResources(used, requests)
+
+		names := make([]string, 0)
+		for name := range quota.Spec.MaxRequests {
+			names = append(names, string(name))
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			max := quota.Spec.MaxRequests[corev1.ResourceName(name)]
+			want := used[corev1.ResourceName(name)]
+			if want.Cmp(max) > 0 {
+				return fmt.Sprintf("%v requests %v over %v", name, want.String(), max.String())
+			}
+		}
+	}
+
+	if quota.Spec.MaxDailyRuns != nil {
+		runs := int32(0)
+		for _, kmsr := range kmsrs {
+			if kmsr.HasStarted() && now.Sub(kmsr.StartedAt().Time) < 24*time.Hour {
+				runs++
+			}
+		}
+		if runs >= *quota.Spec.MaxDailyRuns {
+			return fmt.Sprintf("%d runs today", runs)
+		}
+	}
+	return ""
+}
+
+// IsJobFinished is true once the job has succeeded or given up, not while it
+// retries a failed pod
+func IsJobFinished(job *batchv1.Job) bool {
+	for _, c := range job.Status.Conditions {
+		if (c.Type == batchv1.JobComplete || c.Type == batchv1.JobFailed) && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// JobRequests adds up the resources the pod's containers request
+func JobRequests(template *corev1.PodTemplateSpec) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for _, c := range template.Spec.Containers {
+		addResources(requests, c.Resources.Requests)
+	}
+	return requests
+}
+
+func addResources(total corev1.ResourceList, add corev1.ResourceList) {
+	for name, quantity := range add {
+		sum, ok := total[name]
+		if !ok {
+			sum = resource.Quantity{}
+		}
+		sum.Add(quantity)
+		total[name] = sum
+	}
+}
+
+// +kubebuilder:object:root=true
+// KmakeQuotaList contains a list of KmakeQuota
+type KmakeQuotaList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KmakeQuota `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KmakeQuota{}, &KmakeQuotaList{})
+}
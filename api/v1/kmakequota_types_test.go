@@ -0,0 +1,132 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("KmakeQuota", func() {
+	now := time.Now()
+
+	job := func(cpu string, done bool) batchv1.Job {
+		j := batchv1.Job{
+			Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{
+							corev1.Container{
+								Resources: corev1.ResourceRequirements{
+									Requests: corev1.ResourceList{"cpu": resource.MustParse(cpu)},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+		if done {
+			j.Status.Succeeded = 1
+			j.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+		}
+		return j
+	}
+
+	kmsr := func(age time.Duration, started bool) KmakeScheduleRun {
+		k := KmakeScheduleRun{
+			ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(now.Add(-age))},
+		}
+		if started {
+			k.Status.Resources = map[string]string{"Job": "job"}
+		}
+		return k
+	}
+
+	Context("Applies", func() {
+		It("should cover the named kmake or all of them", func() {
+			Expect((&KmakeQuota{}).Applies("kmake")).To(BeTrue())
+			Expect((&KmakeQuota{Spec: KmakeQuotaSpec{Kmake: "kmake"}}).Applies("kmake")).To(BeTrue())
+			Expect((&KmakeQuota{Spec: KmakeQuotaSpec{Kmake: "other"}}).Applies("kmake")).To(BeFalse())
+		})
+	})
+
+	Context("Exceeded", func() {
+		It("should count only the jobs still going", func() {
+			two := int32(2)
+			q := &KmakeQuota{Spec: KmakeQuotaSpec{MaxActiveJobs: &two}}
+
+			Expect(q.Exceeded([]batchv1.Job{job("1", false), job("1", true)}, nil, nil, now)).To(BeEmpty())
+			Expect(q.Exceeded([]batchv1.Job{job("1", false), job("1", false)}, nil, nil, now)).To(Equal("2 active jobs"))
+		})
+
+		It("should count a job retrying a failed pod", func() {
+			one := int32(1)
+			q := &KmakeQuota{Spec: KmakeQuotaSpec{MaxActiveJobs: &one}}
+
+			retrying := job("1", false)
+			retrying.Status.Failed = 1
+			Expect(q.Exceeded([]batchv1.Job{retrying}, nil, nil, now)).To(Equal("1 active jobs"))
+
+			retrying.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue}}
+			Expect(q.Exceeded([]batchv1.Job{retrying}, nil, nil, now)).To(BeEmpty())
+		})
+
+		It("should add the new job's requests to the ones going", func() {
+			q := &KmakeQuota{Spec: KmakeQuotaSpec{MaxRequests: corev1.ResourceList{"cpu": resource.MustParse("2")}}}
+			jobs := []batchv1.Job{job("500m", false), job("4", true)}
+
+			Expect(q.Exceeded(jobs, nil, corev1.ResourceList{"cpu": resource.MustParse("1500m")}, now)).To(BeEmpty())
+			Expect(q.Exceeded(jobs, nil, corev1.ResourceList{"cpu": resource.MustParse("2")}, now)).To(Equal("cpu requests 2500m over 2"))
+		})
+
+		It("should count the runs started in the last day", func() {
+			one := int32(1)
+			q := &KmakeQuota{Spec: KmakeQuotaSpec{MaxDailyRuns: &one}}
+
+			Expect(q.Exceeded(nil, []KmakeScheduleRun{kmsr(25*time.Hour, true), kmsr(time.Hour, false)}, nil, now)).To(BeEmpty())
+			Expect(q.Exceeded(nil, []KmakeScheduleRun{kmsr(time.Hour, true)}, nil, now)).To(Equal("1 runs today"))
+		})
+
+		It("should count the runs by when they started", func() {
+			one := int32(1)
+			q := &KmakeQuota{Spec: KmakeQuotaSpec{MaxDailyRuns: &one}}
+
+			// made yesterday but only started today
+			late := kmsr(25*time.Hour, true)
+			started := metav1.NewTime(now.Add(-time.Hour))
+			late.Status.StartTime = &started
+			Expect(q.Exceeded(nil, []KmakeScheduleRun{late}, nil, now)).To(Equal("1 runs today"))
+		})
+	})
+
+	Context("JobRequests", func() {
+		It("should add up the containers", func() {
+			t := job("250m", false).Spec.Template
+			t.Spec.Containers = append(t.Spec.Containers, t.Spec.Containers[0])
+			requests := JobRequests(&t)
+			cpu := requests["cpu"]
+			Expect(cpu.String()).To(Equal("500m"))
+		})
+	})
+})
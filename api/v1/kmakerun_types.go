@@ -28,6 +28,17 @@ type KmakeRunSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	KmakeRunOperation `json:"operation"`
+	// KmakeRef names a kmake, possibly in another namespace, instead of the kmake label
+	KmakeRef *KmakeReference `json:"kmakeRef,omitempty"`
+	// ActiveDeadlineSeconds bounds how long a job for this run may take
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+}
+
+// KmakeReference points at a kmake. A kmake in another namespace must grant
+// the run's namespace with its allowed-namespaces annotation
+type KmakeReference struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
 }
 
 type KmakeRunOperation struct {
@@ -41,8 +52,18 @@ type KmakeRunJob struct {
 	// Important: Run "make" to regenerate code after modifying this file
 	Targets  []string               `json:"targets,omitempty"`
 	Template corev1.PodTemplateSpec `json:"template"`
+	// UpToDateCheck runs make -q for the targets first and skips the job
+	// when they are up to date. The template's first container must run make
+	UpToDateCheck bool `json:"upToDateCheck,omitempty"`
+	// FanOut runs each target the targets need as its own job, in
+	// prerequisite order. The jobs share the kmake PVC so it must be
+	// ReadWriteMany
+	FanOut bool `json:"fanOut,omitempty"`
 }
 
+// UpToDate is the reason a schedule run skipped its job
+const UpToDate = "UpToDate"
+
 func (k *KmakeRunJob) Dummy() string {
 	return "KmakeRunJob"
 }
@@ -83,9 +104,25 @@ func (kmakerun *KmakeRun) IsBeingDeleted() bool {
 }
 
 func (kmakerun *KmakeRun) GetKmakeName() string {
+	if kmakerun.Spec.KmakeRef != nil && kmakerun.Spec.KmakeRef.Name != "" {
+		return kmakerun.Spec.KmakeRef.Name
+	}
 	return GetDomainLabel(kmakerun.Labels, KmakeLabel)
 }
 
+func (kmakerun *KmakeRun) GetKmakeNamespace() string {
+	if kmakerun.Spec.KmakeRef != nil && kmakerun.Spec.KmakeRef.Namespace != "" {
+		return kmakerun.Spec.KmakeRef.Namespace
+	}
+	return kmakerun.GetNamespace()
+}
+
+// IsCrossNamespace is true when the kmake lives in another namespace, so it
+// can't own the run or anything made for it
+func (kmakerun *KmakeRun) IsCrossNamespace() bool {
+	return kmakerun.GetKmakeNamespace() != kmakerun.GetNamespace()
+}
+
 const KmakeRunFinalizerName = "kmakerun.finalizers.bythepowerof.github.com"
 
 func (kmakerun *KmakeRun) HasFinalizer(finalizerName string) bool {
@@ -104,6 +141,10 @@ func (kmakerun *KmakeRun) GetStatus() string {
 	return kmakerun.Status.Status
 }
 
+func (kmakerun *KmakeRun) GetKmakeStatus() *KmakeStatus {
+	return &kmakerun.Status
+}
+
 // +kubebuilder:object:root=true
 // KmakeRunList contains a list of KmakeRun
 type KmakeRunList struct {
@@ -127,4 +127,42 @@ var _ = Describe("Kmake", func() {
 		})
 	})
 
+	Context("Kmake references", func() {
+		It("should resolve the kmake from the label or the reference", func() {
+			run := &KmakeRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "app",
+					Labels:    map[string]string{"bythepowerof.github.io/kmake": "kmake-name"},
+				},
+			}
+			Expect(run.GetKmakeName()).To(Equal("kmake-name"))
+			Expect(run.GetKmakeNamespace()).To(Equal("app"))
+			Expect(run.IsCrossNamespace()).To(BeFalse())
+
+			run.Spec.KmakeRef = &KmakeReference{Name: "shared-kmake", Namespace: "platform"}
+			Expect(run.GetKmakeName()).To(Equal("shared-kmake"))
+			Expect(run.GetKmakeNamespace()).To(Equal("platform"))
+			Expect(run.IsCrossNamespace()).To(BeTrue())
+		})
+
+		It("should only allow granted namespaces", func() {
+			kmake := &Kmake{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "shared-kmake",
+					Namespace: "platform",
+				},
+			}
+			Expect(kmake.AllowsNamespace("platform")).To(BeTrue())
+			Expect(kmake.AllowsNamespace("app")).To(BeFalse())
+
+			kmake.Annotations = map[string]string{"bythepowerof.github.io/allowed-namespaces": "other, app"}
+			Expect(kmake.AllowsNamespace("app")).To(BeTrue())
+			Expect(kmake.AllowsNamespace("third")).To(BeFalse())
+
+			kmake.Annotations["bythepowerof.github.io/allowed-namespaces"] = "*"
+			Expect(kmake.AllowsNamespace("third")).To(BeTrue())
+		})
+	})
+
 })
@@ -0,0 +1,75 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+func (kmsr *KmakeScheduleRun) IsSuccessful() bool {
+	return strings.Contains(GetDomainLabel(kmsr.Labels, StatusLabel), "Success")
+}
+
+// Expiry is when the schedule run's TTL runs out, if it has ended and has one
+func (kmsr *KmakeScheduleRun) Expiry() (time.Time, bool) {
+	if kmsr.Spec.TTLSecondsAfterFinished == nil || kmsr.Status.CompletionTime == nil {
+		return time.Time{}, false
+	}
+	return kmsr.Status.CompletionTime.Add(time.Duration(*kmsr.Spec.TTLSecondsAfterFinished) * time.Second), true
+}
+
+// ExpiredScheduleRuns picks the ended schedule runs past the history limits
+// or their TTL
+func ExpiredScheduleRuns(kmsrs []KmakeScheduleRun, successfulLimit *int32, failedLimit *int32, now time.Time) []KmakeScheduleRun {
+	sorted := make([]KmakeScheduleRun, len(kmsrs))
+	copy(sorted, kmsrs)
+
+	// newest first
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].CreationTimestamp.Equal(&sorted[j].CreationTimestamp) {
+			return sorted[i].Name > sorted[j].Name
+		}
+		return sorted[j].CreationTimestamp.Before(&sorted[i].CreationTimestamp)
+	})
+
+	successful := int32(0)
+	failed := int32(0)
+	ret := make([]KmakeScheduleRun, 0)
+
+	for _, kmsr := range sorted {
+		if !kmsr.HasEnded() {
+			continue
+		}
+
+		expired := false
+		if kmsr.IsSuccessful() {
+			successful++
+			expired = successfulLimit != nil && successful > *successfulLimit
+		} else {
+			failed++
+			expired = failedLimit != nil && failed > *failedLimit
+		}
+		if expiry, ok := kmsr.Expiry(); ok && !now.Before(expiry) {
+			expired = true
+		}
+		if expired {
+			ret = append(ret, kmsr)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,94 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("KmakeScheduleRunHistory", func() {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	kmsr := func(name string, run string, status string, age int) KmakeScheduleRun {
+		return KmakeScheduleRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(now.Add(-time.Duration(age) * time.Minute)),
+				Labels: map[string]string{
+					"bythepowerof.github.io/run":      run,
+					"bythepowerof.github.io/workload": "yes",
+					"bythepowerof.github.io/status":   status,
+				},
+			},
+		}
+	}
+
+	names := func(kmsrs []KmakeScheduleRun) []string {
+		ret := make([]string, 0)
+		for _, k := range kmsrs {
+			ret = append(ret, k.GetName())
+		}
+		return ret
+	}
+
+	Context("History limits", func() {
+		It("should delete the oldest ended runs past the limits", func() {
+			kmsrs := []KmakeScheduleRun{
+				kmsr("a1", "a", "Success", 50),
+				kmsr("b1", "b", "Success", 40),
+				kmsr("c1", "c", "Error", 30),
+				kmsr("d1", "d", "Abort", 20),
+				kmsr("a2", "a", "Success", 10),
+				kmsr("e1", "e", "Active", 60),
+			}
+			one := int32(1)
+			zero := int32(0)
+
+			Expect(names(ExpiredScheduleRuns(kmsrs, nil, nil, now))).To(BeEmpty())
+			Expect(names(ExpiredScheduleRuns(kmsrs, &one, nil, now))).To(Equal([]string{"b1", "a1"}))
+			// the schedulers remember the runs they've done, so even the
+			// newest schedule run of a run goes
+			Expect(names(ExpiredScheduleRuns(kmsrs, &zero, &zero, now))).To(Equal([]string{"a2", "d1", "c1", "b1", "a1"}))
+			Expect(names(ExpiredScheduleRuns(kmsrs, &one, &one, now))).To(Equal([]string{"c1", "b1", "a1"}))
+		})
+	})
+
+	Context("TTL", func() {
+		It("should delete runs once their TTL is up", func() {
+			ttl := int32(60)
+			ended := metav1.NewTime(now.Add(-2 * time.Minute))
+
+			old := kmsr("a1", "a", "Success", 10)
+			old.Spec.TTLSecondsAfterFinished = &ttl
+			old.Status.CompletionTime = &ended
+
+			expiry, ok := old.Expiry()
+			Expect(ok).To(BeTrue())
+			Expect(expiry).To(Equal(now.Add(-time.Minute)))
+
+			Expect(names(ExpiredScheduleRuns([]KmakeScheduleRun{old}, nil, nil, now))).To(Equal([]string{"a1"}))
+			Expect(names(ExpiredScheduleRuns([]KmakeScheduleRun{old}, nil, nil, now.Add(-2*time.Minute)))).To(BeEmpty())
+
+			newer := kmsr("a2", "a", "Active", 1)
+			Expect(names(ExpiredScheduleRuns([]KmakeScheduleRun{old, newer}, nil, nil, now))).To(Equal([]string{"a1"}))
+		})
+	})
+})
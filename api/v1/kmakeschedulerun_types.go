@@ -28,6 +28,26 @@ type KmakeScheduleRunSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	KmakeScheduleRunOperation `json:"operation"`
+	// TTLSecondsAfterFinished deletes the schedule run, and so its job, this
+	// long after it ends
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+	// ActiveDeadlineSeconds bounds how long the job may take, overriding the run's
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+	// Cancel aborts the schedule run and stops its job
+	Cancel bool `json:"cancel,omitempty"`
+}
+
+// AbortReason is why a schedule run was aborted
+type AbortReason int
+
+const (
+	Timeout AbortReason = iota
+	Cancelled
+	Superseded
+)
+
+func (d AbortReason) String() string {
+	return [...]string{"timeout", "cancelled", "superseded"}[d]
 }
 
 type KmakeScheduleRunOperation struct {
@@ -44,6 +64,9 @@ type KmakeScheduleRunStart struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 	// Run      string `json:"run,omitempty"`
+
+	// Variables override the scheduler's variables for this run only
+	Variables map[string]string `json:"variables,omitempty"`
 }
 
 func (k *KmakeScheduleRunStart) Dummy() string {
@@ -145,6 +168,33 @@ func (kmsr *KmakeScheduleRun) IsActive() bool {
 		strings.Contains(val, "Active")
 }
 
+func (kmsr *KmakeScheduleRun) IsAborted() bool {
+	val := GetDomainLabel(kmsr.Labels, StatusLabel)
+	return strings.Contains(val, "Abort")
+}
+
+func (kmsr *KmakeScheduleRun) IsWaiting() bool {
+	val := GetDomainLabel(kmsr.Labels, StatusLabel)
+	return strings.Contains(val, "BackOff") ||
+		strings.Contains(val, "Wait")
+}
+
+// HasStarted is true once the schedule run has made a job
+func (kmsr *KmakeScheduleRun) HasStarted() bool {
+	return kmsr.Status.GetSubReference(Job) != "" ||
+		kmsr.Status.GetSubReference(Check) != "" ||
+		len(kmsr.Status.Targets) > 0
+}
+
+// StartedAt is when the schedule run made its first job, or when it was made
+// for those started before that was recorded
+func (kmsr *KmakeScheduleRun) StartedAt() metav1.Time {
+	if kmsr.Status.StartTime != nil {
+		return *kmsr.Status.StartTime
+	}
+	return kmsr.CreationTimestamp
+}
+
 func (kmsr *KmakeScheduleRun) IsNew() bool {
 	return kmsr.Status.Status == "" || kmsr.Status.Status == "Provision Main (finalizer)"
 }
@@ -157,6 +207,18 @@ func (kmsr *KmakeScheduleRun) GetKmakeName() string {
 	return GetDomainLabel(kmsr.Labels, KmakeLabel)
 }
 
+// GetKmakeNamespace is where the kmake, its PVC and so the job live
+func (kmsr *KmakeScheduleRun) GetKmakeNamespace() string {
+	if ns := GetDomainLabel(kmsr.Labels, KmakeNamespaceLabel); ns != "" {
+		return ns
+	}
+	return kmsr.GetNamespace()
+}
+
+func (kmsr *KmakeScheduleRun) IsCrossNamespace() bool {
+	return kmsr.GetKmakeNamespace() != kmsr.GetNamespace()
+}
+
 func (kmsr *KmakeScheduleRun) GetKmakeRunName() string {
 	return GetDomainLabel(kmsr.Labels, RunLabel)
 }
@@ -191,6 +253,10 @@ func (kmakeschedulerun *KmakeScheduleRun) GetStatus() string {
 	return kmakeschedulerun.Status.Status
 }
 
+func (kmakeschedulerun *KmakeScheduleRun) GetKmakeStatus() *KmakeStatus {
+	return &kmakeschedulerun.Status
+}
+
 // +kubebuilder:object:root=true
 // KmakeScheduleRunList contains a list of KmakeScheduleRun
 type KmakeScheduleRunList struct {
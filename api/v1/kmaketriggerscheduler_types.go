@@ -0,0 +1,194 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KmakeTriggerSchedulerSpec defines the desired state of KmakeTriggerScheduler
+type KmakeTriggerSchedulerSpec struct {
+	Variables map[string]string `json:"variables,omitempty"`
+	Monitor   []string          `json:"monitor"`
+
+	// Triggers are the inputs whose content starts the monitored runs again
+	Triggers []KmakeTrigger `json:"triggers"`
+	// DebounceSeconds is how long the inputs must stay the same before the
+	// runs start
+	DebounceSeconds *int32 `json:"debounceSeconds,omitempty"`
+	// StartNewRuns starts a monitored run the first time the scheduler sees
+	// it, otherwise its inputs are only remembered and it waits for a change
+	StartNewRuns bool `json:"startNewRuns,omitempty"`
+
+	// SuccessfulRunsHistoryLimit is how many successful schedule runs to keep
+	SuccessfulRunsHistoryLimit *int32 `json:"successfulRunsHistoryLimit,omitempty"`
+	// FailedRunsHistoryLimit is how many failed or aborted schedule runs to keep
+	FailedRunsHistoryLimit *int32 `json:"failedRunsHistoryLimit,omitempty"`
+	// TTLSecondsAfterFinished is copied to the schedule runs this creates
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+	// ActiveDeadlineSeconds is copied to the schedule runs this creates
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+
+	// WebhookSecret names the secret whose WebhookSecretKey signs the push
+	// webhooks that start this scheduler's runs, none are taken without it
+	WebhookSecret string `json:"webhookSecret,omitempty"`
+}
+
+// KmakeTrigger names one input in the scheduler's namespace
+type KmakeTrigger struct {
+	ConfigMap string `json:"configMap,omitempty"`
+	Secret    string `json:"secret,omitempty"`
+	// Kmake triggers on changes to the kmake's variables
+	Kmake string `json:"kmake,omitempty"`
+}
+
+// KmakeTriggerSchedulerStatus adds the debounce state to KmakeStatus
+type KmakeTriggerSchedulerStatus struct {
+	KmakeStatus `json:",inline"`
+
+	// PendingHash is the hash of the inputs waiting out the debounce
+	PendingHash string `json:"pendingHash,omitempty"`
+	// PendingSince is when the inputs last changed
+	PendingSince *metav1.Time `json:"pendingSince,omitempty"`
+	// Started is how each run, by uid, was last started, remembered after
+	// the schedule runs are deleted
+	Started map[string]KmakeTriggerStart `json:"started,omitempty"`
+}
+
+// KmakeTriggerStart is the hash of the inputs a run was last started with
+// and how many times it's been started
+type KmakeTriggerStart struct {
+	Hash string `json:"hash"`
+	// Count names the schedule runs apart, so inputs going back to an
+	// earlier hash start the run again
+	Count int64 `json:"count"`
+}
+
+// +kubebuilder:object:root=true
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+// KmakeTriggerScheduler is the Schema for the kmaketriggerschedulers API
+type KmakeTriggerScheduler struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KmakeTriggerSchedulerSpec   `json:"spec,omitempty"`
+	Status KmakeTriggerSchedulerStatus `json:"status,omitempty"`
+}
+
+func (kmts *KmakeTriggerScheduler) IsBeingDeleted() bool {
+	return !kmts.ObjectMeta.DeletionTimestamp.IsZero()
+}
+
+const KmakeTriggerSchedulerFinalizerName = "kmaketriggerscheduler.finalizers.bythepowerof.github.com"
+
+func (kmaketriggerscheduler *KmakeTriggerScheduler) HasFinalizer(finalizerName string) bool {
+	return containsString(kmaketriggerscheduler.ObjectMeta.Finalizers, finalizerName)
+}
+
+func (kmaketriggerscheduler *KmakeTriggerScheduler) AddFinalizer(finalizerName string) {
+	kmaketriggerscheduler.ObjectMeta.Finalizers = append(kmaketriggerscheduler.ObjectMeta.Finalizers, finalizerName)
+}
+
+func (kmaketriggerscheduler *KmakeTriggerScheduler) RemoveFinalizer(finalizerName string) {
+	kmaketriggerscheduler.ObjectMeta.Finalizers = removeString(kmaketriggerscheduler.ObjectMeta.Finalizers, finalizerName)
+}
+
+func (kmaketriggerscheduler *KmakeTriggerScheduler) Variables() []KV {
+	ret := make([]KV, 0)
+
+	for k, v := range kmaketriggerscheduler.Spec.Variables {
+		ret = append(ret, KV{Key: k, Value: v})
+	}
+	return ret
+}
+
+func (kmaketriggerscheduler *KmakeTriggerScheduler) Monitor() []string {
+	return kmaketriggerscheduler.Spec.Monitor
+}
+
+func (kmaketriggerscheduler *KmakeTriggerScheduler) GetStatus() string {
+	return kmaketriggerscheduler.Status.Status
+}
+
+func (kmaketriggerscheduler *KmakeTriggerScheduler) GetKmakeStatus() *KmakeStatus {
+	return &kmaketriggerscheduler.Status.KmakeStatus
+}
+
+// IsSuspended is always false, trigger schedulers can't be suspended
+func (kmaketriggerscheduler *KmakeTriggerScheduler) IsSuspended() bool {
+	return false
+}
+
+// Triggers is true if the scheduler watches the named object of the kind,
+// one of ConfigMap, Secret or Kmake
+func (kmaketriggerscheduler *KmakeTriggerScheduler) Triggers(kind string, name string) bool {
+	for _, t := range kmaketriggerscheduler.Spec.Triggers {
+		switch kind {
+		case "ConfigMap":
+			if t.ConfigMap == name {
+				return true
+			}
+		case "Secret":
+			if t.Secret == name {
+				return true
+			}
+		case "Kmake":
+			if t.Kmake == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Debounced is how long is left before inputs that changed at since settle
+func (kmaketriggerscheduler *KmakeTriggerScheduler) Debounced(since time.Time, now time.Time) time.Duration {
+	if kmaketriggerscheduler.Spec.DebounceSeconds == nil {
+		return 0
+	}
+	return since.Add(time.Duration(*kmaketriggerscheduler.Spec.DebounceSeconds) * time.Second).Sub(now)
+}
+
+// TriggerHash is a short hash of the trigger inputs in order, good for a label
+func TriggerHash(inputs ...interface{}) (string, error) {
+	h := fnv.New32a()
+	for _, i := range inputs {
+		b, err := json.Marshal(i)
+		if err != nil {
+			return "", err
+		}
+		h.Write(b)
+	}
+	return fmt.Sprintf("%08x", h.Sum32()), nil
+}
+
+// +kubebuilder:object:root=true
+// KmakeTriggerSchedulerList contains a list of KmakeTriggerScheduler
+type KmakeTriggerSchedulerList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KmakeTriggerScheduler `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KmakeTriggerScheduler{}, &KmakeTriggerSchedulerList{})
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2019 microsoft.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"golang.org/x/net/context"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("KmakeTriggerScheduler", func() {
+	var (
+		key              types.NamespacedName
+		created, fetched *KmakeTriggerScheduler
+	)
+
+	Context("Create API", func() {
+
+		It("should create an object successfully", func() {
+
+			key = types.NamespacedName{
+				Name:      "foo",
+				Namespace: "default",
+			}
+			created = &KmakeTriggerScheduler{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "default",
+				},
+				Spec: KmakeTriggerSchedulerSpec{
+					Monitor: []string{"trigger"},
+					Variables: map[string]string{
+						"key1": "value1",
+					},
+					Triggers: []KmakeTrigger{
+						KmakeTrigger{ConfigMap: "config"},
+						KmakeTrigger{Kmake: "kmake"},
+					},
+				}}
+
+			By("creating an API obj")
+			Expect(k8sClient.Create(context.TODO(), created)).To(Succeed())
+
+			fetched = &KmakeTriggerScheduler{}
+			Expect(k8sClient.Get(context.TODO(), key, fetched)).To(Succeed())
+			Expect(fetched).To(Equal(created))
+
+			By("checking monitor field")
+			Expect(fetched.Monitor()).To(Equal([]string{"trigger"}))
+
+			By("deleting the created object")
+			Expect(k8sClient.Delete(context.TODO(), created)).To(Succeed())
+			Expect(k8sClient.Get(context.TODO(), key, created)).ToNot(Succeed())
+		})
+
+		It("should correctly handle finalizers", func() {
+			kmts := &KmakeTriggerScheduler{
+				ObjectMeta: metav1.ObjectMeta{
+					DeletionTimestamp: &metav1.Time{
+						Time: time.Now(),
+					},
+				},
+			}
+			Expect(kmts.IsBeingDeleted()).To(BeTrue())
+
+			kmts.AddFinalizer(KmakeTriggerSchedulerFinalizerName)
+			Expect(kmts.HasFinalizer(KmakeTriggerSchedulerFinalizerName)).To(BeTrue())
+
+			kmts.RemoveFinalizer(KmakeTriggerSchedulerFinalizerName)
+			Expect(kmts.HasFinalizer(KmakeTriggerSchedulerFinalizerName)).To(BeFalse())
+		})
+	})
+
+	Context("Triggers", func() {
+		kmts := &KmakeTriggerScheduler{
+			Spec: KmakeTriggerSchedulerSpec{
+				Triggers: []KmakeTrigger{
+					KmakeTrigger{ConfigMap: "config"},
+					KmakeTrigger{Secret: "secret"},
+				},
+			},
+		}
+
+		It("should match by kind and name", func() {
+			Expect(kmts.Triggers("ConfigMap", "config")).To(BeTrue())
+			Expect(kmts.Triggers("Secret", "secret")).To(BeTrue())
+			Expect(kmts.Triggers("Secret", "config")).To(BeFalse())
+			Expect(kmts.Triggers("Kmake", "config")).To(BeFalse())
+		})
+
+		It("should debounce for the configured time", func() {
+			now := time.Now()
+			Expect(kmts.Debounced(now, now)).To(Equal(time.Duration(0)))
+
+			ten := int32(10)
+			kmts.Spec.DebounceSeconds = &ten
+			Expect(kmts.Debounced(now, now.Add(4*time.Second))).To(Equal(6 * time.Second))
+			Expect(kmts.Debounced(now, now.Add(11*time.Second)) > 0).To(BeFalse())
+		})
+
+		It("should hash the inputs stably", func() {
+			a, err := TriggerHash(map[string]string{"a": "1", "b": "2"}, map[string][]byte{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(a).To(HaveLen(8))
+
+			b, _ := TriggerHash(map[string]string{"b": "2", "a": "1"}, map[string][]byte{})
+			Expect(b).To(Equal(a))
+
+			c, _ := TriggerHash(map[string]string{"a": "1", "b": "3"}, map[string][]byte{})
+			Expect(c).ToNot(Equal(a))
+		})
+	})
+})
@@ -1,4 +1,4 @@
-// +build !ignore_autogenerated
+//go:build !ignore_autogenerated
 
 /*
 
@@ -20,7 +20,8 @@ limitations under the License.
 package v1
 
 import (
-	runtime "k8s.io/apimachinery/pkg/runtime"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
@@ -69,7 +70,7 @@ func (in *Kmake) DeepCopyObject() runtime.Object {
 func (in *KmakeList) DeepCopyInto(out *KmakeList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
-	out.ListMeta = in.ListMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
 		*out = make([]Kmake, len(*in))
@@ -128,7 +129,7 @@ func (in *KmakeNowScheduler) DeepCopyObject() runtime.Object {
 func (in *KmakeNowSchedulerList) DeepCopyInto(out *KmakeNowSchedulerList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
-	out.ListMeta = in.ListMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
 		*out = make([]KmakeNowScheduler, len(*in))
@@ -171,6 +172,26 @@ func (in *KmakeNowSchedulerSpec) DeepCopyInto(out *KmakeNowSchedulerSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.SuccessfulRunsHistoryLimit != nil {
+		in, out := &in.SuccessfulRunsHistoryLimit, &out.SuccessfulRunsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FailedRunsHistoryLimit != nil {
+		in, out := &in.FailedRunsHistoryLimit, &out.FailedRunsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TTLSecondsAfterFinished != nil {
+		in, out := &in.TTLSecondsAfterFinished, &out.TTLSecondsAfterFinished
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ActiveDeadlineSeconds != nil {
+		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KmakeNowSchedulerSpec.
@@ -183,6 +204,132 @@ func (in *KmakeNowSchedulerSpec) DeepCopy() *KmakeNowSchedulerSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KmakeNowSchedulerStatus) DeepCopyInto(out *KmakeNowSchedulerStatus) {
+	*out = *in
+	in.KmakeStatus.DeepCopyInto(&out.KmakeStatus)
+	if in.Scheduled != nil {
+		in, out := &in.Scheduled, &out.Scheduled
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KmakeNowSchedulerStatus.
+func (in *KmakeNowSchedulerStatus) DeepCopy() *KmakeNowSchedulerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KmakeNowSchedulerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KmakeQuota) DeepCopyInto(out *KmakeQuota) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KmakeQuota.
+func (in *KmakeQuota) DeepCopy() *KmakeQuota {
+	if in == nil {
+		return nil
+	}
+	out := new(KmakeQuota)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KmakeQuota) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KmakeQuotaList) DeepCopyInto(out *KmakeQuotaList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]KmakeQuota, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KmakeQuotaList.
+func (in *KmakeQuotaList) DeepCopy() *KmakeQuotaList {
+	if in == nil {
+		return nil
+	}
+	out := new(KmakeQuotaList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KmakeQuotaList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KmakeQuotaSpec) DeepCopyInto(out *KmakeQuotaSpec) {
+	*out = *in
+	if in.MaxActiveJobs != nil {
+		in, out := &in.MaxActiveJobs, &out.MaxActiveJobs
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxRequests != nil {
+		in, out := &in.MaxRequests, &out.MaxRequests
+		*out = make(corev1.ResourceList, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val.DeepCopy()
+		}
+	}
+	if in.MaxDailyRuns != nil {
+		in, out := &in.MaxDailyRuns, &out.MaxDailyRuns
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KmakeQuotaSpec.
+func (in *KmakeQuotaSpec) DeepCopy() *KmakeQuotaSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KmakeQuotaSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KmakeReference) DeepCopyInto(out *KmakeReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KmakeReference.
+func (in *KmakeReference) DeepCopy() *KmakeReference {
+	if in == nil {
+		return nil
+	}
+	out := new(KmakeReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KmakeRule) DeepCopyInto(out *KmakeRule) {
 	*out = *in
@@ -300,7 +447,7 @@ func (in *KmakeRunJob) DeepCopy() *KmakeRunJob {
 func (in *KmakeRunList) DeepCopyInto(out *KmakeRunList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
-	out.ListMeta = in.ListMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
 		*out = make([]KmakeRun, len(*in))
@@ -362,6 +509,16 @@ func (in *KmakeRunOperation) DeepCopy() *KmakeRunOperation {
 func (in *KmakeRunSpec) DeepCopyInto(out *KmakeRunSpec) {
 	*out = *in
 	in.KmakeRunOperation.DeepCopyInto(&out.KmakeRunOperation)
+	if in.KmakeRef != nil {
+		in, out := &in.KmakeRef, &out.KmakeRef
+		*out = new(KmakeReference)
+		**out = **in
+	}
+	if in.ActiveDeadlineSeconds != nil {
+		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KmakeRunSpec.
@@ -465,7 +622,7 @@ func (in *KmakeScheduleRun) DeepCopyObject() runtime.Object {
 func (in *KmakeScheduleRunList) DeepCopyInto(out *KmakeScheduleRunList) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
-	out.ListMeta = in.ListMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
 	if in.Items != nil {
 		in, out := &in.Items, &out.Items
 		*out = make([]KmakeScheduleRun, len(*in))
@@ -499,7 +656,7 @@ func (in *KmakeScheduleRunOperation) DeepCopyInto(out *KmakeScheduleRunOperation
 	if in.Start != nil {
 		in, out := &in.Start, &out.Start
 		*out = new(KmakeScheduleRunStart)
-		**out = **in
+		(*in).DeepCopyInto(*out)
 	}
 	if in.Restart != nil {
 		in, out := &in.Restart, &out.Restart
@@ -562,6 +719,16 @@ func (in *KmakeScheduleRunRestart) DeepCopy() *KmakeScheduleRunRestart {
 func (in *KmakeScheduleRunSpec) DeepCopyInto(out *KmakeScheduleRunSpec) {
 	*out = *in
 	in.KmakeScheduleRunOperation.DeepCopyInto(&out.KmakeScheduleRunOperation)
+	if in.TTLSecondsAfterFinished != nil {
+		in, out := &in.TTLSecondsAfterFinished, &out.TTLSecondsAfterFinished
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ActiveDeadlineSeconds != nil {
+		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KmakeScheduleRunSpec.
@@ -577,6 +744,13 @@ func (in *KmakeScheduleRunSpec) DeepCopy() *KmakeScheduleRunSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *KmakeScheduleRunStart) DeepCopyInto(out *KmakeScheduleRunStart) {
 	*out = *in
+	if in.Variables != nil {
+		in, out := &in.Variables, &out.Variables
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KmakeScheduleRunStart.
@@ -644,6 +818,26 @@ func (in *KmakeStatus) DeepCopyInto(out *KmakeStatus) {
 			(*out)[key] = val
 		}
 	}
+	if in.Warnings != nil {
+		in, out := &in.Warnings, &out.Warnings
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Targets != nil {
+		in, out := &in.Targets, &out.Targets
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KmakeStatus.
@@ -655,3 +849,176 @@ func (in *KmakeStatus) DeepCopy() *KmakeStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KmakeTrigger) DeepCopyInto(out *KmakeTrigger) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KmakeTrigger.
+func (in *KmakeTrigger) DeepCopy() *KmakeTrigger {
+	if in == nil {
+		return nil
+	}
+	out := new(KmakeTrigger)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KmakeTriggerScheduler) DeepCopyInto(out *KmakeTriggerScheduler) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KmakeTriggerScheduler.
+func (in *KmakeTriggerScheduler) DeepCopy() *KmakeTriggerScheduler {
+	if in == nil {
+		return nil
+	}
+	out := new(KmakeTriggerScheduler)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KmakeTriggerScheduler) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KmakeTriggerSchedulerList) DeepCopyInto(out *KmakeTriggerSchedulerList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]KmakeTriggerScheduler, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KmakeTriggerSchedulerList.
+func (in *KmakeTriggerSchedulerList) DeepCopy() *KmakeTriggerSchedulerList {
+	if in == nil {
+		return nil
+	}
+	out := new(KmakeTriggerSchedulerList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KmakeTriggerSchedulerList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KmakeTriggerSchedulerSpec) DeepCopyInto(out *KmakeTriggerSchedulerSpec) {
+	*out = *in
+	if in.Variables != nil {
+		in, out := &in.Variables, &out.Variables
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Monitor != nil {
+		in, out := &in.Monitor, &out.Monitor
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Triggers != nil {
+		in, out := &in.Triggers, &out.Triggers
+		*out = make([]KmakeTrigger, len(*in))
+		copy(*out, *in)
+	}
+	if in.DebounceSeconds != nil {
+		in, out := &in.DebounceSeconds, &out.DebounceSeconds
+		*out = new(int32)
+		**out = **in
+	}
+	if in.SuccessfulRunsHistoryLimit != nil {
+		in, out := &in.SuccessfulRunsHistoryLimit, &out.SuccessfulRunsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.FailedRunsHistoryLimit != nil {
+		in, out := &in.FailedRunsHistoryLimit, &out.FailedRunsHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.TTLSecondsAfterFinished != nil {
+		in, out := &in.TTLSecondsAfterFinished, &out.TTLSecondsAfterFinished
+		*out = new(int32)
+		**out = **in
+	}
+	if in.ActiveDeadlineSeconds != nil {
+		in, out := &in.ActiveDeadlineSeconds, &out.ActiveDeadlineSeconds
+		*out = new(int64)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KmakeTriggerSchedulerSpec.
+func (in *KmakeTriggerSchedulerSpec) DeepCopy() *KmakeTriggerSchedulerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KmakeTriggerSchedulerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KmakeTriggerSchedulerStatus) DeepCopyInto(out *KmakeTriggerSchedulerStatus) {
+	*out = *in
+	in.KmakeStatus.DeepCopyInto(&out.KmakeStatus)
+	if in.PendingSince != nil {
+		in, out := &in.PendingSince, &out.PendingSince
+		*out = (*in).DeepCopy()
+	}
+	if in.Started != nil {
+		in, out := &in.Started, &out.Started
+		*out = make(map[string]KmakeTriggerStart, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KmakeTriggerSchedulerStatus.
+func (in *KmakeTriggerSchedulerStatus) DeepCopy() *KmakeTriggerSchedulerStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KmakeTriggerSchedulerStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KmakeTriggerStart) DeepCopyInto(out *KmakeTriggerStart) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KmakeTriggerStart.
+func (in *KmakeTriggerStart) DeepCopy() *KmakeTriggerStart {
+	if in == nil {
+		return nil
+	}
+	out := new(KmakeTriggerStart)
+	in.DeepCopyInto(out)
+	return out
+}
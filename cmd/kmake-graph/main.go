@@ -0,0 +1,73 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kmake-graph prints the dependency graph of a kmake, with the last schedule
+// run outcome of each target, as graphviz dot or mermaid
+//
+//	kmake-graph --namespace default --format dot mykmake | dot -Tsvg > mykmake.svg
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+	"github.com/bythepowerof/kmake-controller/gql"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = bythepowerofv1.AddToScheme(scheme)
+}
+
+func main() {
+	var namespace string
+	var format string
+
+	// the standard flags, controller-runtime adds --kubeconfig to them
+	flag.StringVar(&namespace, "namespace", "default", "The namespace of the kmake.")
+	flag.StringVar(&format, "format", "dot", "The graph format, dot or mermaid.")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <kmake>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to create client: %v\n", err)
+		os.Exit(1)
+	}
+
+	graph, err := gql.RenderKmakeGraph(context.Background(), c, namespace, flag.Arg(0), format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to render %s/%s: %v\n", namespace, flag.Arg(0), err)
+		os.Exit(1)
+	}
+	fmt.Print(graph)
+}
@@ -0,0 +1,226 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package controllerconfig reads the controller's versioned config file, with
+// the flags overriding it, and reloads what it can on SIGHUP
+package controllerconfig
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/namsral/flag"
+	"sigs.k8s.io/yaml"
+)
+
+// Options are the config file and the flags that override it
+type Options struct {
+	// File is the ControllerConfig YAML, empty for the defaults
+	File string
+	// WebhookPort overrides webhook.port
+	WebhookPort int
+	// SchedulerRequeue overrides requeue.scheduler
+	SchedulerRequeue time.Duration
+	// WaitRequeue overrides requeue.wait
+	WaitRequeue time.Duration
+	// MaxConcurrentReconciles overrides every controller's concurrency
+	MaxConcurrentReconciles int
+	// RateLimit overrides every controller's rate limit, field by field
+	RateLimit RateLimit
+
+	// fs is where we find out which flags were set
+	fs *flag.FlagSet
+}
+
+// BindFlags adds --controller-config, --webhook-port, --scheduler-requeue,
+// --wait-requeue, --max-concurrent-reconciles and the --rate-limit flags to
+// the flag set. --config is already namsral's file of flag
+// values, so ours is --controller-config
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	o.fs = fs
+
+	fs.StringVar(&o.File, "controller-config", "",
+		"The ControllerConfig file - leave empty for the defaults")
+	fs.IntVar(&o.WebhookPort, "webhook-port", 9443,
+		"The port the admission webhooks listen on, overrides the config file's webhook.port")
+	fs.DurationVar(&o.SchedulerRequeue, "scheduler-requeue", time.Minute,
+		"How often the schedulers look for work, overrides the config file's requeue.scheduler")
+	fs.DurationVar(&o.WaitRequeue, "wait-requeue", 30*time.Second,
+		"How often a waiting schedule run looks again, overrides the config file's requeue.wait")
+	fs.IntVar(&o.MaxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"How many objects of each kind reconcile at once, overrides the config file's concurrency")
+	fs.DurationVar(&o.RateLimit.BaseDelay.Duration, "rate-limit-base-delay", 5*time.Millisecond,
+		"The first backoff of a failing reconcile, overrides the config file's rateLimits")
+	fs.DurationVar(&o.RateLimit.MaxDelay.Duration, "rate-limit-max-delay", 1000*time.Second,
+		"The longest backoff of a failing reconcile, overrides the config file's rateLimits")
+	fs.Float64Var(&o.RateLimit.QPS, "rate-limit-qps", 10,
+		"The retries a second of each controller, overrides the config file's rateLimits")
+	fs.IntVar(&o.RateLimit.Burst, "rate-limit-burst", 100,
+		"The retries over the qps allowed at once, overrides the config file's rateLimits")
+}
+
+// Load reads the file, overrides it with the flags that were set, and fills
+// in and checks the rest
+func (o Options) Load() (*ControllerConfig, error) {
+	c := &ControllerConfig{}
+
+	if o.File != "" {
+		data, err := os.ReadFile(o.File)
+		if err != nil {
+			return nil, err
+		}
+		if err = yaml.UnmarshalStrict(data, c); err != nil {
+			return nil, fmt.Errorf("bad config %v: %v", o.File, err)
+		}
+		if c.APIVersion == "" || c.Kind == "" {
+			return nil, fmt.Errorf("config %v needs an apiVersion and kind", o.File)
+		}
+	}
+
+	set := map[string]bool{}
+	if o.fs != nil {
+		o.fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	}
+	if o.File == "" || set["webhook-port"] {
+		c.Webhook.Port = o.WebhookPort
+	}
+	if o.File == "" || set["scheduler-requeue"] {
+		c.Requeue.Scheduler.Duration = o.SchedulerRequeue
+	}
+	if o.File == "" || set["wait-requeue"] {
+		c.Requeue.Wait.Duration = o.WaitRequeue
+	}
+	for _, n := range c.concurrency() {
+		if set["max-concurrent-reconciles"] {
+			*n = o.MaxConcurrentReconciles
+		}
+	}
+	for _, limit := range c.rateLimits() {
+		if set["rate-limit-base-delay"] {
+			limit.BaseDelay = o.RateLimit.BaseDelay
+		}
+		if set["rate-limit-max-delay"] {
+			limit.MaxDelay = o.RateLimit.MaxDelay
+		}
+		if set["rate-limit-qps"] {
+			limit.QPS = o.RateLimit.QPS
+		}
+		if set["rate-limit-burst"] {
+			limit.Burst = o.RateLimit.Burst
+		}
+	}
+
+	c.Default()
+	if err := c.Validate(); err != nil {
+		if o.File != "" {
+			return nil, fmt.Errorf("bad config %v: %v", o.File, err)
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+// Build loads the config into a store that can reload it
+func (o Options) Build() (*Store, error) {
+	c, err := o.Load()
+	if err != nil {
+		return nil, err
+	}
+	return &Store{options: o, config: c}, nil
+}
+
+// Store hands out the current config, reloaded on SIGHUP. The reconcilers
+// share one, a nil Store hands out the defaults
+type Store struct {
+	// Log is where Start reports its reloads
+	Log logr.Logger
+
+	options Options
+
+	mu     sync.RWMutex
+	config *ControllerConfig
+}
+
+// Get is the current config, don't change it
+func (s *Store) Get() *ControllerConfig {
+	if s == nil {
+		c := &ControllerConfig{}
+		c.Default()
+		return c
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config
+}
+
+// Reload reads the file again and keeps what can change without a restart.
+// It returns the structural settings it left alone
+func (s *Store) Reload() ([]string, error) {
+	c, err := s.options.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ignored := s.config.Structural(c)
+	c.Webhook = s.config.Webhook
+	c.Recorders = s.config.Recorders
+	c.Concurrency = s.config.Concurrency
+	c.RateLimits = s.config.RateLimits
+	c.Events = s.config.Events
+
+	s.config = c
+	return ignored, nil
+}
+
+// Start reloads the config on SIGHUP until the context is done, a bad file
+// leaves the config as it was
+func (s *Store) Start(ctx context.Context) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hup:
+			ignored, err := s.Reload()
+			if err != nil {
+				s.Log.Error(err, "unable to reload the config", "file", s.options.File)
+				continue
+			}
+			if len(ignored) > 0 {
+				s.Log.Info("restart to change "+strings.Join(ignored, ", "), "file", s.options.File)
+			}
+			s.Log.Info("reloaded the config", "file", s.options.File)
+		}
+	}
+}
+
+// NeedLeaderElection is false, every replica keeps its config current
+func (s *Store) NeedLeaderElection() bool {
+	return false
+}
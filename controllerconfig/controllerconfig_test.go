@@ -0,0 +1,303 @@
+package controllerconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/namsral/flag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const testConfig = `apiVersion: config.bythepowerof.github.com/v1
+kind: ControllerConfig
+webhook:
+  port: 9444
+recorders:
+  kmake: kmake-test
+concurrency:
+  scheduleRun: 4
+requeue:
+  scheduler: 2m
+mounts:
+  pvc: /workspace
+jobs:
+  template:
+    metadata:
+      labels:
+        team: build
+    spec:
+      serviceAccountName: builder
+      containers:
+      - name: kmake
+        image: kmake:latest
+        resources:
+          limits:
+            cpu: "1"
+        env:
+        - name: VAR1
+          value: default1
+        - name: VAR2
+          value: default2
+`
+
+func writeConfig(t *testing.T, config string) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func load(t *testing.T, args ...string) (*Options, *ControllerConfig, error) {
+	t.Helper()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	o := &Options{}
+	o.BindFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	c, err := o.Load()
+	return o, c, err
+}
+
+func TestDefaultConfig(t *testing.T) {
+	_, c, err := load(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Webhook.Port != 9443 || c.Requeue.Scheduler.Duration != time.Minute || c.Requeue.Wait.Duration != 30*time.Second {
+		t.Errorf("got %+v", c)
+	}
+	if c.Mounts.Env != "/usr/share/env" || c.Recorders.ScheduleRun != "kmake-schedule-run-controller" {
+		t.Errorf("got %+v", c)
+	}
+
+	var s *Store
+	if s.Get().Mounts.Kmake != "/usr/share/kmake" {
+		t.Errorf("nil store got %+v", s.Get())
+	}
+}
+
+func TestFileConfig(t *testing.T) {
+	file := writeConfig(t, testConfig)
+
+	_, c, err := load(t, "--controller-config", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Webhook.Port != 9444 || c.Requeue.Scheduler.Duration != 2*time.Minute || c.Requeue.Wait.Duration != 30*time.Second {
+		t.Errorf("got %+v", c)
+	}
+	if c.Recorders.Kmake != "kmake-test" || c.Recorders.KmakeRun != "kmake-run-controller" {
+		t.Errorf("got recorders %+v", c.Recorders)
+	}
+	if c.Mounts.PVC != "/workspace" || c.Concurrency.ScheduleRun != 4 {
+		t.Errorf("got %+v", c)
+	}
+
+	// the flags that were set win
+	_, c, err = load(t, "--controller-config", file, "--webhook-port", "9445", "--wait-requeue", "10s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Webhook.Port != 9445 || c.Requeue.Wait.Duration != 10*time.Second || c.Requeue.Scheduler.Duration != 2*time.Minute {
+		t.Errorf("got %+v", c)
+	}
+}
+
+func TestBadConfig(t *testing.T) {
+	for config, want := range map[string]string{
+		"webhook:\n  port: 9444\n":                                                              "apiVersion",
+		"apiVersion: v1\nkind: ConfigMap\n":                                                     "unknown config",
+		"apiVersion: " + APIVersion + "\nkind: " + Kind + "\nwebhooks: {}\n":                    "unknown field",
+		"apiVersion: " + APIVersion + "\nkind: " + Kind + "\nmounts:\n  env: share/env\n":       "absolute",
+		"apiVersion: " + APIVersion + "\nkind: " + Kind + "\nmounts:\n  env: /usr/share/pvc/\n": "both mount",
+		"apiVersion: " + APIVersion + "\nkind: " + Kind + "\nrequeue:\n  wait: 10ms\n":          "under a second",
+		"apiVersion: " + APIVersion + "\nkind: " + Kind + "\nconcurrency:\n  kmake: -1\n":       "under one",
+		"apiVersion: " + APIVersion + "\nkind: " + Kind + "\nwebhook:\n  port: 70000\n":         "out of range",
+	} {
+		_, _, err := load(t, "--controller-config", writeConfig(t, config))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q got %v, want %v", config, err, want)
+		}
+	}
+
+	if _, _, err := load(t, "--controller-config", "/no/such/config.yaml"); err == nil {
+		t.Error("loaded a missing file")
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	file := writeConfig(t, testConfig)
+
+	o, _, err := load(t, "--controller-config", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := o.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := s.Get()
+
+	changed := strings.NewReplacer("port: 9444", "port: 9555", "scheduler: 2m", "scheduler: 5m", "pvc: /workspace", "pvc: /data").Replace(testConfig)
+	if err = os.WriteFile(file, []byte(changed), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ignored, err := s.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ignored) != 1 || ignored[0] != "webhook" {
+		t.Errorf("got ignored %v", ignored)
+	}
+
+	c := s.Get()
+	if c.Webhook.Port != 9444 || c.Requeue.Scheduler.Duration != 5*time.Minute || c.Mounts.PVC != "/data" {
+		t.Errorf("got %+v", c)
+	}
+	if before.Mounts.PVC != "/workspace" {
+		t.Errorf("reload changed the old config %+v", before)
+	}
+
+	// a bad file keeps what we had
+	if err = os.WriteFile(file, []byte("kind: nonsense\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Reload(); err == nil {
+		t.Error("reloaded a bad file")
+	}
+	if s.Get() != c {
+		t.Error("bad reload changed the config")
+	}
+}
+
+func TestApplyJob(t *testing.T) {
+	_, c, err := load(t, "--controller-config", writeConfig(t, testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "make", Env: []corev1.EnvVar{{Name: "VAR1", Value: "Value1"}}},
+				{Name: "sidecar", Image: "sidecar:latest"},
+			},
+		},
+	}
+	template.Labels = map[string]string{"team": "test"}
+
+	c.ApplyJob(template)
+
+	if template.Labels["team"] != "test" || template.Spec.ServiceAccountName != "builder" {
+		t.Errorf("got %+v", template)
+	}
+	kmake := template.Spec.Containers[0]
+	if kmake.Image != "kmake:latest" || !kmake.Resources.Limits.Cpu().Equal(resource.MustParse("1")) {
+		t.Errorf("got %+v", kmake)
+	}
+	if len(kmake.Env) != 2 || kmake.Env[0].Value != "Value1" || kmake.Env[1].Name != "VAR2" {
+		t.Errorf("got env %v", kmake.Env)
+	}
+	if template.Spec.Containers[1].Env != nil {
+		t.Errorf("defaulted the sidecar %+v", template.Spec.Containers[1])
+	}
+
+	// the defaults are left alone
+	template.Spec.Containers[0].Env[1].Value = "changed"
+	if c.Jobs.Template.Spec.Containers[0].Env[1].Value != "default2" {
+		t.Error("changed the defaults")
+	}
+}
+
+func TestControllerOptions(t *testing.T) {
+	file := writeConfig(t, testConfig+`rateLimits:
+  scheduleRun:
+    baseDelay: 1s
+    qps: 2
+    burst: 4
+`)
+
+	_, c, err := load(t, "--controller-config", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Concurrency.Kmake != 1 || c.Concurrency.ScheduleRun != 4 {
+		t.Errorf("got concurrency %+v", c.Concurrency)
+	}
+	limit := c.RateLimits.ScheduleRun
+	if limit.BaseDelay.Duration != time.Second || limit.MaxDelay.Duration != 1000*time.Second || limit.QPS != 2 || limit.Burst != 4 {
+		t.Errorf("got rate limit %+v", limit)
+	}
+
+	opts := c.Controller("KmakeScheduleRun")
+	if opts.MaxConcurrentReconciles != 4 || opts.RateLimiter == nil {
+		t.Errorf("got options %+v", opts)
+	}
+	req := reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "kmsr"}}
+	if d := opts.RateLimiter.When(req); d != time.Second {
+		t.Errorf("first backoff %v", d)
+	}
+	if d := opts.RateLimiter.When(req); d != 2*time.Second {
+		t.Errorf("second backoff %v", d)
+	}
+	if opts = c.Controller("Unknown"); opts.RateLimiter != nil {
+		t.Errorf("got options %+v for an unknown kind", opts)
+	}
+
+	// the flags set them all
+	_, c, err = load(t, "--controller-config", file, "--max-concurrent-reconciles", "8", "--rate-limit-qps", "50")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Concurrency.Kmake != 8 || c.Concurrency.ScheduleRun != 8 {
+		t.Errorf("got concurrency %+v", c.Concurrency)
+	}
+	if c.RateLimits.Kmake.QPS != 50 || c.RateLimits.ScheduleRun.QPS != 50 || c.RateLimits.ScheduleRun.Burst != 4 {
+		t.Errorf("got rate limits %+v", c.RateLimits)
+	}
+
+	for _, args := range [][]string{
+		{"--rate-limit-base-delay", "10s", "--rate-limit-max-delay", "1s"},
+		{"--rate-limit-burst", "-1"},
+		{"--max-concurrent-reconciles", "-1"},
+	} {
+		if _, _, err = load(t, args...); err == nil {
+			t.Errorf("loaded %v", args)
+		}
+	}
+}
+
+func TestEventsConfig(t *testing.T) {
+	_, c, err := load(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := c.Events.CorrelatorOptions()
+	if opts.BurstSize != 25 || opts.QPS != float32(1.0/300) || opts.MaxEvents != 10 || opts.MaxIntervalInSeconds != 600 {
+		t.Errorf("got correlator options %+v", opts)
+	}
+
+	_, c, err = load(t, "--controller-config", writeConfig(t, testConfig+"events:\n  burst: 5\n  refill: 1m\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Events.Burst != 5 || c.Events.Refill.Duration != time.Minute || c.Events.AggregateAfter != 10 {
+		t.Errorf("got events %+v", c.Events)
+	}
+
+	if _, _, err = load(t, "--controller-config", writeConfig(t, testConfig+"events:\n  refill: 10ms\n")); err == nil || !strings.Contains(err.Error(), "at least a second") {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,467 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllerconfig
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"time"
+
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// APIVersion is the version of the file we read
+	APIVersion = "config.bythepowerof.github.com/v1"
+	// Kind is the kind of the file we read
+	Kind = "ControllerConfig"
+)
+
+// ControllerConfig is the kmake-controller's configuration file
+type ControllerConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Webhook is the admission webhook server, it can't be reloaded
+	Webhook WebhookConfig `json:"webhook,omitempty"`
+	// Recorders are the event source of each controller, they can't be reloaded
+	Recorders RecorderConfig `json:"recorders,omitempty"`
+	// Concurrency is how many of each kind reconcile at once, it can't be
+	// reloaded
+	Concurrency ConcurrencyConfig `json:"concurrency,omitempty"`
+	// RateLimits is how fast each controller retries, they can't be reloaded
+	RateLimits RateLimitsConfig `json:"rateLimits,omitempty"`
+	// Events is how the events of a busy object are limited and combined, it
+	// can't be reloaded
+	Events EventsConfig `json:"events,omitempty"`
+
+	// Requeue is how long the controllers wait before looking again
+	Requeue RequeueConfig `json:"requeue,omitempty"`
+	// Mounts are where the jobs find what the schedule run gives them
+	Mounts MountConfig `json:"mounts,omitempty"`
+	// Jobs are the defaults of what the runs' job templates leave out
+	Jobs JobConfig `json:"jobs,omitempty"`
+}
+
+// WebhookConfig is the admission webhook server
+type WebhookConfig struct {
+	// Port is what the webhook server listens on, 9443 by default
+	Port int `json:"port,omitempty"`
+}
+
+// RecorderConfig are the names the controllers record their events as
+type RecorderConfig struct {
+	Kmake            string `json:"kmake,omitempty"`
+	KmakeRun         string `json:"kmakeRun,omitempty"`
+	NowScheduler     string `json:"nowScheduler,omitempty"`
+	TriggerScheduler string `json:"triggerScheduler,omitempty"`
+	ScheduleRun      string `json:"scheduleRun,omitempty"`
+}
+
+// ConcurrencyConfig is the MaxConcurrentReconciles of each controller, one at
+// a time by default
+type ConcurrencyConfig struct {
+	Kmake            int `json:"kmake,omitempty"`
+	KmakeRun         int `json:"kmakeRun,omitempty"`
+	NowScheduler     int `json:"nowScheduler,omitempty"`
+	TriggerScheduler int `json:"triggerScheduler,omitempty"`
+	ScheduleRun      int `json:"scheduleRun,omitempty"`
+}
+
+// RateLimitsConfig is the rate limit of each controller's queue
+type RateLimitsConfig struct {
+	Kmake            RateLimit `json:"kmake,omitempty"`
+	KmakeRun         RateLimit `json:"kmakeRun,omitempty"`
+	NowScheduler     RateLimit `json:"nowScheduler,omitempty"`
+	TriggerScheduler RateLimit `json:"triggerScheduler,omitempty"`
+	ScheduleRun      RateLimit `json:"scheduleRun,omitempty"`
+}
+
+// RateLimit is the backoff of each failing object and the retry rate of them
+// all, the defaults are controller-runtime's
+type RateLimit struct {
+	// BaseDelay is the first backoff, doubling on each failure, 5ms by default
+	BaseDelay metav1.Duration `json:"baseDelay,omitempty"`
+	// MaxDelay is the longest backoff, 1000s by default
+	MaxDelay metav1.Duration `json:"maxDelay,omitempty"`
+	// QPS is the retries a second of all the objects, 10 by default
+	QPS float64 `json:"qps,omitempty"`
+	// Burst is the retries over QPS allowed at once, 100 by default
+	Burst int `json:"burst,omitempty"`
+}
+
+// EventsConfig is the event recorder's spam filter and aggregation, the
+// defaults are client-go's
+type EventsConfig struct {
+	// Burst is how many events an object records before they're limited, 25
+	// by default
+	Burst int `json:"burst,omitempty"`
+	// Refill is how often a limited object can record one more, 5m by default
+	Refill metav1.Duration `json:"refill,omitempty"`
+	// AggregateAfter is how many events of an object with the same reason
+	// there are before they're combined into one, 10 by default
+	AggregateAfter int `json:"aggregateAfter,omitempty"`
+	// AggregateWindow is how long similar events count towards combining,
+	// 10m by default
+	AggregateWindow metav1.Duration `json:"aggregateWindow,omitempty"`
+}
+
+// CorrelatorOptions is the event broadcaster's correlator
+func (e EventsConfig) CorrelatorOptions() record.CorrelatorOptions {
+	return record.CorrelatorOptions{
+		BurstSize:            e.Burst,
+		QPS:                  float32(1 / e.Refill.Seconds()),
+		MaxEvents:            e.AggregateAfter,
+		MaxIntervalInSeconds: int(e.AggregateWindow.Seconds()),
+	}
+}
+
+// RequeueConfig is how long the controllers wait before looking again
+type RequeueConfig struct {
+	// Scheduler is how often the schedulers look for work, 1m by default
+	Scheduler metav1.Duration `json:"scheduler,omitempty"`
+	// Wait is how often a waiting schedule run looks at its suspended
+	// scheduler or its kmake's quotas, 30s by default
+	Wait metav1.Duration `json:"wait,omitempty"`
+}
+
+// MountConfig are where the job's first container mounts its inputs
+type MountConfig struct {
+	// Env is the kmake's variables, /usr/share/env by default
+	Env string `json:"env,omitempty"`
+	// Schedule is the scheduler's variables, /usr/share/schedule by default
+	Schedule string `json:"schedule,omitempty"`
+	// PVC is the kmake's volume, /usr/share/pvc by default
+	PVC string `json:"pvc,omitempty"`
+	// Kmake is the kmake's makefile, /usr/share/kmake by default
+	Kmake string `json:"kmake,omitempty"`
+	// Owner is the schedule run's owner, /usr/share/owner by default
+	Owner string `json:"owner,omitempty"`
+}
+
+// JobConfig are the job defaults
+type JobConfig struct {
+	// Template fills in what a run's job template leaves empty, its first
+	// container the run's first container
+	Template corev1.PodTemplateSpec `json:"template,omitempty"`
+}
+
+// Default fills in what the file left out
+func (c *ControllerConfig) Default() {
+	if c.APIVersion == "" {
+		c.APIVersion = APIVersion
+	}
+	if c.Kind == "" {
+		c.Kind = Kind
+	}
+
+	if c.Webhook.Port == 0 {
+		c.Webhook.Port = 9443
+	}
+
+	defaultString(&c.Recorders.Kmake, "kmake-controller")
+	defaultString(&c.Recorders.KmakeRun, "kmake-run-controller")
+	defaultString(&c.Recorders.NowScheduler, "kmake-now-scheduler-controller")
+	defaultString(&c.Recorders.TriggerScheduler, "kmake-trigger-scheduler-controller")
+	defaultString(&c.Recorders.ScheduleRun, "kmake-schedule-run-controller")
+
+	for _, n := range c.concurrency() {
+		if *n == 0 {
+			*n = 1
+		}
+	}
+	for _, limit := range c.rateLimits() {
+		limit.Default()
+	}
+
+	if c.Events.Burst == 0 {
+		c.Events.Burst = 25
+	}
+	if c.Events.Refill.Duration == 0 {
+		c.Events.Refill.Duration = 5 * time.Minute
+	}
+	if c.Events.AggregateAfter == 0 {
+		c.Events.AggregateAfter = 10
+	}
+	if c.Events.AggregateWindow.Duration == 0 {
+		c.Events.AggregateWindow.Duration = 10 * time.Minute
+	}
+
+	if c.Requeue.Scheduler.Duration == 0 {
+		c.Requeue.Scheduler.Duration = time.Minute
+	}
+	if c.Requeue.Wait.Duration == 0 {
+		c.Requeue.Wait.Duration = 30 * time.Second
+	}
+
+	defaultString(&c.Mounts.Env, "/usr/share/env")
+	defaultString(&c.Mounts.Schedule, "/usr/share/schedule")
+	defaultString(&c.Mounts.PVC, "/usr/share/pvc")
+	defaultString(&c.Mounts.Kmake, "/usr/share/kmake")
+	defaultString(&c.Mounts.Owner, "/usr/share/owner")
+}
+
+// concurrency is each controller's concurrency by name
+func (c *ControllerConfig) concurrency() map[string]*int {
+	return map[string]*int{
+		"kmake":            &c.Concurrency.Kmake,
+		"kmakeRun":         &c.Concurrency.KmakeRun,
+		"nowScheduler":     &c.Concurrency.NowScheduler,
+		"triggerScheduler": &c.Concurrency.TriggerScheduler,
+		"scheduleRun":      &c.Concurrency.ScheduleRun,
+	}
+}
+
+// rateLimits is each controller's rate limit by name
+func (c *ControllerConfig) rateLimits() map[string]*RateLimit {
+	return map[string]*RateLimit{
+		"kmake":            &c.RateLimits.Kmake,
+		"kmakeRun":         &c.RateLimits.KmakeRun,
+		"nowScheduler":     &c.RateLimits.NowScheduler,
+		"triggerScheduler": &c.RateLimits.TriggerScheduler,
+		"scheduleRun":      &c.RateLimits.ScheduleRun,
+	}
+}
+
+// Default fills in controller-runtime's defaults
+func (l *RateLimit) Default() {
+	if l.BaseDelay.Duration == 0 {
+		l.BaseDelay.Duration = 5 * time.Millisecond
+	}
+	if l.MaxDelay.Duration == 0 {
+		l.MaxDelay.Duration = 1000 * time.Second
+	}
+	if l.QPS == 0 {
+		l.QPS = 10
+	}
+	if l.Burst == 0 {
+		l.Burst = 100
+	}
+}
+
+// Validate checks a defaulted rate limit
+func (l *RateLimit) Validate() error {
+	if l.BaseDelay.Duration < 0 || l.MaxDelay.Duration < l.BaseDelay.Duration {
+		return fmt.Errorf("delays %v to %v are out of order", l.BaseDelay.Duration, l.MaxDelay.Duration)
+	}
+	if l.QPS < 0 || l.Burst < 1 {
+		return fmt.Errorf("%v qps with a burst of %v never retries", l.QPS, l.Burst)
+	}
+	return nil
+}
+
+// RateLimiter is the queue's rate limiter, the slower of the object's backoff
+// and the overall rate
+func (l RateLimit) RateLimiter() workqueue.TypedRateLimiter[reconcile.Request] {
+	return workqueue.NewTypedMaxOfRateLimiter(
+		workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](l.BaseDelay.Duration, l.MaxDelay.Duration),
+		&workqueue.TypedBucketRateLimiter[reconcile.Request]{Limiter: rate.NewLimiter(rate.Limit(l.QPS), l.Burst)},
+	)
+}
+
+// Controller is the options of the kind's controller
+func (c *ControllerConfig) Controller(kind string) controller.Options {
+	var n int
+	var limit RateLimit
+
+	switch kind {
+	case "Kmake":
+		n, limit = c.Concurrency.Kmake, c.RateLimits.Kmake
+	case "KmakeRun":
+		n, limit = c.Concurrency.KmakeRun, c.RateLimits.KmakeRun
+	case "KmakeNowScheduler":
+		n, limit = c.Concurrency.NowScheduler, c.RateLimits.NowScheduler
+	case "KmakeTriggerScheduler":
+		n, limit = c.Concurrency.TriggerScheduler, c.RateLimits.TriggerScheduler
+	case "KmakeScheduleRun":
+		n, limit = c.Concurrency.ScheduleRun, c.RateLimits.ScheduleRun
+	default:
+		return controller.Options{}
+	}
+	return controller.Options{
+		MaxConcurrentReconciles: n,
+		RateLimiter:             limit.RateLimiter(),
+	}
+}
+
+func defaultString(s *string, value string) {
+	if *s == "" {
+		*s = value
+	}
+}
+
+// Validate checks a defaulted config
+func (c *ControllerConfig) Validate() error {
+	if c.APIVersion != APIVersion || c.Kind != Kind {
+		return fmt.Errorf("unknown config %v %v, want %v %v", c.APIVersion, c.Kind, APIVersion, Kind)
+	}
+
+	if c.Webhook.Port < 1 || c.Webhook.Port > 65535 {
+		return fmt.Errorf("webhook port %v out of range", c.Webhook.Port)
+	}
+
+	for name, n := range c.concurrency() {
+		if *n < 1 {
+			return fmt.Errorf("%v concurrency %v is under one", name, *n)
+		}
+	}
+	for name, limit := range c.rateLimits() {
+		if err := limit.Validate(); err != nil {
+			return fmt.Errorf("%v rate limit: %v", name, err)
+		}
+	}
+
+	if c.Events.Burst < 1 || c.Events.AggregateAfter < 1 {
+		return fmt.Errorf("events burst %v and aggregateAfter %v must be at least one", c.Events.Burst, c.Events.AggregateAfter)
+	}
+	if c.Events.Refill.Duration < time.Second || c.Events.AggregateWindow.Duration < time.Second {
+		return fmt.Errorf("events refill %v and aggregateWindow %v must be at least a second", c.Events.Refill.Duration, c.Events.AggregateWindow.Duration)
+	}
+
+	if c.Requeue.Scheduler.Duration < time.Second {
+		return fmt.Errorf("scheduler requeue %v is under a second", c.Requeue.Scheduler.Duration)
+	}
+	if c.Requeue.Wait.Duration < time.Second {
+		return fmt.Errorf("wait requeue %v is under a second", c.Requeue.Wait.Duration)
+	}
+
+	seen := map[string]string{}
+	for name, p := range map[string]string{
+		"env":      c.Mounts.Env,
+		"schedule": c.Mounts.Schedule,
+		"pvc":      c.Mounts.PVC,
+		"kmake":    c.Mounts.Kmake,
+		"owner":    c.Mounts.Owner,
+	} {
+		if !path.IsAbs(p) {
+			return fmt.Errorf("%v mount %v isn't an absolute path", name, p)
+		}
+		p = path.Clean(p)
+		if other, ok := seen[p]; ok {
+			return fmt.Errorf("%v and %v both mount at %v", name, other, p)
+		}
+		seen[p] = name
+	}
+
+	if len(c.Jobs.Template.Spec.Containers) > 1 {
+		return fmt.Errorf("the job template has %v containers, it defaults the first one only", len(c.Jobs.Template.Spec.Containers))
+	}
+	return nil
+}
+
+// Structural are the names of the settings that differ from the other config,
+// and need a restart to change
+func (c *ControllerConfig) Structural(other *ControllerConfig) []string {
+	changed := []string{}
+	if c.Webhook != other.Webhook {
+		changed = append(changed, "webhook")
+	}
+	if c.Recorders != other.Recorders {
+		changed = append(changed, "recorders")
+	}
+	if c.Concurrency != other.Concurrency {
+		changed = append(changed, "concurrency")
+	}
+	if c.RateLimits != other.RateLimits {
+		changed = append(changed, "rateLimits")
+	}
+	if c.Events != other.Events {
+		changed = append(changed, "events")
+	}
+	return changed
+}
+
+// ApplyJob fills in what the template leaves empty from the job defaults
+func (c *ControllerConfig) ApplyJob(template *corev1.PodTemplateSpec) {
+	// a copy, the template's job changes what it's given
+	defaults := c.Jobs.Template.DeepCopy()
+
+	template.Labels = mergeMap(template.Labels, defaults.Labels)
+	template.Annotations = mergeMap(template.Annotations, defaults.Annotations)
+
+	spec := &template.Spec
+	defaultString(&spec.ServiceAccountName, defaults.Spec.ServiceAccountName)
+	defaultString(&spec.PriorityClassName, defaults.Spec.PriorityClassName)
+	if spec.RestartPolicy == "" {
+		spec.RestartPolicy = defaults.Spec.RestartPolicy
+	}
+	if spec.NodeSelector == nil {
+		spec.NodeSelector = defaults.Spec.NodeSelector
+	}
+	if spec.Tolerations == nil {
+		spec.Tolerations = defaults.Spec.Tolerations
+	}
+	if spec.ImagePullSecrets == nil {
+		spec.ImagePullSecrets = defaults.Spec.ImagePullSecrets
+	}
+	if spec.Affinity == nil {
+		spec.Affinity = defaults.Spec.Affinity
+	}
+	if spec.SecurityContext == nil {
+		spec.SecurityContext = defaults.Spec.SecurityContext
+	}
+
+	if len(defaults.Spec.Containers) == 0 || len(spec.Containers) == 0 {
+		return
+	}
+	container := &spec.Containers[0]
+	dc := defaults.Spec.Containers[0]
+
+	defaultString(&container.Image, dc.Image)
+	if container.ImagePullPolicy == "" {
+		container.ImagePullPolicy = dc.ImagePullPolicy
+	}
+	if reflect.DeepEqual(container.Resources, corev1.ResourceRequirements{}) {
+		container.Resources = dc.Resources
+	}
+	if container.SecurityContext == nil {
+		container.SecurityContext = dc.SecurityContext
+	}
+	for _, env := range dc.Env {
+		found := false
+		for _, e := range container.Env {
+			if e.Name == env.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			container.Env = append(container.Env, env)
+		}
+	}
+}
+
+// mergeMap adds the defaults missing from m
+func mergeMap(m, defaults map[string]string) map[string]string {
+	if len(defaults) == 0 {
+		return m
+	}
+	if m == nil {
+		m = map[string]string{}
+	}
+	for k, v := range defaults {
+		if _, ok := m[k]; !ok {
+			m[k] = v
+		}
+	}
+	return m
+}
@@ -0,0 +1,299 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+)
+
+// reconcileAll reconciles the requests at once, a worker each, and returns
+// the errors
+func reconcileAll(r interface {
+	Reconcile(context.Context, ctrl.Request) (ctrl.Result, error)
+}, reqs []ctrl.Request) []error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(reqs))
+	for i := range reqs {
+		wg.Add(1)
+		go func(i int) {
+			defer GinkgoRecover()
+			defer wg.Done()
+			_, errs[i] = r.Reconcile(context.Background(), reqs[i])
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// slowJobs is an API server slow to make jobs, so the reconciles overlap
+type slowJobs struct {
+	client.Client
+}
+
+func (c slowJobs) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if _, ok := obj.(*batchv1.Job); ok {
+		time.Sleep(20 * time.Millisecond)
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+var _ = Describe("Controllers/Concurrency", func() {
+	const namespace = "default"
+
+	var (
+		testScheme *runtime.Scheme
+		c          client.Client
+	)
+
+	BeforeEach(func() {
+		testScheme = runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+		Expect(bythepowerofv1.AddToScheme(testScheme)).To(Succeed())
+	})
+
+	Context("Keyed locks", func() {
+		It("Should let one through per key and the keys in parallel", func() {
+			locks := &keyedLocks{}
+			var inside, most int32
+			var wg sync.WaitGroup
+
+			for i := 0; i < 40; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					unlock := locks.Lock(fmt.Sprintf("kmake-%d", i%2))
+					defer unlock()
+
+					n := atomic.AddInt32(&inside, 1)
+					for {
+						m := atomic.LoadInt32(&most)
+						if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+							break
+						}
+					}
+					time.Sleep(time.Millisecond)
+					atomic.AddInt32(&inside, -1)
+				}(i)
+			}
+			wg.Wait()
+
+			Expect(most).To(BeNumerically("<=", 2))
+			Expect(locks.locks).To(BeEmpty())
+		})
+	})
+
+	Context("Schedule runs", func() {
+		kmake := func(name string) client.Object {
+			return &bythepowerofv1.Kmake{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, UID: types.UID(name + "-uid")},
+				Status: bythepowerofv1.KmakeStatus{Resources: map[string]string{
+					bythepowerofv1.PVC.String():      name + "-pvc",
+					bythepowerofv1.EnvMap.String():   name + "-env",
+					bythepowerofv1.KmakeMap.String(): name + "-kmake",
+				}},
+			}
+		}
+		run := func(name string, kmake string) client.Object {
+			return &bythepowerofv1.KmakeRun{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, UID: types.UID(name + "-uid"),
+					Labels: map[string]string{bythepowerofv1.MakeDomainString(bythepowerofv1.KmakeLabel): kmake}},
+				Spec: bythepowerofv1.KmakeRunSpec{
+					KmakeRunOperation: bythepowerofv1.KmakeRunOperation{
+						Job: &bythepowerofv1.KmakeRunJob{
+							Template: corev1.PodTemplateSpec{
+								Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "kmake", Image: "make"}}},
+							},
+							Targets: []string{"all"},
+						},
+					},
+				},
+			}
+		}
+		kmsr := func(name string, kmake string, run string) client.Object {
+			return &bythepowerofv1.KmakeScheduleRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: name, Namespace: namespace, UID: types.UID(name + "-uid"),
+					Finalizers: []string{bythepowerofv1.KmakeScheduleRunFinalizerName},
+					Labels: map[string]string{
+						bythepowerofv1.MakeDomainString(bythepowerofv1.KmakeLabel):          kmake,
+						bythepowerofv1.MakeDomainString(bythepowerofv1.KmakeNamespaceLabel): namespace,
+						bythepowerofv1.MakeDomainString(bythepowerofv1.RunLabel):            run,
+						bythepowerofv1.MakeDomainString(bythepowerofv1.ScheduleEnvLabel):    "schedule-env",
+						bythepowerofv1.MakeDomainString(bythepowerofv1.StatusLabel):         "Provision",
+					},
+				},
+				Spec: bythepowerofv1.KmakeScheduleRunSpec{
+					KmakeScheduleRunOperation: bythepowerofv1.KmakeScheduleRunOperation{
+						Start: &bythepowerofv1.KmakeScheduleRunStart{},
+					},
+				},
+			}
+		}
+
+		// startAll reconciles the schedule runs at once and checks no more
+		// than the quota's jobs were made, the rest waiting for room
+		startAll := func(objects []client.Object, reqs []ctrl.Request, maxJobs int32) {
+			c = fake.NewClientBuilder().WithScheme(testScheme).WithObjects(objects...).
+				WithStatusSubresource(&bythepowerofv1.KmakeScheduleRun{}).Build()
+			r := &KmakeScheduleRunReconciler{
+				Client:    slowJobs{c},
+				APIReader: c,
+				Recorder:  record.NewFakeRecorder(1000),
+				Scheme:    testScheme,
+			}
+
+			for _, err := range reconcileAll(r, reqs) {
+				Expect(err).ToNot(HaveOccurred())
+			}
+
+			jobs := &batchv1.JobList{}
+			Expect(c.List(context.Background(), jobs, client.InNamespace(namespace))).To(Succeed())
+			Expect(jobs.Items).To(HaveLen(int(maxJobs)))
+
+			waiting := 0
+			kmsrs := &bythepowerofv1.KmakeScheduleRunList{}
+			Expect(c.List(context.Background(), kmsrs, client.InNamespace(namespace))).To(Succeed())
+			for _, kmsr := range kmsrs.Items {
+				if kmsr.IsWaiting() {
+					Expect(kmsr.Status.Status).To(ContainSubstring(fmt.Sprintf("quota: %d active jobs", maxJobs)))
+					waiting++
+				}
+			}
+			Expect(waiting).To(Equal(len(reqs) - int(maxJobs)))
+		}
+
+		It("Should start no more than the quota when reconciled in parallel", func() {
+			maxJobs := int32(3)
+			objects := []client.Object{
+				kmake("kmake"),
+				run("run", "kmake"),
+				&bythepowerofv1.KmakeQuota{
+					ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: namespace},
+					Spec:       bythepowerofv1.KmakeQuotaSpec{MaxActiveJobs: &maxJobs},
+				},
+			}
+
+			reqs := []ctrl.Request{}
+			for i := 0; i < 20; i++ {
+				name := fmt.Sprintf("kmsr-%02d", i)
+				objects = append(objects, kmsr(name, "kmake", "run"))
+				reqs = append(reqs, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}})
+			}
+
+			startAll(objects, reqs, maxJobs)
+		})
+
+		It("Should start no more than a namespace wide quota across kmakes", func() {
+			maxJobs := int32(3)
+			objects := []client.Object{
+				kmake("kmake-a"),
+				kmake("kmake-b"),
+				run("run-a", "kmake-a"),
+				run("run-b", "kmake-b"),
+				&bythepowerofv1.KmakeQuota{
+					ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: namespace},
+					Spec:       bythepowerofv1.KmakeQuotaSpec{MaxActiveJobs: &maxJobs},
+				},
+			}
+
+			reqs := []ctrl.Request{}
+			for i := 0; i < 20; i++ {
+				name := fmt.Sprintf("kmsr-%02d", i)
+				suffix := []string{"a", "b"}[i%2]
+				objects = append(objects, kmsr(name, "kmake-"+suffix, "run-"+suffix))
+				reqs = append(reqs, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: name}})
+			}
+
+			startAll(objects, reqs, maxJobs)
+		})
+	})
+
+	Context("Now schedulers", func() {
+		It("Should make one schedule run per run however many reconcile at once", func() {
+			objects := []client.Object{
+				&bythepowerofv1.KmakeNowScheduler{
+					ObjectMeta: metav1.ObjectMeta{Name: "now", Namespace: namespace, UID: "now-uid",
+						Finalizers: []string{bythepowerofv1.KmakeNowSchedulerFinalizerName}},
+					Spec: bythepowerofv1.KmakeNowSchedulerSpec{Monitor: []string{"nightly"}},
+				},
+			}
+			for i := 0; i < 25; i++ {
+				name := fmt.Sprintf("run-%02d", i)
+				objects = append(objects, &bythepowerofv1.KmakeRun{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, UID: types.UID(name + "-uid"),
+						Labels: map[string]string{
+							bythepowerofv1.MakeDomainString(bythepowerofv1.KmakeLabel):    "kmake",
+							bythepowerofv1.MakeDomainString(bythepowerofv1.ScheduleLabel): "nightly",
+						}},
+				})
+			}
+
+			c = fake.NewClientBuilder().WithScheme(testScheme).WithObjects(objects...).
+				WithStatusSubresource(&bythepowerofv1.KmakeNowScheduler{}).Build()
+			r := &KmakeNowSchedulerReconciler{
+				Client:   c,
+				Recorder: record.NewFakeRecorder(10000),
+				Scheme:   testScheme,
+			}
+
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: "now"}}
+
+			// make the env map
+			_, err := r.Reconcile(context.Background(), req)
+			Expect(err).ToNot(HaveOccurred())
+
+			// as if from several replicas, or a stale cache, some lose the
+			// race to update the scheduler and are retried
+			reqs := []ctrl.Request{}
+			for i := 0; i < 8; i++ {
+				reqs = append(reqs, req)
+			}
+			reconcileAll(r, reqs)
+			_, err = r.Reconcile(context.Background(), req)
+			Expect(err).ToNot(HaveOccurred())
+
+			kmsrs := &bythepowerofv1.KmakeScheduleRunList{}
+			Expect(c.List(context.Background(), kmsrs, client.InNamespace(namespace))).To(Succeed())
+			Expect(kmsrs.Items).To(HaveLen(25))
+
+			runs := map[string]bool{}
+			for _, kmsr := range kmsrs.Items {
+				runs[kmsr.GetKmakeRunName()] = true
+			}
+			Expect(runs).To(HaveLen(25))
+		})
+	})
+})
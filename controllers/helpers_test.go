@@ -0,0 +1,168 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/gomega"
+
+	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// builders for the test objects shared by the controller tests
+
+func newTestKmake(name string, namespace string) *bythepowerofv1.Kmake {
+	storageClass := ""
+
+	return &bythepowerofv1.Kmake{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: bythepowerofv1.KmakeSpec{
+			PersistentVolumeClaimTemplate: corev1.PersistentVolumeClaimSpec{
+				AccessModes: []corev1.PersistentVolumeAccessMode{"ReadWriteOnce"},
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{
+						"storage": resource.MustParse("3Ki"),
+					},
+				},
+				StorageClassName: &storageClass,
+			},
+			Variables: map[string]string{
+				"VAR1": "Value1",
+			},
+			Rules: []bythepowerofv1.KmakeRule{
+				bythepowerofv1.KmakeRule{
+					Targets:  []string{"Rule1"},
+					Commands: []string{"@echo $(VAR1) $@"},
+				},
+			},
+		},
+	}
+}
+
+func newTestKmakeRun(name string, namespace string, kmake string) *bythepowerofv1.KmakeRun {
+	return &bythepowerofv1.KmakeRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"bythepowerof.github.io/kmake": kmake,
+			},
+		},
+		Spec: bythepowerofv1.KmakeRunSpec{
+			KmakeRunOperation: bythepowerofv1.KmakeRunOperation{
+				Job: &bythepowerofv1.KmakeRunJob{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								corev1.Container{
+									Name:    "test",
+									Command: []string{"make"},
+									Image:   "jeremymarshall/make-test:1",
+									Args: []string{
+										"-f",
+										"/usr/share/kmake/kmake.mk",
+									},
+								},
+							},
+						},
+					},
+					Targets: []string{"Rule1"},
+				},
+			},
+		},
+	}
+}
+
+func newTestKmakeScheduleRun(name string, namespace string, kmake string, run string, schedenv string) *bythepowerofv1.KmakeScheduleRun {
+	return &bythepowerofv1.KmakeScheduleRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels: map[string]string{
+				"bythepowerof.github.io/schedule-instance": "test",
+				"bythepowerof.github.io/run":               run,
+				"bythepowerof.github.io/kmake":             kmake,
+				"bythepowerof.github.io/schedule-env":      schedenv,
+				"bythepowerof.github.io/workload":          "yes",
+				"bythepowerof.github.io/status":            "Provision",
+			},
+		},
+		Spec: bythepowerofv1.KmakeScheduleRunSpec{
+			KmakeScheduleRunOperation: bythepowerofv1.KmakeScheduleRunOperation{
+				Start: &bythepowerofv1.KmakeScheduleRunStart{},
+			},
+		},
+	}
+}
+
+// newReadyTestKmake is a kmake as its controller leaves it, with its finalizer
+// and subresources
+func newReadyTestKmake(name string, namespace string) *bythepowerofv1.Kmake {
+	kmake := newTestKmake(name, namespace)
+	kmake.UID = types.UID(name + "-uid")
+	kmake.Finalizers = []string{bythepowerofv1.KmakeFinalizerName}
+	kmake.Status.Resources = map[string]string{
+		bythepowerofv1.PVC.String():      name + "-pvc",
+		bythepowerofv1.EnvMap.String():   name + "-env",
+		bythepowerofv1.KmakeMap.String(): name + "-kmake",
+	}
+	return kmake
+}
+
+// newFakeClient is a fake API server holding the objects, with the status
+// subresources of our kinds, and its scheme
+func newFakeClient(objects ...client.Object) (client.Client, *runtime.Scheme) {
+	testScheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+	Expect(bythepowerofv1.AddToScheme(testScheme)).To(Succeed())
+
+	return fake.NewClientBuilder().WithScheme(testScheme).WithObjects(objects...).
+		WithStatusSubresource(
+			&bythepowerofv1.Kmake{},
+			&bythepowerofv1.KmakeRun{},
+			&bythepowerofv1.KmakeScheduleRun{},
+			&bythepowerofv1.KmakeNowScheduler{},
+			&bythepowerofv1.KmakeTriggerScheduler{},
+		).Build(), testScheme
+}
+
+// newFakeScheduleRunReconciler is a schedule run reconciler over a fake API
+// server holding the objects, and that server's client
+func newFakeScheduleRunReconciler(objects ...client.Object) (*KmakeScheduleRunReconciler, client.Client) {
+	for _, o := range objects {
+		if kmsr, ok := o.(*bythepowerofv1.KmakeScheduleRun); ok && kmsr.Finalizers == nil {
+			kmsr.Finalizers = []string{bythepowerofv1.KmakeScheduleRunFinalizerName}
+		}
+	}
+
+	c, testScheme := newFakeClient(objects...)
+	return &KmakeScheduleRunReconciler{
+		Client:   c,
+		Recorder: record.NewFakeRecorder(1000),
+		Scheme:   testScheme,
+	}, c
+}
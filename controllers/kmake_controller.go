@@ -20,74 +20,65 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
-	"time"
 
-	"github.com/go-logr/logr"
 	"gopkg.in/yaml.v2"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+	"github.com/bythepowerof/kmake-controller/controllerconfig"
+	"github.com/bythepowerof/kmake-controller/internal/reconciler"
+	"github.com/bythepowerof/kmake-controller/scope"
 )
 
 // KmakeReconciler reconciles a Kmake object
 type KmakeReconciler struct {
 	client.Client
-	Log      logr.Logger
 	Recorder record.EventRecorder
 	Scheme   *runtime.Scheme
+	Scope    *scope.Scope
+	Config   *controllerconfig.Store
 }
 
-func (r *KmakeReconciler) Event(instance *bythepowerofv1.Kmake, phase bythepowerofv1.Phase, subresource bythepowerofv1.SubResource, name string) error {
-	m := ""
-	if name != "" {
-		m = fmt.Sprintf("%v %v (%v)", phase.String(), subresource.String(), name)
-	} else {
-		m = fmt.Sprintf("%v %v", phase.String(), subresource.String())
+// kind is how we handle kmakes
+func (r *KmakeReconciler) kind() *reconciler.Kind[*bythepowerofv1.Kmake] {
+	return &reconciler.Kind[*bythepowerofv1.Kmake]{
+		Client:    r.Client,
+		Recorder:  r.Recorder,
+		Scheme:    r.Scheme,
+		Finalizer: bythepowerofv1.KmakeFinalizerName,
+		Cleanup:   r.cleanup,
 	}
-	r.Recorder.Event(instance, "Normal", phase.String()+subresource.String(), m)
-
-	log := r.Log.WithValues("kmake", instance.GetName())
-	log.Info(m)
-
-	if instance.Status.Status != m {
-		instance.Status.Status = m
-
-		log.Info(name)
-
-		instance.Status.UpdateSubResource(subresource, name)
-		r.Status().Update(context.Background(), instance)
+}
 
-		var err error
-		instance.Annotations, err = bythepowerofv1.SetDomainAnnotation(instance.Annotations, instance.Status.Resources)
-		if err != nil {
-			return err
-		}
-		return r.Update(context.Background(), instance)
-	}
-	return nil
+func (r *KmakeReconciler) Event(ctx context.Context, instance *bythepowerofv1.Kmake, phase bythepowerofv1.Phase, subresource bythepowerofv1.SubResource, name string) error {
+	return r.kind().Event(ctx, instance, phase, subresource, name)
 }
 
 // +kubebuilder:rbac:groups=bythepowerof.github.com,resources=kmakes,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=bythepowerof.github.com,resources=kmakes/status,verbs=get;update;patch
 
-func (r *KmakeReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	ctx := context.Background()
-	log := r.Log.WithValues("kmake", req.NamespacedName)
+func (r *KmakeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	log := logf.FromContext(ctx)
 
 	requeue := ctrl.Result{Requeue: true}
-	backoff5 := ctrl.Result{RequeueAfter: time.Until(time.Now().Add(1 * time.Minute))}
 
 	// your logic here
 	instance := &bythepowerofv1.Kmake{}
-	err := r.Get(ctx, req.NamespacedName, instance)
+	err = r.Get(ctx, req.NamespacedName, instance)
 
 	log.Info(fmt.Sprintf("Starting reconcile loop for %v", req.NamespacedName))
 	defer log.Info(fmt.Sprintf("Finish reconcile loop for %v", req.NamespacedName))
@@ -96,76 +87,71 @@ func (r *KmakeReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		if errors.IsNotFound(err) {
 			return reconcile.Result{}, nil
 		}
-		r.Event(instance, bythepowerofv1.Get, bythepowerofv1.Main, fmt.Sprintf("get error: %s", err.Error()))
+		r.Event(ctx, instance, bythepowerofv1.Get, bythepowerofv1.Main, fmt.Sprintf("get error: %s", err.Error()))
 		return reconcile.Result{}, err
 	}
 
-	if instance.IsBeingDeleted() {
-		err = r.handleFinalizer(instance)
-		if err != nil {
-			r.Event(instance, bythepowerofv1.Delete, bythepowerofv1.Main, fmt.Sprintf("finlizer: %s", err.Error()))
-			return reconcile.Result{}, fmt.Errorf("error when handling finalizer: %v", err)
-		}
-		err = r.Event(instance, bythepowerofv1.Delete, bythepowerofv1.Main, "")
-		if err != nil {
-			return reconcile.Result{}, err
-		}
-		return ctrl.Result{}, nil
-	}
-
-	if !instance.HasFinalizer(bythepowerofv1.KmakeFinalizerName) {
-		err = r.addFinalizer(instance)
-		if err != nil {
-			r.Event(instance, bythepowerofv1.Error, bythepowerofv1.Main, "finalizer")
-			return reconcile.Result{}, fmt.Errorf("error when handling kmake finalizer: %v", err)
-		}
-		r.Event(instance, bythepowerofv1.Provision, bythepowerofv1.Main, "finalizer")
-		return ctrl.Result{}, nil
-	}
-
-	// env configmap
+	ctx, span := startSpan(ctx, "Kmake.Reconcile", instance)
+	defer func() { endSpan(span, err) }()
+	log = logf.FromContext(ctx)
 
-	currentenvmap := &corev1.ConfigMap{}
-	requiredenvmap := &corev1.ConfigMap{
-		ObjectMeta: ObjectMetaConcat(instance, req.NamespacedName, bythepowerofv1.EnvMap),
-		Data:       instance.Spec.Variables,
+	done, err := r.kind().Finalize(ctx, instance)
+	if done {
+		return reconcile.Result{}, err
 	}
 
-	ctrl.SetControllerReference(instance, requiredenvmap, r.Scheme)
+	// lint the rules and the targets of our runs
 
-	log.Info(fmt.Sprintf("Checking env map %v", instance.Status.GetSubReference(bythepowerofv1.EnvMap)))
+	findings := instance.Spec.Lint()
 
-	err = r.Get(ctx, instance.Status.NamespacedNameConcat(bythepowerofv1.EnvMap, instance.GetNamespace()), currentenvmap)
+	runs, err := listKmakeRuns(ctx, r, instance)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			log.Info(fmt.Sprintf("Not found env map %v", instance.Status.GetSubReference(bythepowerofv1.EnvMap)))
-
-			// create it
-			err = r.Create(ctx, requiredenvmap)
-			if err != nil {
-				return reconcile.Result{}, err
+		return reconcile.Result{}, err
+	}
+	for _, run := range runs {
+		if run.Spec.KmakeRunOperation.Job != nil {
+			name := run.GetName()
+			if run.IsCrossNamespace() {
+				name = run.GetNamespace() + "/" + name
 			}
-			err = r.Event(instance, bythepowerofv1.Provision, bythepowerofv1.EnvMap, requiredenvmap.ObjectMeta.Name)
-			if err != nil {
-				return reconcile.Result{}, err
+			for _, f := range instance.Spec.LintTargets(run.Spec.KmakeRunOperation.Job.Targets) {
+				f.Name = fmt.Sprintf("%v/%v", name, f.Name)
+				findings = append(findings, f)
 			}
-			return requeue, err
-
 		}
-		return reconcile.Result{}, err
 	}
-	if !(equality.Semantic.DeepEqual(currentenvmap.Data, requiredenvmap.Data) &&
-		equality.Semantic.DeepEqual(currentenvmap.ObjectMeta.Labels, requiredenvmap.ObjectMeta.Labels)) {
-		log.Info(fmt.Sprintf("delete env map %v", instance.Status.GetSubReference(bythepowerofv1.EnvMap)))
-		err = r.Delete(ctx, currentenvmap)
-		if err != nil {
-			return reconcile.Result{}, err
+	warnings := findings.Strings()
+
+	if !equality.Semantic.DeepEqual(instance.Status.Warnings, warnings) {
+		log.Info(fmt.Sprintf("Lint found %d problems", len(warnings)))
+		instance.Status.Warnings = warnings
+		if len(warnings) == 0 {
+			instance.Status.Warnings = nil
 		}
-		err = r.Event(instance, bythepowerofv1.Delete, bythepowerofv1.EnvMap, "")
+		err = r.Status().Update(ctx, instance)
 		if err != nil {
 			return reconcile.Result{}, err
 		}
-		return requeue, nil
+	}
+
+	// env configmap
+
+	envmap := &corev1.ConfigMap{}
+	envmeta := ObjectMetaConcat(instance, req.NamespacedName, bythepowerofv1.EnvMap,
+		instance.Spec.Variables, instance.GetLabels())
+
+	log.Info(fmt.Sprintf("Checking env map %v", envmeta.Name))
+
+	outcome, err := reconciler.Ensure(ctx, r.kind(), instance, bythepowerofv1.EnvMap, envmap, envmeta, func(cm *corev1.ConfigMap) error {
+		cm.Data = instance.Spec.Variables
+		return ctrl.SetControllerReference(instance, cm, r.Scheme)
+	})
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if outcome != reconciler.Unchanged {
+		err = r.Event(ctx, instance, outcome.Phase(), bythepowerofv1.EnvMap, envmeta.Name)
+		return requeue, err
 	}
 
 	// make yaml config map
@@ -174,147 +160,136 @@ func (r *KmakeReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	y, err := yaml.Marshal(map[string][]bythepowerofv1.KmakeRule{"rules": instance.Spec.Rules})
 	m, err := instance.Spec.ToMakefile()
 
-	currentkmakemap := &corev1.ConfigMap{}
-	requiredkmakemap := &corev1.ConfigMap{
-		ObjectMeta: ObjectMetaConcat(instance, req.NamespacedName, bythepowerofv1.KmakeMap),
-		Data: map[string]string{
-			"kmake.yaml": string(y),
-			"kmake.mk":   m,
-			"kmake.json": string(j)},
-	}
+	kmakedata := map[string]string{
+		"kmake.yaml": string(y),
+		"kmake.mk":   m,
+		"kmake.json": string(j)}
 
-	ctrl.SetControllerReference(instance, requiredkmakemap, r.Scheme)
+	kmakemap := &corev1.ConfigMap{}
+	kmakemeta := ObjectMetaConcat(instance, req.NamespacedName, bythepowerofv1.KmakeMap,
+		kmakedata, instance.GetLabels())
 
-	log.Info(fmt.Sprintf("Checking kmake map %v", instance.Status.GetSubReference(bythepowerofv1.KmakeMap)))
+	log.Info(fmt.Sprintf("Checking kmake map %v", kmakemeta.Name))
 
-	err = r.Get(ctx, instance.Status.NamespacedNameConcat(bythepowerofv1.KmakeMap, instance.GetNamespace()), currentkmakemap)
+	outcome, err = reconciler.Ensure(ctx, r.kind(), instance, bythepowerofv1.KmakeMap, kmakemap, kmakemeta, func(cm *corev1.ConfigMap) error {
+		cm.Data = kmakedata
+		return ctrl.SetControllerReference(instance, cm, r.Scheme)
+	})
 	if err != nil {
-		if errors.IsNotFound(err) {
-			log.Info(fmt.Sprintf("Not found kmake map %v", instance.Status.GetSubReference(bythepowerofv1.KmakeMap)))
-
-			// create it
-			err = r.Create(ctx, requiredkmakemap)
-			if err != nil {
-				return reconcile.Result{}, err
-			}
-			err = r.Event(instance, bythepowerofv1.Provision, bythepowerofv1.KmakeMap, requiredkmakemap.ObjectMeta.Name)
-			if err != nil {
-				return reconcile.Result{}, err
-			}
-			return requeue, err
-		}
 		return reconcile.Result{}, err
 	}
-	if !(equality.Semantic.DeepEqual(currentkmakemap.Data, requiredkmakemap.Data) &&
-		equality.Semantic.DeepEqual(currentkmakemap.ObjectMeta.Labels, requiredkmakemap.ObjectMeta.Labels)) {
-		log.Info(fmt.Sprintf("delete kmake map %v", instance.Status.GetSubReference(bythepowerofv1.KmakeMap)))
-		err = r.Delete(ctx, currentkmakemap)
-		if err != nil {
-			return reconcile.Result{}, err
-		}
-		err = r.Event(instance, bythepowerofv1.Delete, bythepowerofv1.KmakeMap, "")
-		if err != nil {
-			return reconcile.Result{}, err
-		}
-		return requeue, nil
+	if outcome != reconciler.Unchanged {
+		err = r.Event(ctx, instance, outcome.Phase(), bythepowerofv1.KmakeMap, kmakemeta.Name)
+		return requeue, err
 	}
 
 	// PVC
-	currentpvc := &corev1.PersistentVolumeClaim{}
-	requiredpvc := &corev1.PersistentVolumeClaim{
-		ObjectMeta: ObjectMetaConcat(instance, req.NamespacedName, bythepowerofv1.PVC),
-		Spec:       instance.Spec.PersistentVolumeClaimTemplate,
-	}
-
-	ctrl.SetControllerReference(instance, requiredpvc, r.Scheme)
-
-	log.Info(fmt.Sprintf("Checking pvc %v", instance.Status.GetSubReference(bythepowerofv1.PVC)))
-
-	err = r.Get(ctx, instance.Status.NamespacedNameConcat(bythepowerofv1.PVC, instance.GetNamespace()), currentpvc)
-	if err != nil {
-		if errors.IsNotFound(err) {
-			log.Info(fmt.Sprintf("Not found pvc %v", instance.Status.GetSubReference(bythepowerofv1.PVC)))
 
-			// create it
-			err = r.Create(ctx, requiredpvc)
-			if err != nil {
-				return reconcile.Result{}, err
-			}
-			log.Info(fmt.Sprintf("Created pvc %v", requiredpvc.ObjectMeta.Name))
+	currentpvc := &corev1.PersistentVolumeClaim{}
+	pvcmeta := ObjectMetaConcat(instance, req.NamespacedName, bythepowerofv1.PVC,
+		instance.Spec.PersistentVolumeClaimTemplate.Resources, instance.GetLabels())
 
-			err = r.Event(instance, bythepowerofv1.Provision, bythepowerofv1.PVC, requiredpvc.ObjectMeta.Name)
-			if err != nil {
-				return reconcile.Result{}, err
-			}
-			return requeue, err
+	log.Info(fmt.Sprintf("Checking pvc %v", pvcmeta.Name))
 
+	outcome, err = reconciler.Ensure(ctx, r.kind(), instance, bythepowerofv1.PVC, currentpvc, pvcmeta, func(pvc *corev1.PersistentVolumeClaim) error {
+		// a claim's spec is fixed once it's made, new resources get a new claim
+		if pvc.GetResourceVersion() == "" {
+			pvc.Spec = instance.Spec.PersistentVolumeClaimTemplate
 		}
+		return ctrl.SetControllerReference(instance, pvc, r.Scheme)
+	})
+	if err != nil {
 		return reconcile.Result{}, err
 	}
-	if !(equality.Semantic.DeepEqual(currentpvc.Spec.Resources, requiredpvc.Spec.Resources) &&
-		equality.Semantic.DeepEqual(currentpvc.ObjectMeta.Labels, requiredpvc.ObjectMeta.Labels)) {
-		log.Info(fmt.Sprintf("delete/recreate pvc %v", instance.Status.GetSubReference(bythepowerofv1.PVC)))
-
-		err = r.Delete(ctx, currentpvc)
-		if err != nil {
-			return reconcile.Result{}, err
-		}
-		err = r.Event(instance, bythepowerofv1.Delete, bythepowerofv1.PVC, "")
-		if err != nil {
-			return reconcile.Result{}, err
-		}
-		return requeue, nil
+	if outcome != reconciler.Unchanged {
+		err = r.Event(ctx, instance, outcome.Phase(), bythepowerofv1.PVC, pvcmeta.Name)
+		return requeue, err
 	}
 
 	if currentpvc.Status.Phase != corev1.ClaimBound {
-		err = r.Event(instance, bythepowerofv1.BackOff, bythepowerofv1.PVC, currentpvc.ObjectMeta.Name)
+		// we own the pvc so binding it will requeue us
+		err = r.Event(ctx, instance, bythepowerofv1.BackOff, bythepowerofv1.PVC, currentpvc.ObjectMeta.Name)
 		if err != nil {
 			return reconcile.Result{}, err
 		}
-		return backoff5, nil
+		return ctrl.Result{}, nil
 	}
 
 	if strings.Contains(instance.Status.Status, "BackOff PV") {
 		// so we need to rerun the master job to copy the files and makefile again
-		err = r.Event(instance, bythepowerofv1.Provision, bythepowerofv1.PVC, currentpvc.ObjectMeta.Name)
+		err = r.Event(ctx, instance, bythepowerofv1.Provision, bythepowerofv1.PVC, currentpvc.ObjectMeta.Name)
 		if err != nil {
 			return reconcile.Result{}, err
 		}
 	}
 
 	// return requeue, nil
-	err = r.Event(instance, bythepowerofv1.Ready, bythepowerofv1.Main, "")
+	err = r.Event(ctx, instance, bythepowerofv1.Ready, bythepowerofv1.Main, "")
 
 	return ctrl.Result{}, nil
 }
 
-func (r *KmakeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+// runOwnerKey indexes kmake runs by their controlling kmake
+const runOwnerKey = ".metadata.controller"
 
-	runOwnerKey := ".metadata.controller"
-	apiGVStr := bythepowerofv1.GroupVersion.String()
+// runOwnerIndex is the name of the kmake controlling a run
+func runOwnerIndex(rawObj client.Object) []string {
+	// grab the run object, extract the owner...
+	run := rawObj.(*bythepowerofv1.KmakeRun)
+	owner := metav1.GetControllerOf(run)
+	if owner == nil {
+		return nil
+	}
+	// ...make sure it's a Kmake...
+	if owner.APIVersion != bythepowerofv1.GroupVersion.String() || owner.Kind != "Kmake" {
+		return nil
+	}
 
-	if err := mgr.GetFieldIndexer().IndexField(&bythepowerofv1.KmakeRun{}, runOwnerKey, func(rawObj runtime.Object) []string {
-		// grab the run object, extract the owner...
-		run := rawObj.(*bythepowerofv1.KmakeRun)
-		owner := metav1.GetControllerOf(run)
-		if owner == nil {
-			return nil
-		}
-		// ...make sure it's a Kmake...
-		if owner.APIVersion != apiGVStr || owner.Kind != "Kmake" {
-			return nil
-		}
+	// ...and if so, return it
+	return []string{owner.Name}
+}
 
-		// ...and if so, return it
-		return []string{owner.Name}
-	}); err != nil {
+func (r *KmakeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &bythepowerofv1.KmakeRun{}, runOwnerKey, runOwnerIndex); err != nil {
 		return err
 	}
 
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&bythepowerofv1.Kmake{}).
-		Owns(&bythepowerofv1.KmakeRun{}).
+		// relint when a run of ours comes, goes or changes its targets
+		Watches(&bythepowerofv1.KmakeRun{},
+			handler.EnqueueRequestsFromMapFunc(runKmake),
+			builder.WithPredicates(predicate.Funcs{
+				UpdateFunc: func(e event.UpdateEvent) bool {
+					old, ok := e.ObjectOld.(*bythepowerofv1.KmakeRun)
+					if !ok {
+						return false
+					}
+					new, ok := e.ObjectNew.(*bythepowerofv1.KmakeRun)
+					if !ok {
+						return false
+					}
+					return old.GetKmakeNamespace() != new.GetKmakeNamespace() ||
+						old.GetKmakeName() != new.GetKmakeName() ||
+						!equality.Semantic.DeepEqual(old.Spec.KmakeRunOperation.Job, new.Spec.KmakeRunOperation.Job)
+				},
+			})).
 		Owns(&corev1.PersistentVolumeClaim{}).
 		Owns(&corev1.ConfigMap{}).
+		WithEventFilter(r.Scope.Predicate(mgr.GetClient())).
+		WithOptions(r.Config.Get().Controller("Kmake")).
 		Complete(r)
 }
+
+// runKmake maps a run to the kmake it refers to, in its namespace or another
+func runKmake(ctx context.Context, o client.Object) []reconcile.Request {
+	run, ok := o.(*bythepowerofv1.KmakeRun)
+	if !ok || run.GetKmakeName() == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{
+		Namespace: run.GetKmakeNamespace(),
+		Name:      run.GetKmakeName(),
+	}}}
+}
@@ -18,49 +18,17 @@ package controllers
 
 import (
 	"context"
-	"fmt"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
 )
 
-func (r *KmakeReconciler) addFinalizer(instance *bythepowerofv1.Kmake) error {
-	instance.AddFinalizer(bythepowerofv1.KmakeFinalizerName)
-	err := r.Update(context.Background(), instance)
-	if err != nil {
-		return fmt.Errorf("failed to update kmake finalizer: %v", err)
-	}
-	return nil
-}
-
-func (r *KmakeReconciler) handleFinalizer(instance *bythepowerofv1.Kmake) error {
-	if instance.HasFinalizer(bythepowerofv1.KmakeFinalizerName) {
-		// // remove all kmake runs owned by us
-		del := &bythepowerofv1.KmakeRun{}
-
-		do := &client.DeleteAllOfOptions{}
-		do.ApplyOptions([]client.DeleteAllOfOption{
-			client.InNamespace(instance.Namespace)})
-		labels := client.MatchingLabels{}
-		labels = bythepowerofv1.SetDomainLabel(labels, bythepowerofv1.KmakeLabel, instance.Name)
-
-		do.ApplyOptions([]client.DeleteAllOfOption{labels})
-
-		policy := metav1.DeletePropagationBackground
-		o := &client.DeleteAllOfOptions{DeleteOptions: client.DeleteOptions{PropagationPolicy: &policy}}
-
-		do.ApplyToDeleteAllOf(o)
-
-		if err := r.DeleteAllOf(context.Background(), del, do); err != nil {
-			return err
-		}
-		instance.RemoveFinalizer(bythepowerofv1.KmakeFinalizerName)
-		if err := r.Update(context.Background(), instance); err != nil {
-			return err
-		}
-
-	}
-	// Our finalizer has finished, so the reconciler can do nothing.
-	return nil
+// cleanup deletes the kmake runs labelled with the kmake
+func (r *KmakeReconciler) cleanup(ctx context.Context, instance *bythepowerofv1.Kmake) error {
+	return r.DeleteAllOf(ctx, &bythepowerofv1.KmakeRun{},
+		client.InNamespace(instance.Namespace),
+		client.MatchingLabels(bythepowerofv1.SetDomainLabel(nil, bythepowerofv1.KmakeLabel, instance.Name)),
+		client.PropagationPolicy(metav1.DeletePropagationBackground))
 }
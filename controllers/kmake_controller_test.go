@@ -13,7 +13,13 @@ import (
 	// storage "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 var _ = Describe("Controllers/KmakeController", func() {
@@ -125,7 +131,7 @@ var _ = Describe("Controllers/KmakeController", func() {
 				Spec: bythepowerofv1.KmakeSpec{
 					PersistentVolumeClaimTemplate: corev1.PersistentVolumeClaimSpec{
 						AccessModes: []corev1.PersistentVolumeAccessMode{"ReadWriteOnce"},
-						Resources: corev1.ResourceRequirements{
+						Resources: corev1.VolumeResourceRequirements{
 							Requests: *cap,
 						},
 						StorageClassName: &storageClass,
@@ -223,4 +229,57 @@ var _ = Describe("Controllers/KmakeController", func() {
 			pvcNotExists()
 		})
 	})
+
+	Context("Run warnings", func() {
+		It("Should relint when runs in any namespace come and go", func() {
+			testScheme := runtime.NewScheme()
+			Expect(clientgoscheme.AddToScheme(testScheme)).To(Succeed())
+			Expect(bythepowerofv1.AddToScheme(testScheme)).To(Succeed())
+
+			kmake := newTestKmake("lint", namespace)
+			kmake.Finalizers = []string{bythepowerofv1.KmakeFinalizerName}
+
+			local := newTestKmakeRun("local", namespace, "lint")
+			local.Spec.KmakeRunOperation.Job.Targets = []string{"Rule1", "Rule2"}
+
+			remote := newTestKmakeRun("remote", "tenant", "")
+			remote.Labels = nil
+			remote.Spec.KmakeRef = &bythepowerofv1.KmakeReference{Name: "lint", Namespace: namespace}
+			remote.Spec.KmakeRunOperation.Job.Targets = []string{"Rule3"}
+
+			c := fake.NewClientBuilder().WithScheme(testScheme).
+				WithObjects(kmake, local, remote).
+				WithStatusSubresource(&bythepowerofv1.Kmake{}).
+				WithIndex(&bythepowerofv1.KmakeRun{}, runOwnerKey, runOwnerIndex).
+				WithIndex(&bythepowerofv1.KmakeRun{}, runKmakeRefKey, runKmakeRefIndex).
+				Build()
+			r := &KmakeReconciler{
+				Client:   c,
+				Recorder: record.NewFakeRecorder(100),
+				Scheme:   testScheme,
+			}
+			key := types.NamespacedName{Namespace: namespace, Name: "lint"}
+			warnings := func() []string {
+				f := &bythepowerofv1.Kmake{}
+				Expect(c.Get(context.Background(), key, f)).To(Succeed())
+				return f.Status.Warnings
+			}
+
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(warnings()).To(ConsistOf(
+				"Error UndefinedTarget (local/Rule2): no rule to make target",
+				"Error UndefinedTarget (tenant/remote/Rule3): no rule to make target",
+			))
+
+			By("mapping the run in another namespace to its kmake")
+			Expect(runKmake(context.Background(), remote)).To(Equal([]reconcile.Request{{NamespacedName: key}}))
+
+			By("dropping the warnings of a deleted run")
+			Expect(c.Delete(context.Background(), remote)).To(Succeed())
+			_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(warnings()).To(Equal([]string{"Error UndefinedTarget (local/Rule2): no rule to make target"}))
+		})
+	})
 })
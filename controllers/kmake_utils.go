@@ -16,7 +16,10 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"strings"
@@ -25,17 +28,91 @@ import (
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
 
-func ObjectMetaConcat(owner metav1.Object, namespacedName types.NamespacedName, suffix bythepowerofv1.SubResource) metav1.ObjectMeta {
+// ObjectMetaConcat makes the metadata for a child of owner. The name is
+// deterministic so creating the child again, say after a crash before the
+// owner's status was updated, finds the first one instead of a duplicate.
+// Pass whatever the child's content depends on as discriminators so a child
+// recreated with new content gets a new name
+func ObjectMetaConcat(owner metav1.Object, namespacedName types.NamespacedName, suffix bythepowerofv1.SubResource, discriminators ...interface{}) metav1.ObjectMeta {
+
+	// copy the labels so setting them on the child leaves the owner alone
+	labels := make(map[string]string)
+	for k, v := range owner.GetLabels() {
+		labels[k] = v
+	}
 
 	// isController := true
 	return metav1.ObjectMeta{
-		Namespace:    namespacedName.Namespace,
-		GenerateName: namespacedName.Name + "-" + strings.ToLower(suffix.String()) + "-",
-		Labels:       owner.GetLabels(),
+		Namespace: namespacedName.Namespace,
+		Name:      ChildName(owner, namespacedName.Name, suffix, discriminators...),
+		Labels:    labels,
+	}
+}
+
+// ScheduleRunLabels are the domain labels of a schedule run over the other
+// labels of its scheduler, so it's watched with the scheduler when sharding
+func ScheduleRunLabels(scheduler metav1.Object, domain map[string]string) map[string]string {
+	labels := make(map[string]string)
+	for k, v := range scheduler.GetLabels() {
+		if !bythepowerofv1.IsDomainLabel(k) {
+			labels[k] = v
+		}
+	}
+	for k, v := range domain {
+		labels[k] = v
+	}
+	return labels
+}
+
+// scheduleRunsOf lists the schedule runs a scheduler controls. They're
+// labelled with its name, but a scheduler of another kind can share that
+func scheduleRunsOf(ctx context.Context, c client.Reader, scheduler metav1.Object) ([]bythepowerofv1.KmakeScheduleRun, error) {
+	kmsrs := &bythepowerofv1.KmakeScheduleRunList{}
+	err := c.List(ctx, kmsrs,
+		client.InNamespace(scheduler.GetNamespace()),
+		client.MatchingLabels{
+			bythepowerofv1.MakeDomainString(bythepowerofv1.ScheduleInstLabel): scheduler.GetName(),
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]bythepowerofv1.KmakeScheduleRun, 0, len(kmsrs.Items))
+	for _, kmsr := range kmsrs.Items {
+		if metav1.IsControlledBy(&kmsr, scheduler) {
+			ret = append(ret, kmsr)
+		}
+	}
+	return ret, nil
+}
+
+// maxChildNameLength keeps child names usable as label values, as jobs need
+const maxChildNameLength = 63
+
+// ChildName is name-subresource-hash where the hash covers the owner's UID,
+// the subresource and the discriminators
+func ChildName(owner metav1.Object, name string, suffix bythepowerofv1.SubResource, discriminators ...interface{}) string {
+	h := fnv.New32a()
+	h.Write([]byte(owner.GetUID()))
+	h.Write([]byte(suffix.String()))
+	for _, d := range discriminators {
+		b, err := json.Marshal(d)
+		if err != nil {
+			b = []byte(fmt.Sprintf("%v", d))
+		}
+		h.Write(b)
+	}
+	hash := fmt.Sprintf("%08x", h.Sum32())
+
+	prefix := name + "-" + strings.ToLower(suffix.String())
+	if len(prefix)+len(hash)+1 > maxChildNameLength {
+		prefix = strings.TrimRight(prefix[:maxChildNameLength-len(hash)-1], "-.")
 	}
+	return prefix + "-" + hash
 }
 
 // SetOwnerReference sets owner as a OwnerReference on owned.
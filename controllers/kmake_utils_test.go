@@ -0,0 +1,95 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Controllers/Utils", func() {
+	Context("Child names", func() {
+		owner := &bythepowerofv1.KmakeScheduleRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: "default",
+				UID:       types.UID("1234"),
+				Labels:    map[string]string{"bythepowerof.github.io/kmake": "kmake"},
+			},
+		}
+		name := types.NamespacedName{Name: "foo", Namespace: "default"}
+
+		It("Should be the same every time", func() {
+			meta := ObjectMetaConcat(owner, name, bythepowerofv1.Job)
+			Expect(meta.Name).To(MatchRegexp("^foo-job-[0-9a-f]{8}$"))
+			Expect(meta.GenerateName).To(BeEmpty())
+			Expect(ObjectMetaConcat(owner, name, bythepowerofv1.Job).Name).To(Equal(meta.Name))
+			Expect(ObjectMetaConcat(owner, name, bythepowerofv1.Owner).Name).ToNot(Equal(meta.Name))
+		})
+
+		It("Should change with the owner and discriminators", func() {
+			data := map[string]string{"VAR1": "Value1"}
+			meta := ObjectMetaConcat(owner, name, bythepowerofv1.EnvMap, data)
+			Expect(ObjectMetaConcat(owner, name, bythepowerofv1.EnvMap, map[string]string{"VAR1": "Value1"}).Name).To(Equal(meta.Name))
+			Expect(ObjectMetaConcat(owner, name, bythepowerofv1.EnvMap, map[string]string{"VAR1": "Value2"}).Name).ToNot(Equal(meta.Name))
+
+			other := owner.DeepCopy()
+			other.UID = types.UID("5678")
+			Expect(ObjectMetaConcat(other, name, bythepowerofv1.EnvMap, data).Name).ToNot(Equal(meta.Name))
+		})
+
+		It("Should leave the owner labels alone", func() {
+			meta := ObjectMetaConcat(owner, name, bythepowerofv1.Job)
+			meta.Labels["extra"] = "yes"
+			Expect(owner.Labels).ToNot(HaveKey("extra"))
+		})
+
+		It("Should fit in a label value", func() {
+			long := types.NamespacedName{Name: strings.Repeat("a", 70), Namespace: "default"}
+			Expect(len(ObjectMetaConcat(owner, long, bythepowerofv1.Job).Name)).To(Equal(63))
+		})
+	})
+
+	Context("Schedule run labels", func() {
+		It("Should keep the scheduler's own labels under ours", func() {
+			scheduler := &bythepowerofv1.KmakeNowScheduler{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "default",
+					Labels: map[string]string{
+						"shard":                            "1",
+						"bythepowerof.github.io/scheduler": "nightly",
+						"bythepowerof.github.io/run":       "other",
+					},
+				},
+			}
+			labels := ScheduleRunLabels(scheduler, map[string]string{
+				"bythepowerof.github.io/run": "build",
+			})
+			Expect(labels).To(Equal(map[string]string{
+				"shard":                      "1",
+				"bythepowerof.github.io/run": "build",
+			}))
+			Expect(scheduler.Labels).To(HaveLen(3))
+		})
+	})
+})
@@ -18,9 +18,9 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
-	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -29,63 +29,51 @@ import (
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+	"github.com/bythepowerof/kmake-controller/controllerconfig"
+	"github.com/bythepowerof/kmake-controller/internal/reconciler"
+	"github.com/bythepowerof/kmake-controller/scope"
 )
 
 // KmakeNowSchedulerReconciler reconciles a KmakeNowScheduler object
 type KmakeNowSchedulerReconciler struct {
 	client.Client
-	Log      logr.Logger
 	Recorder record.EventRecorder
 	Scheme   *runtime.Scheme
+	Scope    *scope.Scope
+	Config   *controllerconfig.Store
 }
 
-func (r *KmakeNowSchedulerReconciler) Event(instance *bythepowerofv1.KmakeNowScheduler, phase bythepowerofv1.Phase, subresource bythepowerofv1.SubResource, name string) error {
-	m := ""
-	if name != "" {
-		m = fmt.Sprintf("%v %v (%v)", phase.String(), subresource.String(), name)
-	} else {
-		m = fmt.Sprintf("%v %v", phase.String(), subresource.String())
+// kind is how we handle now schedulers
+func (r *KmakeNowSchedulerReconciler) kind() *reconciler.Kind[*bythepowerofv1.KmakeNowScheduler] {
+	return &reconciler.Kind[*bythepowerofv1.KmakeNowScheduler]{
+		Client:    r.Client,
+		Recorder:  r.Recorder,
+		Scheme:    r.Scheme,
+		Finalizer: bythepowerofv1.KmakeNowSchedulerFinalizerName,
+		Cleanup:   cleanupScheduleRuns[*bythepowerofv1.KmakeNowScheduler](r.Client),
 	}
-	r.Recorder.Event(instance, "Normal", phase.String()+subresource.String(), m)
-
-	log := r.Log.WithValues("kmake", instance.GetName())
-	log.Info(m)
-
-	if instance.Status.Status != m {
-		instance.Status.Status = m
-
-		log.Info(name)
-
-		instance.Status.UpdateSubResource(subresource, name)
-		r.Status().Update(context.Background(), instance)
+}
 
-		var err error
-		instance.Annotations, err = bythepowerofv1.SetDomainAnnotation(instance.Annotations, instance.Status.Resources)
-		if err != nil {
-			return err
-		}
-		return r.Update(context.Background(), instance)
-	}
-	return nil
+func (r *KmakeNowSchedulerReconciler) Event(ctx context.Context, instance *bythepowerofv1.KmakeNowScheduler, phase bythepowerofv1.Phase, subresource bythepowerofv1.SubResource, name string) error {
+	return r.kind().Event(ctx, instance, phase, subresource, name)
 }
 
 // +kubebuilder:rbac:groups=bythepowerof.github.com,resources=kmakenowschedulers,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=bythepowerof.github.com,resources=kmakenowschedulers/status,verbs=get;update;patch
 
-func (r *KmakeNowSchedulerReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+func (r *KmakeNowSchedulerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
 
-	ctx := context.Background()
-	log := r.Log.WithValues("kmakenowscheduler", req.NamespacedName)
+	log := logf.FromContext(ctx)
 	requeue := ctrl.Result{Requeue: true}
-	backoff5 := ctrl.Result{RequeueAfter: time.Until(time.Now().Add(1 * time.Minute))}
-	// backoff5 := ctrl.Result{RequeueAfter: time.Until(time.Now().Add(10 * time.Second))}
+	backoff5 := ctrl.Result{RequeueAfter: r.Config.Get().Requeue.Scheduler.Duration}
 
 	// your logic here
 	instance := &bythepowerofv1.KmakeNowScheduler{}
-	err := r.Get(ctx, req.NamespacedName, instance)
+	err = r.Get(ctx, req.NamespacedName, instance)
 
 	log.Info(fmt.Sprintf("Starting reconcile loop for %v", req.NamespacedName))
 	defer log.Info(fmt.Sprintf("Finish reconcile loop for %v", req.NamespacedName))
@@ -97,95 +85,76 @@ func (r *KmakeNowSchedulerReconciler) Reconcile(req ctrl.Request) (ctrl.Result,
 		return reconcile.Result{}, err
 	}
 
-	if instance.IsBeingDeleted() {
-		err = r.handleFinalizer(instance)
-		if err != nil {
-			r.Event(instance, bythepowerofv1.Delete, bythepowerofv1.Main, "finalizer")
-			return reconcile.Result{}, fmt.Errorf("error when handling finalizer: %v", err)
-		}
-		err = r.Event(instance, bythepowerofv1.Delete, bythepowerofv1.Main, "")
-		if err != nil {
-			return reconcile.Result{}, err
-		}
-		return ctrl.Result{}, nil
-	}
+	ctx, span := startSpan(ctx, "KmakeNowScheduler.Reconcile", instance)
+	defer func() { endSpan(span, err) }()
+	log = logf.FromContext(ctx)
 
-	if !instance.HasFinalizer(bythepowerofv1.KmakeNowSchedulerFinalizerName) {
-		err = r.addFinalizer(instance)
-		if err != nil {
-			r.Event(instance, bythepowerofv1.Error, bythepowerofv1.Main, "finalizer")
-			return reconcile.Result{}, fmt.Errorf("error when handling kmakenowscheduler finalizer: %v", err)
-		}
-		r.Event(instance, bythepowerofv1.Provision, bythepowerofv1.Main, "finalizer")
-		return ctrl.Result{}, nil
+	done, err := r.kind().Finalize(ctx, instance)
+	if done {
+		return reconcile.Result{}, err
 	}
 
 	// env configmap
 
-	currentenvmap := &corev1.ConfigMap{}
-	requiredenvmap := &corev1.ConfigMap{
-		ObjectMeta: ObjectMetaConcat(instance, req.NamespacedName, bythepowerofv1.EnvMap),
+	envmap := &corev1.ConfigMap{}
+	envmeta := ObjectMetaConcat(instance, req.NamespacedName, bythepowerofv1.EnvMap,
+		instance.Spec.Variables, instance.GetLabels())
 
-		Data: instance.Spec.Variables,
-	}
-	ctrl.SetControllerReference(instance, requiredenvmap, r.Scheme)
-	log.Info(fmt.Sprintf("Checking env map %v", instance.Status.GetSubReference(bythepowerofv1.EnvMap)))
+	log.Info(fmt.Sprintf("Checking env map %v", envmeta.Name))
 
-	err = r.Get(ctx, instance.Status.NamespacedNameConcat(bythepowerofv1.EnvMap, instance.GetNamespace()), currentenvmap)
+	outcome, err := reconciler.Ensure(ctx, r.kind(), instance, bythepowerofv1.EnvMap, envmap, envmeta, func(cm *corev1.ConfigMap) error {
+		cm.Data = instance.Spec.Variables
+		return ctrl.SetControllerReference(instance, cm, r.Scheme)
+	})
 	if err != nil {
-		if errors.IsNotFound(err) {
-			log.Info(fmt.Sprintf("Not found env map %v", instance.Status.GetSubReference(bythepowerofv1.EnvMap)))
-
-			// create it
-			err = r.Create(ctx, requiredenvmap)
-			if err != nil {
-				return reconcile.Result{}, err
-			}
-
-			err = r.Event(instance, bythepowerofv1.Provision, bythepowerofv1.EnvMap, requiredenvmap.ObjectMeta.Name)
-			if err != nil {
-				return reconcile.Result{}, err
-			}
-			return requeue, err
-
-		}
 		return reconcile.Result{}, err
 	}
-	if !(equality.Semantic.DeepEqual(currentenvmap.Data, requiredenvmap.Data) &&
-		equality.Semantic.DeepEqual(currentenvmap.ObjectMeta.Labels, requiredenvmap.ObjectMeta.Labels)) {
-		log.Info(fmt.Sprintf("delete env map %v", instance.Status.GetSubReference(bythepowerofv1.EnvMap)))
-		err = r.Delete(ctx, currentenvmap)
-		if err != nil {
-			return reconcile.Result{}, err
-		}
-		err = r.Event(instance, bythepowerofv1.Delete, bythepowerofv1.EnvMap, "")
-		if err != nil {
-			return reconcile.Result{}, err
-		}
-		return requeue, nil
+	if outcome != reconciler.Unchanged {
+		err = r.Event(ctx, instance, outcome.Phase(), bythepowerofv1.EnvMap, envmeta.Name)
+		return requeue, err
 	}
 
 	// search for things label bythepowerof.github.io/scheduler
 
 	// look at the scheduleruns just for this instance...
-	runs := &bythepowerofv1.KmakeScheduleRunList{}
-	opts := []client.ListOption{
-		client.InNamespace(req.NamespacedName.Namespace),
-		client.MatchingLabels{
-			bythepowerofv1.MakeDomainString(bythepowerofv1.ScheduleInstLabel): instance.GetName(),
-		},
-	}
-	err = r.List(ctx, runs, opts...)
+	kmsrs, err := scheduleRunsOf(ctx, r, instance)
 	if err != nil {
 		return reconcile.Result{}, err
 	}
 
-	allRuns := make([]string, 0)
+	// tidy up the ended ones past our history limits
+	for _, kmsr := range bythepowerofv1.ExpiredScheduleRuns(kmsrs,
+		instance.Spec.SuccessfulRunsHistoryLimit, instance.Spec.FailedRunsHistoryLimit, time.Now()) {
+		log.Info(fmt.Sprintf("Deleting old schedule run %v", kmsr.GetName()))
+		err = r.Delete(ctx, &kmsr)
+		if ignoreNotFound(err) != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	// keep the history but make no more, resuming changes the spec so
+	// there's no need to look again until then
+	if instance.IsSuspended() {
+		_ = r.Event(ctx, instance, bythepowerofv1.Stop, bythepowerofv1.Main, "suspended")
+		return ctrl.Result{}, nil
+	}
 
-	for _, run := range runs.Items {
-		allRuns = append(allRuns, run.GetKmakeRunName())
+	// the runs we've scheduled, by uid, and by name those with a schedule run
+	// from before we remembered them. The schedule run's name comes from the
+	// run's uid, so making one twice, from a stale cache or another replica,
+	// fails with AlreadyExists
+	scheduled := make(map[string]bool)
+	for _, uid := range instance.Status.Scheduled {
+		scheduled[uid] = true
+	}
+	hasScheduleRun := make(map[string]bool)
+	for _, kmsr := range kmsrs {
+		hasScheduleRun[kmsr.GetKmakeRunName()] = true
 	}
 
+	// what to remember, the runs we still monitor that we've scheduled
+	current := make(map[string]bool)
+
 	// look at the kmakerun items
 	for _, element := range instance.Spec.Monitor {
 		runs := &bythepowerofv1.KmakeRunList{}
@@ -201,62 +170,81 @@ func (r *KmakeNowSchedulerReconciler) Reconcile(req ctrl.Request) (ctrl.Result,
 		}
 
 		for _, run := range runs.Items {
-			kmakeName := bythepowerofv1.GetDomainLabel(run.Labels, bythepowerofv1.KmakeLabel)
-			if kmakeName != "" {
-				found := false
-
-				for _, i := range allRuns {
-					if i == run.GetName() {
-						found = true
-						break
-					}
-				}
-
-				if !found {
-					kmsr := &bythepowerofv1.KmakeScheduleRun{
-						ObjectMeta: ObjectMetaConcat(instance, req.NamespacedName, bythepowerofv1.ScheduleRun),
-						Spec: bythepowerofv1.KmakeScheduleRunSpec{
-							KmakeScheduleRunOperation: bythepowerofv1.KmakeScheduleRunOperation{
-								Start: &bythepowerofv1.KmakeScheduleRunStart{},
-							},
-						},
-					}
-					ctrl.SetControllerReference(instance, kmsr, r.Scheme)
-					SetOwnerReference(&run, kmsr, r.Scheme)
-
-					kmsr.SetLabels(map[string]string{
-						bythepowerofv1.MakeDomainString(bythepowerofv1.KmakeLabel):        kmakeName,
-						bythepowerofv1.MakeDomainString(bythepowerofv1.ScheduleInstLabel): instance.Name,
-						bythepowerofv1.MakeDomainString(bythepowerofv1.ScheduleEnvLabel):  currentenvmap.GetName(),
-						bythepowerofv1.MakeDomainString(bythepowerofv1.RunLabel):          run.GetName(),
-						bythepowerofv1.MakeDomainString(bythepowerofv1.WorkloadLabel):     "yes",
-						bythepowerofv1.MakeDomainString(bythepowerofv1.StatusLabel):       "Provision",
-					})
-
-					err = r.Create(ctx, kmsr)
-					if err != nil {
-						return reconcile.Result{}, err
-					}
-					// seems we need to refetch the instance here
-					instance = &bythepowerofv1.KmakeNowScheduler{}
-					err = r.Get(ctx, req.NamespacedName, instance)
-					if err != nil {
-						return reconcile.Result{}, err
-					}
-					err = r.Event(instance, bythepowerofv1.Provision, bythepowerofv1.Runs, kmsr.GetName())
-					if err != nil {
-						return reconcile.Result{}, err
-					}
-					// return requeue, nil
-					allRuns = append(allRuns, run.GetName())
-				}
-			} else {
-				log.Info(fmt.Sprintf("run %v not connected to kmake", instance.GetName()))
+			kmakeName := run.GetKmakeName()
+			if kmakeName == "" {
+				log.Info(fmt.Sprintf("run %v not connected to kmake", run.GetName()))
+				continue
+			}
+			uid := string(run.GetUID())
+			if scheduled[uid] || hasScheduleRun[run.GetName()] {
+				current[uid] = true
+				continue
+			}
+
+			kmsr := &bythepowerofv1.KmakeScheduleRun{
+				ObjectMeta: ObjectMetaConcat(instance, req.NamespacedName, bythepowerofv1.ScheduleRun, run.GetUID()),
+				Spec: bythepowerofv1.KmakeScheduleRunSpec{
+					KmakeScheduleRunOperation: bythepowerofv1.KmakeScheduleRunOperation{
+						Start: &bythepowerofv1.KmakeScheduleRunStart{},
+					},
+					TTLSecondsAfterFinished: instance.Spec.TTLSecondsAfterFinished,
+					ActiveDeadlineSeconds:   instance.Spec.ActiveDeadlineSeconds,
+				},
 			}
+			ctrl.SetControllerReference(instance, kmsr, r.Scheme)
+			SetOwnerReference(&run, kmsr, r.Scheme)
+
+			kmsr.SetLabels(ScheduleRunLabels(instance, map[string]string{
+				bythepowerofv1.MakeDomainString(bythepowerofv1.KmakeLabel):          kmakeName,
+				bythepowerofv1.MakeDomainString(bythepowerofv1.KmakeNamespaceLabel): run.GetKmakeNamespace(),
+				bythepowerofv1.MakeDomainString(bythepowerofv1.ScheduleInstLabel):   instance.Name,
+				bythepowerofv1.MakeDomainString(bythepowerofv1.ScheduleEnvLabel):    envmap.GetName(),
+				bythepowerofv1.MakeDomainString(bythepowerofv1.RunLabel):            run.GetName(),
+				bythepowerofv1.MakeDomainString(bythepowerofv1.WorkloadLabel):       "yes",
+				bythepowerofv1.MakeDomainString(bythepowerofv1.StatusLabel):         "Provision",
+			}))
+			// the schedule run's reconciles carry on our trace
+			injectTrace(ctx, kmsr)
+
+			err = r.Create(ctx, kmsr)
+			if errors.IsAlreadyExists(err) {
+				// made on an earlier pass we didn't get to remember
+				current[uid] = true
+				continue
+			}
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+			// seems we need to refetch the instance here
+			instance = &bythepowerofv1.KmakeNowScheduler{}
+			err = r.Get(ctx, req.NamespacedName, instance)
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+			err = r.Event(ctx, instance, bythepowerofv1.Provision, bythepowerofv1.Runs, kmsr.GetName())
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+			current[uid] = true
+		}
+	}
+
+	// remember them for when their schedule runs are deleted, forgetting the
+	// runs that have gone
+	var remember []string
+	for uid := range current {
+		remember = append(remember, uid)
+	}
+	sort.Strings(remember)
+	if !equality.Semantic.DeepEqual(instance.Status.Scheduled, remember) {
+		instance.Status.Scheduled = remember
+		err = r.Status().Update(ctx, instance)
+		if err != nil {
+			return reconcile.Result{}, err
 		}
 	}
 
-	_ = r.Event(instance, bythepowerofv1.Ready, bythepowerofv1.Main, "")
+	_ = r.Event(ctx, instance, bythepowerofv1.Ready, bythepowerofv1.Main, "")
 	return backoff5, nil
 }
 
@@ -265,7 +253,7 @@ func (r *KmakeNowSchedulerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	kmsrOwnerKey := ".metadata.controller"
 	apiGVStr := bythepowerofv1.GroupVersion.String()
 
-	if err := mgr.GetFieldIndexer().IndexField(&bythepowerofv1.KmakeScheduleRun{}, kmsrOwnerKey, func(rawObj runtime.Object) []string {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &bythepowerofv1.KmakeScheduleRun{}, kmsrOwnerKey, func(rawObj client.Object) []string {
 		// grab the run object, extract the owner...
 		kmsr := rawObj.(*bythepowerofv1.KmakeScheduleRun)
 		owner := metav1.GetControllerOf(kmsr)
@@ -287,5 +275,7 @@ func (r *KmakeNowSchedulerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		For(&bythepowerofv1.KmakeNowScheduler{}).
 		Owns(&bythepowerofv1.KmakeScheduleRun{}).
 		Owns(&corev1.ConfigMap{}).
+		WithEventFilter(r.Scope.Predicate(mgr.GetClient())).
+		WithOptions(r.Config.Get().Controller("KmakeNowScheduler")).
 		Complete(r)
 }
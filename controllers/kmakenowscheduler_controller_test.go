@@ -12,6 +12,9 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var _ = Describe("Controllers/KmakeRunController", func() {
@@ -111,7 +114,7 @@ var _ = Describe("Controllers/KmakeRunController", func() {
 				Spec: bythepowerofv1.KmakeSpec{
 					PersistentVolumeClaimTemplate: corev1.PersistentVolumeClaimSpec{
 						AccessModes: []corev1.PersistentVolumeAccessMode{"ReadWriteOnce"},
-						Resources: corev1.ResourceRequirements{
+						Resources: corev1.VolumeResourceRequirements{
 							Requests: *cap,
 						},
 						StorageClassName: &storageClass,
@@ -240,4 +243,199 @@ var _ = Describe("Controllers/KmakeRunController", func() {
 			// Expect(k8sClient.Delete(context.Background(), f3)).Should(Succeed())
 		})
 	})
+
+	Context("Suspended kmake now scheduler", func() {
+		key := types.NamespacedName{
+			Name:      "foo28",
+			Namespace: namespace,
+		}
+
+		kmsrs := func() int {
+			l := &bythepowerofv1.KmakeScheduleRunList{}
+			k8sClient.List(context.Background(), l, client.InNamespace(namespace),
+				client.MatchingLabels{"bythepowerof.github.io/schedule-instance": key.Name})
+			return len(l.Items)
+		}
+
+		It("Should make no schedule runs until resumed", func() {
+			By("Create kmake and run")
+			Expect(k8sClient.Create(context.Background(), newTestKmake("kmake16", namespace))).Should(Succeed())
+
+			kmakerun := newTestKmakeRun("foo27", namespace, "kmake16")
+			kmakerun.Labels["bythepowerof.github.io/scheduler"] = "suspend"
+			Expect(k8sClient.Create(context.Background(), kmakerun)).Should(Succeed())
+
+			By("Create suspended now scheduler")
+			kmns := &bythepowerofv1.KmakeNowScheduler{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      key.Name,
+					Namespace: namespace,
+				},
+				Spec: bythepowerofv1.KmakeNowSchedulerSpec{
+					Monitor: []string{"suspend"},
+					Suspend: true,
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), kmns)).Should(Succeed())
+
+			Eventually(func() string {
+				f := &bythepowerofv1.KmakeNowScheduler{}
+				k8sClient.Get(context.Background(), key, f)
+				return f.Status.Status
+			}, timeout, interval).Should(Equal("Stop Main (suspended)"))
+			Consistently(kmsrs, time.Second*5, interval).Should(Equal(0))
+
+			By("Resuming")
+			f := &bythepowerofv1.KmakeNowScheduler{}
+			Expect(k8sClient.Get(context.Background(), key, f)).Should(Succeed())
+			f.Spec.Suspend = false
+			Expect(k8sClient.Update(context.Background(), f)).Should(Succeed())
+
+			Eventually(kmsrs, timeout, interval).Should(Equal(1))
+
+			By("delete now scheduler")
+			Expect(k8sClient.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(k8sClient.Delete(context.Background(), f)).Should(Succeed())
+		})
+	})
+
+	Context("Kmake now scheduler with no history", func() {
+		It("Should delete its ended schedule runs and not run them again", func() {
+			key := types.NamespacedName{Name: "foo51", Namespace: namespace}
+			none := int32(0)
+
+			kmakerun := newTestKmakeRun("foo50", namespace, "kmake18")
+			kmakerun.UID = "foo50-uid"
+			kmakerun.Labels["bythepowerof.github.io/scheduler"] = "history"
+
+			c, testScheme := newFakeClient(kmakerun, &bythepowerofv1.KmakeNowScheduler{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: namespace,
+					Finalizers: []string{bythepowerofv1.KmakeNowSchedulerFinalizerName}},
+				Spec: bythepowerofv1.KmakeNowSchedulerSpec{
+					Monitor:                    []string{"history"},
+					SuccessfulRunsHistoryLimit: &none,
+				},
+			})
+			r := &KmakeNowSchedulerReconciler{Client: c, Recorder: record.NewFakeRecorder(100), Scheme: testScheme}
+
+			kmsrs := func() []bythepowerofv1.KmakeScheduleRun {
+				_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+				Expect(err).ToNot(HaveOccurred())
+				l := &bythepowerofv1.KmakeScheduleRunList{}
+				Expect(c.List(context.Background(), l, client.InNamespace(namespace))).Should(Succeed())
+				return l.Items
+			}
+
+			By("Scheduling the run once")
+			kmsrs()
+			l := kmsrs()
+			Expect(l).To(HaveLen(1))
+			f := &bythepowerofv1.KmakeNowScheduler{}
+			Expect(c.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(f.Status.Scheduled).To(Equal([]string{"foo50-uid"}))
+
+			By("Deleting it once it succeeds")
+			l[0].Labels["bythepowerof.github.io/status"] = "Success"
+			Expect(c.Update(context.Background(), &l[0])).Should(Succeed())
+			Expect(kmsrs()).To(BeEmpty())
+			Expect(kmsrs()).To(BeEmpty())
+
+			By("Forgetting the run once it's gone")
+			Expect(c.Delete(context.Background(), kmakerun)).Should(Succeed())
+			kmsrs()
+			Expect(c.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(f.Status.Scheduled).To(BeEmpty())
+		})
+	})
+
+	Context("Kmake now scheduler sharing its name with a trigger scheduler", func() {
+		It("Should leave the other's schedule runs alone", func() {
+			key := types.NamespacedName{Name: "shared", Namespace: namespace}
+			none := int32(0)
+
+			kmakerun := newTestKmakeRun("foo53", namespace, "kmake23")
+			kmakerun.UID = "foo53-uid"
+			kmakerun.Labels["bythepowerof.github.io/scheduler"] = "shared"
+
+			now := &bythepowerofv1.KmakeNowScheduler{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: namespace, UID: "now-uid",
+					Finalizers: []string{bythepowerofv1.KmakeNowSchedulerFinalizerName}},
+				Spec: bythepowerofv1.KmakeNowSchedulerSpec{
+					Monitor:                    []string{"shared"},
+					SuccessfulRunsHistoryLimit: &none,
+				},
+			}
+			trigger := &bythepowerofv1.KmakeTriggerScheduler{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: namespace, UID: "trigger-uid"},
+			}
+
+			// the trigger scheduler's, one ended and one still going
+			triggered := func(name string, status string) *bythepowerofv1.KmakeScheduleRun {
+				kmsr := newTestKmakeScheduleRun(name, namespace, "kmake23", "foo53", "schedenv12")
+				kmsr.Labels["bythepowerof.github.io/schedule-instance"] = key.Name
+				kmsr.Labels["bythepowerof.github.io/status"] = status
+				kmsr.OwnerReferences = []metav1.OwnerReference{
+					*metav1.NewControllerRef(trigger, bythepowerofv1.GroupVersion.WithKind("KmakeTriggerScheduler")),
+				}
+				return kmsr
+			}
+
+			c, testScheme := newFakeClient(kmakerun, now, trigger,
+				triggered("foo54", "Success"), triggered("foo55", "Active"))
+			r := &KmakeNowSchedulerReconciler{Client: c, Recorder: record.NewFakeRecorder(100), Scheme: testScheme}
+
+			owners := func() map[string]int {
+				l := &bythepowerofv1.KmakeScheduleRunList{}
+				Expect(c.List(context.Background(), l, client.InNamespace(namespace))).Should(Succeed())
+				ret := map[string]int{}
+				for _, kmsr := range l.Items {
+					ret[metav1.GetControllerOf(&kmsr).Kind]++
+				}
+				return ret
+			}
+
+			By("Scheduling the run though the trigger scheduler has")
+			for i := 0; i < 2; i++ {
+				_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(owners()).To(Equal(map[string]int{"KmakeNowScheduler": 1, "KmakeTriggerScheduler": 2}))
+
+			By("Deleting only its own")
+			Expect(cleanupScheduleRuns[*bythepowerofv1.KmakeNowScheduler](c)(context.Background(), now)).To(Succeed())
+			Expect(owners()).To(Equal(map[string]int{"KmakeTriggerScheduler": 2}))
+		})
+	})
+
+	Context("Kmake now scheduler left suspended", func() {
+		It("Should not look again until it's resumed", func() {
+			key := types.NamespacedName{Name: "suspend2", Namespace: namespace}
+
+			kmakerun := newTestKmakeRun("foo60", namespace, "kmake27")
+			kmakerun.Labels["bythepowerof.github.io/scheduler"] = "suspend2"
+
+			c, testScheme := newFakeClient(kmakerun, &bythepowerofv1.KmakeNowScheduler{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: namespace,
+					Finalizers: []string{bythepowerofv1.KmakeNowSchedulerFinalizerName}},
+				Spec: bythepowerofv1.KmakeNowSchedulerSpec{
+					Monitor: []string{"suspend2"},
+					Suspend: true,
+				},
+			})
+			r := &KmakeNowSchedulerReconciler{Client: c, Recorder: record.NewFakeRecorder(100), Scheme: testScheme}
+
+			// past making its env map
+			var result ctrl.Result
+			for i := 0; i < 3; i++ {
+				var err error
+				result, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(result).To(Equal(ctrl.Result{}))
+
+			f := &bythepowerofv1.KmakeNowScheduler{}
+			Expect(c.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(f.Status.Status).To(Equal("Stop Main (suspended)"))
+		})
+	})
 })
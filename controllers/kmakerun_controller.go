@@ -18,63 +18,56 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"strings"
 
-	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+	"github.com/bythepowerof/kmake-controller/controllerconfig"
+	"github.com/bythepowerof/kmake-controller/internal/reconciler"
+	"github.com/bythepowerof/kmake-controller/scope"
 )
 
 // KmakeRunReconciler reconciles a KmakeRun object
 type KmakeRunReconciler struct {
 	client.Client
-	Log      logr.Logger
 	Recorder record.EventRecorder
 	Scheme   *runtime.Scheme
+	Scope    *scope.Scope
+	Config   *controllerconfig.Store
 }
 
-func (r *KmakeRunReconciler) Event(instance *bythepowerofv1.KmakeRun, phase bythepowerofv1.Phase, subresource bythepowerofv1.SubResource, name string) error {
-	m := ""
-	if name != "" {
-		m = fmt.Sprintf("%v %v (%v)", phase.String(), subresource.String(), name)
-	} else {
-		m = fmt.Sprintf("%v %v", phase.String(), subresource.String())
+// kind is how we handle kmake runs
+func (r *KmakeRunReconciler) kind() *reconciler.Kind[*bythepowerofv1.KmakeRun] {
+	return &reconciler.Kind[*bythepowerofv1.KmakeRun]{
+		Client:    r.Client,
+		Recorder:  r.Recorder,
+		Scheme:    r.Scheme,
+		Finalizer: bythepowerofv1.KmakeRunFinalizerName,
 	}
-	r.Recorder.Event(instance, "Normal", phase.String()+subresource.String(), m)
-
-	log := r.Log.WithValues("kmake", instance.GetName())
-	log.Info(m)
-
-	if instance.Status.Status != m {
-		instance.Status.Status = m
-
-		log.Info(name)
-
-		instance.Status.UpdateSubResource(subresource, name)
-		r.Status().Update(context.Background(), instance)
+}
 
-		var err error
-		instance.Annotations, err = bythepowerofv1.SetDomainAnnotation(instance.Annotations, instance.Status.Resources)
-		if err != nil {
-			return err
-		}
-		return r.Update(context.Background(), instance)
-	}
-	return nil
+func (r *KmakeRunReconciler) Event(ctx context.Context, instance *bythepowerofv1.KmakeRun, phase bythepowerofv1.Phase, subresource bythepowerofv1.SubResource, name string) error {
+	return r.kind().Event(ctx, instance, phase, subresource, name)
 }
 
 // +kubebuilder:rbac:groups=bythepowerof.github.com,resources=kmakeruns,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=bythepowerof.github.com,resources=kmakeruns/status,verbs=get;update;patch
 
-func (r *KmakeRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
-	ctx := context.Background()
-	log := r.Log.WithValues("kmakerun", req.NamespacedName)
+func (r *KmakeRunReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
+	log := logf.FromContext(ctx)
 
 	// requeue := ctrl.Result{Requeue: true}
 	// backoff5 := ctrl.Result{RequeueAfter: time.Until(time.Now().Add(1 * time.Minute))}
@@ -83,7 +76,7 @@ func (r *KmakeRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	defer log.Info(fmt.Sprintf("Finish reconcile loop for %v", req.NamespacedName))
 
 	instance := &bythepowerofv1.KmakeRun{}
-	err := r.Get(ctx, req.NamespacedName, instance)
+	err = r.Get(ctx, req.NamespacedName, instance)
 
 	if err != nil {
 		if errors.IsNotFound(err) {
@@ -91,52 +84,74 @@ func (r *KmakeRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 		}
 		return reconcile.Result{}, err
 	}
-	if instance.IsBeingDeleted() {
-		err = r.handleFinalizer(instance)
-		if err != nil {
-			r.Event(instance, bythepowerofv1.Delete, bythepowerofv1.Main, "finalizer")
-			return reconcile.Result{}, fmt.Errorf("error when handling finalizer: %v", err)
-		}
-		err = r.Event(instance, bythepowerofv1.Delete, bythepowerofv1.Main, "")
-		if err != nil {
-			return reconcile.Result{}, err
-		}
-		return ctrl.Result{}, nil
-	}
-
-	if !instance.HasFinalizer(bythepowerofv1.KmakeRunFinalizerName) {
-		err = r.addFinalizer(instance)
-		if err != nil {
-			r.Event(instance, bythepowerofv1.Error, bythepowerofv1.Main, "finalizer")
 
-			return reconcile.Result{}, fmt.Errorf("error when handling kmakerun finalizer: %v", err)
-		}
-		r.Event(instance, bythepowerofv1.Provision, bythepowerofv1.Main, "finalizer")
+	ctx, span := startSpan(ctx, "KmakeRun.Reconcile", instance)
+	defer func() { endSpan(span, err) }()
+	log = logf.FromContext(ctx)
 
-		return ctrl.Result{}, nil
+	done, err := r.kind().Finalize(ctx, instance)
+	if done {
+		return reconcile.Result{}, err
 	}
 
 	kmakename := instance.GetKmakeName()
 	kmake := &bythepowerofv1.Kmake{}
 
-	log.Info(fmt.Sprintf("Checking kmake %v", kmakename))
+	log.Info(fmt.Sprintf("Checking kmake %v/%v", instance.GetKmakeNamespace(), kmakename))
 	err = r.Get(ctx, types.NamespacedName{
-		Namespace: instance.GetNamespace(),
+		Namespace: instance.GetKmakeNamespace(),
 		Name:      kmakename,
 	}, kmake)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			log.Info(fmt.Sprintf("Not found kmake %v", kmakename))
-			r.Event(instance, bythepowerofv1.BackOff, bythepowerofv1.KMAKE, kmakename)
+			// wait for kmake, its watch will requeue us
+			err = r.Event(ctx, instance, bythepowerofv1.BackOff, bythepowerofv1.KMAKE, kmakename)
 		}
 		return ctrl.Result{}, err
 	}
 
+	if !kmake.AllowsNamespace(instance.GetNamespace()) {
+		log.Info(fmt.Sprintf("Kmake %v/%v not granted to %v", kmake.GetNamespace(), kmakename, instance.GetNamespace()))
+		// wait for the grant, the kmake watch will requeue us
+		err = r.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.KMAKE, fmt.Sprintf("%v/%v not granted", kmake.GetNamespace(), kmakename))
+		return ctrl.Result{}, err
+	}
+
+	// check the kmake can build the targets we want
+	missing := make([]string, 0)
+	warnings := make([]string, 0)
+	if instance.Spec.KmakeRunOperation.Job != nil {
+		missing = kmake.Spec.MissingTargets(instance.Spec.KmakeRunOperation.Job.Targets)
+		warnings = kmake.Spec.LintTargets(instance.Spec.KmakeRunOperation.Job.Targets).Strings()
+	}
+	if !equality.Semantic.DeepEqual(instance.Status.Warnings, warnings) {
+		log.Info(fmt.Sprintf("Missing targets %v in kmake %v", missing, kmakename))
+		instance.Status.Warnings = warnings
+		if len(warnings) == 0 {
+			instance.Status.Warnings = nil
+		}
+		err = r.Status().Update(ctx, instance)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	// owner references can't cross namespaces so a shared kmake never owns us
+	if instance.IsCrossNamespace() {
+		if len(missing) > 0 {
+			err = r.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.Main, fmt.Sprintf("missing targets %s", strings.Join(missing, " ")))
+			return ctrl.Result{}, err
+		}
+		err = r.Event(ctx, instance, bythepowerofv1.Ready, bythepowerofv1.Main, "")
+		return ctrl.Result{}, err
+	}
+
 	// just add in the kmake as an owner - leave any other owners alone
 	if instance.OwnerReferences == nil {
 		ctrl.SetControllerReference(kmake, instance, r.Scheme)
 
-		r.Event(instance, bythepowerofv1.Update, bythepowerofv1.KMAKE, kmakename)
+		r.Event(ctx, instance, bythepowerofv1.Update, bythepowerofv1.KMAKE, kmakename)
 
 		err = r.Update(ctx, instance)
 		if err != nil {
@@ -146,12 +161,16 @@ func (r *KmakeRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	}
 	for _, owner := range instance.OwnerReferences {
 		if owner.Kind == "Kmake" {
-			err = r.Event(instance, bythepowerofv1.Ready, bythepowerofv1.Main, "")
+			if len(missing) > 0 {
+				err = r.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.Main, fmt.Sprintf("missing targets %s", strings.Join(missing, " ")))
+				return ctrl.Result{}, err
+			}
+			err = r.Event(ctx, instance, bythepowerofv1.Ready, bythepowerofv1.Main, "")
 			return ctrl.Result{}, nil
 		}
 	}
 	ctrl.SetControllerReference(kmake, instance, r.Scheme)
-	r.Event(instance, bythepowerofv1.Update, bythepowerofv1.KMAKE, kmakename)
+	r.Event(ctx, instance, bythepowerofv1.Update, bythepowerofv1.KMAKE, kmakename)
 
 	err = r.Update(ctx, instance)
 	if err != nil {
@@ -160,8 +179,107 @@ func (r *KmakeRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
 	return ctrl.Result{}, nil
 }
 
+// runKmakeRefKey indexes kmake runs by the namespace/name of a kmake in
+// another namespace
+const runKmakeRefKey = ".spec.kmakeRef"
+
+// runKmakeRefIndex is the namespace/name of the kmake a run in another
+// namespace refers to
+func runKmakeRefIndex(rawObj client.Object) []string {
+	run := rawObj.(*bythepowerofv1.KmakeRun)
+	if !run.IsCrossNamespace() {
+		return nil
+	}
+	return []string{run.GetKmakeNamespace() + "/" + run.GetKmakeName()}
+}
+
 func (r *KmakeRunReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &bythepowerofv1.KmakeRun{}, runKmakeRefKey, runKmakeRefIndex); err != nil {
+		return err
+	}
+
+	// revalidate the runs of a kmake when it appears, is ready or its rules change
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&bythepowerofv1.KmakeRun{}).
+		Watches(&bythepowerofv1.Kmake{},
+			handler.EnqueueRequestsFromMapFunc(r.kmakeRuns),
+			builder.WithPredicates(predicate.Funcs{
+				UpdateFunc: func(e event.UpdateEvent) bool {
+					old, ok := e.ObjectOld.(*bythepowerofv1.Kmake)
+					if !ok {
+						return false
+					}
+					new, ok := e.ObjectNew.(*bythepowerofv1.Kmake)
+					if !ok {
+						return false
+					}
+					return old.IsReady() != new.IsReady() ||
+						!equality.Semantic.DeepEqual(old.Spec.Rules, new.Spec.Rules) ||
+						old.Annotations[bythepowerofv1.MakeDomainString(bythepowerofv1.AllowedNamespacesLabel)] !=
+							new.Annotations[bythepowerofv1.MakeDomainString(bythepowerofv1.AllowedNamespacesLabel)]
+				},
+			})).
+		WithEventFilter(r.Scope.Predicate(mgr.GetClient())).
+		WithOptions(r.Config.Get().Controller("KmakeRun")).
 		Complete(r)
 }
+
+// kmakeRuns maps a kmake to the runs it controls, those labelled with it
+// that are waiting for it and those in other namespaces that refer to it
+func (r *KmakeRunReconciler) kmakeRuns(ctx context.Context, o client.Object) []reconcile.Request {
+	runs, err := listKmakeRuns(ctx, r, o)
+	if err != nil {
+		logf.FromContext(ctx).Error(err, fmt.Sprintf("unable to list runs for kmake %v", o.GetName()))
+		return nil
+	}
+
+	ret := make([]reconcile.Request, 0, len(runs))
+	for _, run := range runs {
+		ret = append(ret, reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: run.GetNamespace(),
+			Name:      run.GetName(),
+		}})
+	}
+	return ret
+}
+
+// listKmakeRuns lists the runs of a kmake, those it controls, those labelled
+// with it and those in other namespaces that refer to it
+func listKmakeRuns(ctx context.Context, c client.Reader, kmake client.Object) ([]bythepowerofv1.KmakeRun, error) {
+	ret := make([]bythepowerofv1.KmakeRun, 0)
+	seen := map[types.NamespacedName]bool{}
+
+	for _, opts := range [][]client.ListOption{
+		{
+			client.InNamespace(kmake.GetNamespace()),
+			client.MatchingFields{runOwnerKey: kmake.GetName()},
+		},
+		{
+			client.InNamespace(kmake.GetNamespace()),
+			client.MatchingLabels{
+				bythepowerofv1.MakeDomainString(bythepowerofv1.KmakeLabel): kmake.GetName(),
+			},
+		},
+		{
+			client.MatchingFields{runKmakeRefKey: kmake.GetNamespace() + "/" + kmake.GetName()},
+		},
+	} {
+		runs := &bythepowerofv1.KmakeRunList{}
+		if err := c.List(ctx, runs, opts...); err != nil {
+			return nil, err
+		}
+
+		for _, run := range runs.Items {
+			key := types.NamespacedName{
+				Namespace: run.GetNamespace(),
+				Name:      run.GetName(),
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			ret = append(ret, run)
+		}
+	}
+	return ret, nil
+}
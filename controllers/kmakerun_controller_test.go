@@ -63,7 +63,7 @@ var _ = Describe("Controllers/KmakeRunController", func() {
 				Spec: bythepowerofv1.KmakeSpec{
 					PersistentVolumeClaimTemplate: corev1.PersistentVolumeClaimSpec{
 						AccessModes: []corev1.PersistentVolumeAccessMode{"ReadWriteOnce"},
-						Resources: corev1.ResourceRequirements{
+						Resources: corev1.VolumeResourceRequirements{
 							Requests: *cap,
 						},
 						StorageClassName: &storageClass,
@@ -125,4 +125,164 @@ var _ = Describe("Controllers/KmakeRunController", func() {
 			Expect(k8sClient.Delete(context.Background(), f2)).Should(Succeed())
 		})
 	})
+
+	Context("Kmake run with missing targets", func() {
+		const kmakename = "kmake7"
+		const kmakerunname = "foo11"
+
+		key := types.NamespacedName{
+			Name:      kmakerunname,
+			Namespace: namespace,
+		}
+
+		kmakekey := types.NamespacedName{
+			Name:      kmakename,
+			Namespace: namespace,
+		}
+
+		It("Should revalidate when the rules change", func() {
+			By("Create kmake for run")
+
+			cap := &corev1.ResourceList{
+				"storage": resource.MustParse("3Ki"),
+			}
+
+			storageClass := ""
+
+			kmake := &bythepowerofv1.Kmake{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      kmakename,
+					Namespace: namespace,
+				},
+				Spec: bythepowerofv1.KmakeSpec{
+					PersistentVolumeClaimTemplate: corev1.PersistentVolumeClaimSpec{
+						AccessModes: []corev1.PersistentVolumeAccessMode{"ReadWriteOnce"},
+						Resources: corev1.VolumeResourceRequirements{
+							Requests: *cap,
+						},
+						StorageClassName: &storageClass,
+					},
+					Rules: []bythepowerofv1.KmakeRule{
+						bythepowerofv1.KmakeRule{
+							Targets:  []string{"Rule1"},
+							Commands: []string{"@echo $@"},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), kmake)).Should(Succeed())
+
+			By("Create kmake run")
+
+			kmakerun := &bythepowerofv1.KmakeRun{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      kmakerunname,
+					Namespace: namespace,
+					Labels:    map[string]string{"bythepowerof.github.io/kmake": kmakename},
+				},
+				Spec: bythepowerofv1.KmakeRunSpec{
+					KmakeRunOperation: bythepowerofv1.KmakeRunOperation{
+						Job: &bythepowerofv1.KmakeRunJob{
+							Template: corev1.PodTemplateSpec{
+								Spec: corev1.PodSpec{
+									Containers: []corev1.Container{
+										corev1.Container{
+											Name:    "test",
+											Command: []string{"make"},
+											Image:   "jeremymarshall/make-test:1",
+										},
+									},
+								},
+							},
+							Targets: []string{"Rule1", "Rule3"},
+						},
+					},
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), kmakerun)).Should(Succeed())
+
+			By("Reporting the missing target")
+			Eventually(func() []string {
+				f := &bythepowerofv1.KmakeRun{}
+				k8sClient.Get(context.Background(), key, f)
+				return f.Status.Warnings
+			}, timeout, interval).Should(Equal([]string{"Error UndefinedTarget (Rule3): no rule to make target"}))
+
+			Eventually(func() string {
+				f := &bythepowerofv1.KmakeRun{}
+				k8sClient.Get(context.Background(), key, f)
+				return f.Status.Status
+			}, timeout, interval).Should(Equal("Error Main (missing targets Rule3)"))
+
+			By("Adding the target to the kmake")
+			f := &bythepowerofv1.Kmake{}
+			Expect(k8sClient.Get(context.Background(), kmakekey, f)).Should(Succeed())
+			f.Spec.Rules = append(f.Spec.Rules, bythepowerofv1.KmakeRule{
+				Targets:  []string{"Rule3"},
+				Commands: []string{"@echo $@"},
+			})
+			Expect(k8sClient.Update(context.Background(), f)).Should(Succeed())
+
+			Eventually(func() []string {
+				f := &bythepowerofv1.KmakeRun{}
+				k8sClient.Get(context.Background(), key, f)
+				return f.Status.Warnings
+			}, timeout, interval).Should(BeEmpty())
+
+			Eventually(func() string {
+				f := &bythepowerofv1.KmakeRun{}
+				k8sClient.Get(context.Background(), key, f)
+				return f.Status.Status
+			}, timeout, interval).Should(Equal("Ready Main"))
+
+			By("delete kmake")
+			Expect(k8sClient.Get(context.Background(), kmakekey, f)).Should(Succeed())
+			Expect(k8sClient.Delete(context.Background(), f)).Should(Succeed())
+		})
+	})
+
+	Context("Kmake run of a kmake in another namespace", func() {
+		It("Should wait for the kmake to grant the namespace", func() {
+			key := types.NamespacedName{
+				Name:      "foo14",
+				Namespace: namespace,
+			}
+
+			By("Create the shared kmake")
+			Expect(k8sClient.Create(context.Background(), &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: "platform"},
+			})).Should(Succeed())
+			Expect(k8sClient.Create(context.Background(), newTestKmake("kmake9", "platform"))).Should(Succeed())
+
+			By("Create kmake run")
+			kmakerun := newTestKmakeRun("foo14", namespace, "")
+			kmakerun.Labels = nil
+			kmakerun.Spec.KmakeRef = &bythepowerofv1.KmakeReference{Name: "kmake9", Namespace: "platform"}
+			Expect(k8sClient.Create(context.Background(), kmakerun)).Should(Succeed())
+
+			Eventually(func() string {
+				f := &bythepowerofv1.KmakeRun{}
+				k8sClient.Get(context.Background(), key, f)
+				return f.Status.Status
+			}, timeout, interval).Should(Equal("Error Kmake (platform/kmake9 not granted)"))
+
+			By("Granting the namespace")
+			kmakekey := types.NamespacedName{Name: "kmake9", Namespace: "platform"}
+			f := &bythepowerofv1.Kmake{}
+			Expect(k8sClient.Get(context.Background(), kmakekey, f)).Should(Succeed())
+			f.Annotations = map[string]string{"bythepowerof.github.io/allowed-namespaces": namespace}
+			Expect(k8sClient.Update(context.Background(), f)).Should(Succeed())
+
+			Eventually(func() string {
+				f := &bythepowerofv1.KmakeRun{}
+				k8sClient.Get(context.Background(), key, f)
+				return f.Status.Status
+			}, timeout, interval).Should(Equal("Ready Main"))
+
+			By("not owned by the kmake")
+			run := &bythepowerofv1.KmakeRun{}
+			Expect(k8sClient.Get(context.Background(), key, run)).Should(Succeed())
+			Expect(run.OwnerReferences).To(BeEmpty())
+		})
+	})
 })
@@ -20,12 +20,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"gopkg.in/yaml.v2"
+	"math"
 	"time"
 
 	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
-	"github.com/go-logr/logr"
+	"github.com/bythepowerof/kmake-controller/controllerconfig"
+	"github.com/bythepowerof/kmake-controller/internal/reconciler"
+	"github.com/bythepowerof/kmake-controller/scope"
 	v1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	// "k8s.io/apimachinery/pkg/labels"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -33,60 +37,84 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 // KmakeScheduleRunReconciler reconciles a KmakeScheduleRun object
 type KmakeScheduleRunReconciler struct {
 	client.Client
-	Log      logr.Logger
 	Recorder record.EventRecorder
 	Scheme   *runtime.Scheme
+	Scope    *scope.Scope
+	Config   *controllerconfig.Store
+	// APIReader reads around the cache, for what another worker has only
+	// just done. Nil reads the cache
+	APIReader client.Reader
+
+	// starting lets one schedule run at a time per kmake namespace through
+	// its quota check to its job, with several workers
+	starting keyedLocks
 }
 
-func (r *KmakeScheduleRunReconciler) Event(instance *bythepowerofv1.KmakeScheduleRun, phase bythepowerofv1.Phase, subresource bythepowerofv1.SubResource, name string) error {
-	m := ""
-	if name != "" {
-		m = fmt.Sprintf("%v %v (%v)", phase.String(), subresource.String(), name)
-	} else {
-		m = fmt.Sprintf("%v %v", phase.String(), subresource.String())
+// live is the reader that sees the other workers' jobs and schedule runs
+func (r *KmakeScheduleRunReconciler) live() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
 	}
-	r.Recorder.Event(instance, "Normal", phase.String()+subresource.String(), m)
-
-	log := r.Log.WithValues("kmake", instance.GetName())
-	log.Info(m)
-
-	if instance.Status.Status != m {
-		instance.Status.Status = m
-
-		log.Info(name)
-
-		instance.Status.UpdateSubResource(subresource, name)
-		r.Status().Update(context.Background(), instance)
+	return r.Client
+}
 
-		instance.Labels = bythepowerofv1.SetDomainLabel(instance.Labels, bythepowerofv1.StatusLabel, phase.String())
-		var err error
-		instance.Annotations, err = bythepowerofv1.SetDomainAnnotation(instance.Annotations, instance.Status.Resources)
-		if err != nil {
-			return err
-		}
-		return r.Update(context.Background(), instance)
+// kind is how we handle schedule runs. Their children are in the kmake's
+// namespace, and an ended one says when and is labelled with its phase
+func (r *KmakeScheduleRunReconciler) kind() *reconciler.Kind[*bythepowerofv1.KmakeScheduleRun] {
+	return &reconciler.Kind[*bythepowerofv1.KmakeScheduleRun]{
+		Client:    r.Client,
+		Recorder:  r.Recorder,
+		Scheme:    r.Scheme,
+		Finalizer: bythepowerofv1.KmakeScheduleRunFinalizerName,
+		Cleanup:   r.cleanup,
+		ChildNamespace: func(instance *bythepowerofv1.KmakeScheduleRun) string {
+			return instance.GetKmakeNamespace()
+		},
+		OnStatus: func(instance *bythepowerofv1.KmakeScheduleRun, phase bythepowerofv1.Phase) {
+			if instance.HasStarted() && instance.Status.StartTime == nil {
+				now := metav1.Now()
+				instance.Status.StartTime = &now
+			}
+			if (phase == bythepowerofv1.Success || phase == bythepowerofv1.Error || phase == bythepowerofv1.Abort) &&
+				instance.Status.CompletionTime == nil {
+				now := metav1.Now()
+				instance.Status.CompletionTime = &now
+			}
+		},
+		OnMetadata: func(instance *bythepowerofv1.KmakeScheduleRun, phase bythepowerofv1.Phase) {
+			instance.Labels = bythepowerofv1.SetDomainLabel(instance.Labels, bythepowerofv1.StatusLabel, phase.String())
+		},
 	}
-	return nil
+}
+
+func (r *KmakeScheduleRunReconciler) Event(ctx context.Context, instance *bythepowerofv1.KmakeScheduleRun, phase bythepowerofv1.Phase, subresource bythepowerofv1.SubResource, name string) error {
+	return r.kind().Event(ctx, instance, phase, subresource, name)
 }
 
 // +kubebuilder:rbac:groups=bythepowerof.github.com,resources=kmakescheduleruns,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=bythepowerof.github.com,resources=kmakescheduleruns/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=bythepowerof.github.com,resources=kmakequotas,verbs=get;list;watch
 
-func (r *KmakeScheduleRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+func (r *KmakeScheduleRunReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
 
 	// your logic here
-	ctx := context.Background()
-	log := r.Log.WithValues("kmakeschedulerun", req.NamespacedName)
+	log := logf.FromContext(ctx)
+	// the same config all the way through, a reload can land mid reconcile
+	config := r.Config.Get()
 
 	// requeue := ctrl.Result{Requeue: true}
-	backoff5 := ctrl.Result{RequeueAfter: time.Until(time.Now().Add(1 * time.Minute))}
 
 	// your logic here
 
@@ -95,7 +123,7 @@ func (r *KmakeScheduleRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, e
 	defer log.Info(fmt.Sprintf("Finish reconcile loop for %v", req.NamespacedName))
 
 	instance := &bythepowerofv1.KmakeScheduleRun{}
-	err := r.Get(ctx, req.NamespacedName, instance)
+	err = r.Get(ctx, req.NamespacedName, instance)
 
 	if err != nil {
 		if errors.IsNotFound(err) {
@@ -104,29 +132,27 @@ func (r *KmakeScheduleRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, e
 		return reconcile.Result{}, err
 	}
 
-	if instance.IsBeingDeleted() {
-		err = r.handleFinalizer(instance)
-		if err != nil {
-			r.Event(instance, bythepowerofv1.Delete, bythepowerofv1.Main, "finalizer")
-			return reconcile.Result{}, fmt.Errorf("error when handling finalizer: %v", err)
-		}
-		err = r.Event(instance, bythepowerofv1.Delete, bythepowerofv1.Main, "")
-		if err != nil {
-			return reconcile.Result{}, err
-		}
-		return ctrl.Result{}, nil
+	ctx, span := startSpan(ctx, "KmakeScheduleRun.Reconcile", instance)
+	defer func() { endSpan(span, err) }()
+	log = logf.FromContext(ctx)
+
+	done, err := r.kind().Finalize(ctx, instance)
+	if done {
+		return reconcile.Result{}, err
 	}
 
-	if !instance.HasFinalizer(bythepowerofv1.KmakeScheduleRunFinalizerName) {
-		err = r.addFinalizer(instance)
-		if err != nil {
-			r.Event(instance, bythepowerofv1.Error, bythepowerofv1.Main, "finalizer")
+	if instance.Spec.Cancel && !instance.HasEnded() {
+		return reconcile.Result{}, r.abort(ctx, instance, bythepowerofv1.Cancelled)
+	}
 
-			return reconcile.Result{}, fmt.Errorf("error when handling kmakeschedulerun finalizer: %v", err)
+	if instance.HasEnded() {
+		// finish stopping the job if we failed to after aborting
+		if instance.IsAborted() {
+			if err = r.stopJob(ctx, instance); err != nil {
+				return reconcile.Result{}, err
+			}
 		}
-		r.Event(instance, bythepowerofv1.Provision, bythepowerofv1.Main, "finalizer")
-
-		return ctrl.Result{}, nil
+		return r.expire(ctx, instance)
 	}
 
 	var runType map[string]*json.RawMessage
@@ -150,7 +176,7 @@ func (r *KmakeScheduleRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, e
 				return ctrl.Result{}, nil
 			}
 
-			if !instance.IsActive() {
+			if !instance.IsActive() && !instance.IsWaiting() {
 				// make sure the job isn't pending...
 				return ctrl.Result{}, nil
 			}
@@ -166,16 +192,25 @@ func (r *KmakeScheduleRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, e
 				return reconcile.Result{}, err
 			}
 
+			// the job goes where the kmake and its PVC are, remember where
+			if instance.GetKmakeNamespace() != run.GetKmakeNamespace() {
+				instance.Labels = bythepowerofv1.SetDomainLabel(instance.Labels, bythepowerofv1.KmakeNamespaceLabel, run.GetKmakeNamespace())
+				return reconcile.Result{}, r.Update(ctx, instance)
+			}
+			if kmakename == "" {
+				kmakename = run.GetKmakeName()
+			}
+
 			if instance.IsActive() {
 				// check the job
 				currentjob := &v1.Job{}
-				err = r.Get(ctx, instance.Status.NamespacedNameConcat(bythepowerofv1.Job, instance.GetNamespace()), currentjob)
+				err = r.Get(ctx, instance.Status.NamespacedNameConcat(bythepowerofv1.Job, instance.GetKmakeNamespace()), currentjob)
 
 				if err != nil {
 					if errors.IsNotFound(err) {
 						// make sure someone hasn't delete the Job
-						if instance.Status.NamespacedNameConcat(bythepowerofv1.Job, instance.GetNamespace()).Name != "" {
-							r.Event(instance, bythepowerofv1.Abort, bythepowerofv1.Job, currentjob.GetName())
+						if instance.Status.NamespacedNameConcat(bythepowerofv1.Job, instance.GetKmakeNamespace()).Name != "" {
+							r.Event(ctx, instance, bythepowerofv1.Abort, bythepowerofv1.Job, currentjob.GetName())
 							return reconcile.Result{}, nil
 						}
 					} else {
@@ -183,17 +218,21 @@ func (r *KmakeScheduleRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, e
 					}
 				} else {
 					if currentjob.Status.Active > 0 {
-						r.Event(instance, bythepowerofv1.Active, bythepowerofv1.Job, currentjob.GetName())
+						r.Event(ctx, instance, bythepowerofv1.Active, bythepowerofv1.Job, currentjob.GetName())
 						return reconcile.Result{}, nil
 					}
 					if currentjob.Status.Succeeded > 0 {
-						r.Event(instance, bythepowerofv1.Success, bythepowerofv1.Job, currentjob.GetName())
+						r.Event(ctx, instance, bythepowerofv1.Success, bythepowerofv1.Job, currentjob.GetName())
 						return ctrl.Result{}, nil
 					}
-					if currentjob.Status.Failed > 0 {
-						r.Event(instance, bythepowerofv1.Error, bythepowerofv1.Job, currentjob.GetName())
+					if isDeadlineExceeded(currentjob) {
+						return ctrl.Result{}, r.abort(ctx, instance, bythepowerofv1.Timeout)
+					}
+					if isJobFailed(currentjob) {
+						r.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.Job, currentjob.GetName())
 						return ctrl.Result{}, nil
 					}
+					// between a failed pod and its retry
 					return reconcile.Result{}, nil
 				}
 			}
@@ -201,50 +240,92 @@ func (r *KmakeScheduleRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, e
 			kmake := &bythepowerofv1.Kmake{}
 			log.Info(fmt.Sprintf("Checking kmake %v", kmakename))
 			err = r.Get(ctx, types.NamespacedName{
-				Namespace: run.GetNamespace(),
+				Namespace: instance.GetKmakeNamespace(),
 				Name:      kmakename,
 			}, kmake)
 			if err != nil {
 				if errors.IsNotFound(err) {
 					log.Info(fmt.Sprintf("Not found kmake %v", kmakename))
-					r.Event(instance, bythepowerofv1.BackOff, bythepowerofv1.KMAKE, kmakename)
-					// wait for kmake
-					return backoff5, nil
+					err = r.Event(ctx, instance, bythepowerofv1.BackOff, bythepowerofv1.KMAKE, kmakename)
+					// wait for kmake, its watch will requeue us
+					return ctrl.Result{}, err
 				}
 				return ctrl.Result{}, err
 			}
 			pvcName := kmake.Status.GetSubReference(bythepowerofv1.PVC)
 			if pvcName == "" {
 				log.Info(fmt.Sprintf("Not found kmake PVC %v", kmakename))
-				r.Event(instance, bythepowerofv1.BackOff, bythepowerofv1.PVC, kmakename)
-				// wait for kmake
-				return backoff5, nil
+				err = r.Event(ctx, instance, bythepowerofv1.BackOff, bythepowerofv1.PVC, kmakename)
+				// wait for kmake, its watch will requeue us
+				return ctrl.Result{}, err
+			}
+
+			if !kmake.AllowsNamespace(instance.GetNamespace()) {
+				log.Info(fmt.Sprintf("Kmake %v/%v not granted to %v", kmake.GetNamespace(), kmakename, instance.GetNamespace()))
+				err = r.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.KMAKE, fmt.Sprintf("%v/%v not granted", kmake.GetNamespace(), kmakename))
+				return ctrl.Result{}, err
+			}
+
+			// children live in the kmake namespace
+			childName := types.NamespacedName{
+				Namespace: instance.GetKmakeNamespace(),
+				Name:      req.Name,
 			}
 
 			// Job
 			if run.Spec.KmakeRunOperation.Job != nil {
 				// build the pod
 				requiredjob := &v1.Job{
-					ObjectMeta: ObjectMetaConcat(instance, req.NamespacedName, bythepowerofv1.Job),
+					ObjectMeta: ObjectMetaConcat(instance, childName, bythepowerofv1.Job),
 				}
-				requiredjob.Labels = bythepowerofv1.SetDomainLabel(requiredjob.Labels, bythepowerofv1.ScheduleRunLabel, instance.GetName())
-
-				ctrl.SetControllerReference(instance, requiredjob, r.Scheme)
+				// the kmake's quotas count it, and the check and target jobs
+				// copied from it, by these
+				requiredjob.Labels = bythepowerofv1.SetDomainLabel(requiredjob.Labels, bythepowerofv1.KmakeLabel, kmake.GetName())
+				requiredjob.Labels = bythepowerofv1.SetDomainLabel(requiredjob.Labels, bythepowerofv1.KmakeNamespaceLabel, kmake.GetNamespace())
 
 				if err := SetOwnerReference(kmake, requiredjob, r.Scheme); err != nil {
-					r.Event(instance, bythepowerofv1.Error, bythepowerofv1.KMAKE, requiredjob.ObjectMeta.Name)
+					r.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.KMAKE, requiredjob.ObjectMeta.Name)
 					return reconcile.Result{}, err
 				}
-				if err = SetOwnerReference(run, requiredjob, r.Scheme); err != nil {
-					r.Event(instance, bythepowerofv1.Error, bythepowerofv1.Runs, requiredjob.ObjectMeta.Name)
+				if err = r.setChildOwner(instance, kmake, requiredjob); err != nil {
+					r.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.Schedule, requiredjob.ObjectMeta.Name)
 					return reconcile.Result{}, err
 				}
-				if err = ctrl.SetControllerReference(instance, requiredjob, r.Scheme); err != nil {
-					r.Event(instance, bythepowerofv1.Error, bythepowerofv1.Schedule, requiredjob.ObjectMeta.Name)
-					return reconcile.Result{}, err
+				// the run can only own it from the same namespace
+				if !instance.IsCrossNamespace() {
+					if err = SetOwnerReference(run, requiredjob, r.Scheme); err != nil {
+						r.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.Runs, requiredjob.ObjectMeta.Name)
+						return reconcile.Result{}, err
+					}
+				}
+
+				// a job in another namespace, or with its own variables, needs
+				// its own copy of the sched env
+				if instance.IsCrossNamespace() || len(instance.Spec.Start.Variables) > 0 {
+					kmakescheduleEnv, err = r.copyScheduleEnv(ctx, instance, kmake, childName, kmakescheduleEnv)
+					if err != nil {
+						if errors.IsNotFound(err) {
+							err = r.Event(ctx, instance, bythepowerofv1.BackOff, bythepowerofv1.SchEnvMap, kmakescheduleEnv)
+						}
+						return reconcile.Result{}, err
+					}
 				}
 
-				requiredjob.Spec.Template = run.Spec.KmakeRunOperation.Job.Template
+				// a copy, the run came from the cache
+				requiredjob.Spec.Template = *run.Spec.KmakeRunOperation.Job.Template.DeepCopy()
+				if instance.IsCrossNamespace() {
+					// the run's service accounts are in its own namespace, it
+					// can't run as one of the kmake namespace's
+					requiredjob.Spec.Template.Spec.ServiceAccountName = ""
+					requiredjob.Spec.Template.Spec.DeprecatedServiceAccount = ""
+					requiredjob.Spec.Template.Spec.AutomountServiceAccountToken = nil
+				}
+				config.ApplyJob(&requiredjob.Spec.Template)
+				if instance.IsCrossNamespace() && requiredjob.Spec.Template.Spec.ServiceAccountName == "" {
+					// nor with the token of the kmake namespace's default
+					automount := false
+					requiredjob.Spec.Template.Spec.AutomountServiceAccountToken = &automount
+				}
 
 				// add in the targets as args
 				if requiredjob.Spec.Template.Spec.Containers[0].Args == nil {
@@ -261,7 +342,7 @@ func (r *KmakeScheduleRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, e
 				requiredjob.Spec.Template.Spec.Containers[0].VolumeMounts = append(
 					requiredjob.Spec.Template.Spec.Containers[0].VolumeMounts,
 					corev1.VolumeMount{
-						MountPath: "/usr/share/env",
+						MountPath: config.Mounts.Env,
 						Name:      kmake.Status.GetSubReference(bythepowerofv1.EnvMap),
 					})
 
@@ -291,7 +372,7 @@ func (r *KmakeScheduleRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, e
 				requiredjob.Spec.Template.Spec.Containers[0].VolumeMounts = append(
 					requiredjob.Spec.Template.Spec.Containers[0].VolumeMounts,
 					corev1.VolumeMount{
-						MountPath: "/usr/share/schedule",
+						MountPath: config.Mounts.Schedule,
 						Name:      kmakescheduleEnv,
 					})
 
@@ -318,7 +399,7 @@ func (r *KmakeScheduleRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, e
 				requiredjob.Spec.Template.Spec.Containers[0].VolumeMounts = append(
 					requiredjob.Spec.Template.Spec.Containers[0].VolumeMounts,
 					corev1.VolumeMount{
-						MountPath: "/usr/share/pvc",
+						MountPath: config.Mounts.PVC,
 						Name:      pvcName,
 					})
 
@@ -338,7 +419,7 @@ func (r *KmakeScheduleRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, e
 				requiredjob.Spec.Template.Spec.Containers[0].VolumeMounts = append(
 					requiredjob.Spec.Template.Spec.Containers[0].VolumeMounts,
 					corev1.VolumeMount{
-						MountPath: "/usr/share/kmake",
+						MountPath: config.Mounts.Kmake,
 						Name:      kmake.Status.GetSubReference(bythepowerofv1.KmakeMap),
 					})
 
@@ -354,24 +435,7 @@ func (r *KmakeScheduleRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, e
 					})
 
 				// add in the owner config map
-				j, err := json.Marshal(requiredjob.OwnerReferences)
-				y, err := yaml.Marshal(requiredjob.OwnerReferences)
-				km, err := yaml.Marshal(NewOwnerReferencePatch(kmake, r.Scheme))
-				kmr, err := yaml.Marshal(NewOwnerReferencePatch(run, r.Scheme))
-				kms, err := yaml.Marshal(NewOwnerReferencePatch(instance, r.Scheme))
-
-				ownerconfigmap := &corev1.ConfigMap{
-					ObjectMeta: ObjectMetaConcat(instance, req.NamespacedName, bythepowerofv1.Owner),
-					Data: map[string]string{
-						"owner.yaml":                         string(y),
-						"owner.json":                         string(j),
-						"kmake-owner-patch.yaml":             string(km),
-						"kmakerun-owner-patch.yaml":          string(kmr),
-						"kmake-schedulerun-owner-patch.yaml": string(kms),
-					},
-				}
-				ctrl.SetControllerReference(instance, ownerconfigmap, r.Scheme)
-				err = r.Create(ctx, ownerconfigmap)
+				ownerconfigmap, err := r.ownerConfigMap(ctx, instance, kmake, run, requiredjob, childName)
 				if err != nil {
 					return reconcile.Result{}, err
 				}
@@ -379,7 +443,7 @@ func (r *KmakeScheduleRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, e
 				requiredjob.Spec.Template.Spec.Containers[0].VolumeMounts = append(
 					requiredjob.Spec.Template.Spec.Containers[0].VolumeMounts,
 					corev1.VolumeMount{
-						MountPath: "/usr/share/owner",
+						MountPath: config.Mounts.Owner,
 						Name:      ownerconfigmap.GetName(),
 					})
 
@@ -399,21 +463,82 @@ func (r *KmakeScheduleRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, e
 					requiredjob.Spec.Template.Spec.RestartPolicy = corev1.RestartPolicyNever
 				}
 
-				// create it
+				// and make can carry on the trace from the pod
+				injectTraceEnv(ctx, &requiredjob.Spec.Template.Spec)
+
+				// the job itself enforces the deadline, ours before the run's
+				requiredjob.Spec.ActiveDeadlineSeconds = run.Spec.ActiveDeadlineSeconds
+				if instance.Spec.ActiveDeadlineSeconds != nil {
+					requiredjob.Spec.ActiveDeadlineSeconds = instance.Spec.ActiveDeadlineSeconds
+				}
+
+				// the schedule runs of the kmakes in a namespace start one at
+				// a time, or they could all fit under its quotas together. A
+				// quota can cover every kmake in the namespace
+				unlock := r.starting.Lock(kmake.GetNamespace())
+				defer unlock()
+
+				// wait for the scheduler to be resumed
+				if !instance.HasStarted() {
+					held, err := r.schedulerHolds(ctx, instance)
+					if err != nil {
+						return reconcile.Result{}, err
+					}
+					if held {
+						err = r.Event(ctx, instance, bythepowerofv1.Wait, bythepowerofv1.Schedule, "suspended")
+						return ctrl.Result{RequeueAfter: config.Requeue.Wait.Duration}, err
+					}
+				}
+
+				// wait for room under the kmake's quotas
+				if !instance.HasStarted() {
+					reason, err := r.quotaExceeded(ctx, kmake, requiredjob)
+					if err != nil {
+						return reconcile.Result{}, err
+					}
+					if reason != "" {
+						err = r.Event(ctx, instance, bythepowerofv1.Wait, bythepowerofv1.Quota, reason)
+						return ctrl.Result{RequeueAfter: config.Requeue.Wait.Duration}, err
+					}
+				}
+
+				// only the newest schedule run of a run should be going, once
+				// this one isn't waiting to start
+				if err = r.supersede(ctx, instance); err != nil {
+					return reconcile.Result{}, err
+				}
+
+				// ask make if there's anything to do first
+				if run.Spec.KmakeRunOperation.Job.UpToDateCheck {
+					checking, err := r.upToDateCheck(ctx, instance, run, requiredjob)
+					if checking || err != nil {
+						return reconcile.Result{}, err
+					}
+				}
+
+				// or a job per target, if there are any to fan out
+				if run.Spec.KmakeRunOperation.Job.FanOut {
+					fanned, result, err := r.fanOut(ctx, instance, run, kmake, requiredjob)
+					if fanned || err != nil {
+						return result, err
+					}
+				}
+
+				// create it, or find the one we made before
 				err = r.Create(ctx, requiredjob)
-				if err != nil {
-					r.Event(instance, bythepowerofv1.Error, bythepowerofv1.Job, requiredjob.ObjectMeta.Name)
+				if err != nil && !errors.IsAlreadyExists(err) {
+					r.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.Job, requiredjob.ObjectMeta.Name)
 					return reconcile.Result{}, err
 				}
-				r.Event(instance, bythepowerofv1.Provision, bythepowerofv1.Job, requiredjob.ObjectMeta.Name)
+				r.Event(ctx, instance, bythepowerofv1.Provision, bythepowerofv1.Job, requiredjob.ObjectMeta.Name)
 				return reconcile.Result{}, nil
 			}
 			if run.Spec.KmakeRunOperation.Dummy != nil {
-				err := r.Event(instance, bythepowerofv1.Success, bythepowerofv1.Dummy, instance.GetName())
+				err := r.Event(ctx, instance, bythepowerofv1.Success, bythepowerofv1.Dummy, instance.GetName())
 				return reconcile.Result{}, err
 			}
 			if run.Spec.KmakeRunOperation.FileWait != nil {
-				err := r.Event(instance, bythepowerofv1.Success, bythepowerofv1.FileWait, instance.GetName())
+				err := r.Event(ctx, instance, bythepowerofv1.Success, bythepowerofv1.FileWait, instance.GetName())
 				return reconcile.Result{}, err
 			}
 
@@ -432,7 +557,7 @@ func (r *KmakeScheduleRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, e
 						client.InNamespace(req.NamespacedName.Namespace)})
 					labels = bythepowerofv1.SetDomainLabel(labels, bythepowerofv1.ScheduleInstLabel, si)
 				} else {
-					err = r.Event(instance, bythepowerofv1.Delete, bythepowerofv1.Runs, "No scheduler set")
+					err = r.Event(ctx, instance, bythepowerofv1.Delete, bythepowerofv1.Runs, "No scheduler set")
 					return reconcile.Result{}, fmt.Errorf("No scheduler set")
 				}
 
@@ -447,12 +572,12 @@ func (r *KmakeScheduleRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, e
 					if !errors.IsNotFound(err) {
 						return reconcile.Result{}, err
 					}
-					err = r.Event(instance, bythepowerofv1.Delete, bythepowerofv1.Runs, "No resources found")
+					err = r.Event(ctx, instance, bythepowerofv1.Delete, bythepowerofv1.Runs, "No resources found")
 					return reconcile.Result{}, err
 
 				}
 				// We can't do this as it will have been deleted if its a full reset!
-				// err = r.Event(instance, bythepowerofv1.Delete, bythepowerofv1.Runs, "")
+				// err = r.Event(ctx, instance, bythepowerofv1.Delete, bythepowerofv1.Runs, "")
 				// return reconcile.Result{}, err
 				return reconcile.Result{}, nil
 
@@ -463,30 +588,47 @@ func (r *KmakeScheduleRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, e
 				kmr := bythepowerofv1.GetDomainLabel(instance.Labels, bythepowerofv1.RunLabel)
 
 				if si == "" {
-					r.Event(instance, bythepowerofv1.Error, bythepowerofv1.Runs, "No scheduler set")
+					r.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.Runs, "No scheduler set")
 					return reconcile.Result{}, err
 				}
 				if kmr == "" {
-					r.Event(instance, bythepowerofv1.Error, bythepowerofv1.Runs, "No kmakerun set")
+					r.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.Runs, "No kmakerun set")
 					return reconcile.Result{}, err
 				}
 
+				labels := client.MatchingLabels{
+					bythepowerofv1.MakeDomainString(bythepowerofv1.ScheduleInstLabel): si,
+					bythepowerofv1.MakeDomainString(bythepowerofv1.RunLabel):          kmr,
+					bythepowerofv1.MakeDomainString(bythepowerofv1.WorkloadLabel):     "yes"}
+
+				// record why the running ones ended before they go
+				kmsrs := &bythepowerofv1.KmakeScheduleRunList{}
+				err = r.List(ctx, kmsrs, client.InNamespace(req.NamespacedName.Namespace), labels)
+				if err != nil {
+					return reconcile.Result{}, err
+				}
+				for i := range kmsrs.Items {
+					if kmsrs.Items[i].HasEnded() {
+						continue
+					}
+					if err = r.abort(ctx, &kmsrs.Items[i], bythepowerofv1.Cancelled); err != nil {
+						return reconcile.Result{}, err
+					}
+				}
+
 				do := &client.DeleteAllOfOptions{}
 				del := &bythepowerofv1.KmakeScheduleRun{}
 				do.ApplyOptions([]client.DeleteAllOfOption{
 					client.InNamespace(req.NamespacedName.Namespace),
-					client.MatchingLabels{
-						bythepowerofv1.MakeDomainString(bythepowerofv1.ScheduleInstLabel): si,
-						bythepowerofv1.MakeDomainString(bythepowerofv1.RunLabel):          kmr,
-						bythepowerofv1.MakeDomainString(bythepowerofv1.WorkloadLabel):     "yes"},
+					labels,
 				})
 
 				err = r.DeleteAllOf(ctx, del, do)
 				if err != nil {
-					r.Event(instance, bythepowerofv1.Error, bythepowerofv1.Runs, instance.GetName())
+					r.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.Runs, instance.GetName())
 					return reconcile.Result{}, err
 				}
-				r.Event(instance, bythepowerofv1.Stop, bythepowerofv1.Runs, instance.GetName())
+				r.Event(ctx, instance, bythepowerofv1.Stop, bythepowerofv1.Runs, instance.GetName())
 				return reconcile.Result{}, nil
 			}
 		case "restart":
@@ -495,11 +637,11 @@ func (r *KmakeScheduleRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, e
 				scheduler := bythepowerofv1.GetDomainLabel(instance.Labels, bythepowerofv1.ScheduleInstLabel)
 
 				if scheduler == "" {
-					r.Event(instance, bythepowerofv1.Error, bythepowerofv1.Runs, "No scheduler set")
+					r.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.Runs, "No scheduler set")
 					return reconcile.Result{}, err
 				}
 				if instance.Spec.Restart.Run == "" {
-					r.Event(instance, bythepowerofv1.Error, bythepowerofv1.Runs, "No kmakerun set")
+					r.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.Runs, "No kmakerun set")
 					return reconcile.Result{}, err
 				}
 
@@ -516,14 +658,14 @@ func (r *KmakeScheduleRunReconciler) Reconcile(req ctrl.Request) (ctrl.Result, e
 
 				err = r.DeleteAllOf(ctx, del, do)
 				if err != nil {
-					r.Event(instance, bythepowerofv1.Error, bythepowerofv1.Runs, instance.GetName())
+					r.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.Runs, instance.GetName())
 					return reconcile.Result{}, err
 				}
-				r.Event(instance, bythepowerofv1.Restart, bythepowerofv1.Runs, instance.GetName())
+				r.Event(ctx, instance, bythepowerofv1.Restart, bythepowerofv1.Runs, instance.GetName())
 				return reconcile.Result{}, nil
 			}
 		default:
-			r.Event(instance, bythepowerofv1.Error, bythepowerofv1.Runs, "Unknown operation")
+			r.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.Runs, "Unknown operation")
 			return reconcile.Result{}, nil
 		}
 		break // because we only expect one key
@@ -537,7 +679,7 @@ func (r *KmakeScheduleRunReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	jobOwnerKey := ".metadata.controller"
 	apiGVStr := bythepowerofv1.GroupVersion.String()
 
-	if err := mgr.GetFieldIndexer().IndexField(&v1.Job{}, jobOwnerKey, func(rawObj runtime.Object) []string {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1.Job{}, jobOwnerKey, func(rawObj client.Object) []string {
 		// grab the job object, extract the owner...
 		job := rawObj.(*v1.Job)
 		owner := metav1.GetControllerOf(job)
@@ -558,5 +700,514 @@ func (r *KmakeScheduleRunReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&bythepowerofv1.KmakeScheduleRun{}).
 		Owns(&v1.Job{}).
+		// jobs in another namespace can't be owned so map them back by label
+		Watches(&v1.Job{}, handler.EnqueueRequestsFromMapFunc(crossNamespaceScheduleRun)).
+		// start waiting runs as soon as their kmake is ready
+		Watches(&bythepowerofv1.Kmake{},
+			handler.EnqueueRequestsFromMapFunc(r.kmakeScheduleRuns),
+			builder.WithPredicates(predicate.Funcs{
+				UpdateFunc: func(e event.UpdateEvent) bool {
+					old, ok := e.ObjectOld.(*bythepowerofv1.Kmake)
+					if !ok {
+						return false
+					}
+					new, ok := e.ObjectNew.(*bythepowerofv1.Kmake)
+					if !ok {
+						return false
+					}
+					return old.IsReady() != new.IsReady() ||
+						old.Status.GetSubReference(bythepowerofv1.PVC) != new.Status.GetSubReference(bythepowerofv1.PVC) ||
+						old.Annotations[bythepowerofv1.MakeDomainString(bythepowerofv1.AllowedNamespacesLabel)] !=
+							new.Annotations[bythepowerofv1.MakeDomainString(bythepowerofv1.AllowedNamespacesLabel)]
+				},
+			})).
+		WithEventFilter(r.Scope.Predicate(mgr.GetClient())).
+		WithOptions(r.Config.Get().Controller("KmakeScheduleRun")).
 		Complete(r)
 }
+
+// kmakeScheduleRuns maps a kmake to the schedule runs of it that haven't
+// finished, in any namespace
+func (r *KmakeScheduleRunReconciler) kmakeScheduleRuns(ctx context.Context, o client.Object) []reconcile.Request {
+	kmsrs := &bythepowerofv1.KmakeScheduleRunList{}
+	err := r.List(ctx, kmsrs,
+		client.MatchingLabels{
+			bythepowerofv1.MakeDomainString(bythepowerofv1.KmakeLabel):    o.GetName(),
+			bythepowerofv1.MakeDomainString(bythepowerofv1.WorkloadLabel): "yes",
+		})
+	if err != nil {
+		logf.FromContext(ctx).Error(err, fmt.Sprintf("unable to list schedule runs for kmake %v", o.GetName()))
+		return nil
+	}
+
+	ret := make([]reconcile.Request, 0)
+	for _, kmsr := range kmsrs.Items {
+		if kmsr.HasEnded() || kmsr.GetKmakeNamespace() != o.GetNamespace() {
+			continue
+		}
+		ret = append(ret, reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: kmsr.GetNamespace(),
+			Name:      kmsr.GetName(),
+		}})
+	}
+	return ret
+}
+
+// crossNamespaceScheduleRun maps a child in a kmake namespace back to the
+// schedule run it was made for
+func crossNamespaceScheduleRun(ctx context.Context, o client.Object) []reconcile.Request {
+	labels := o.GetLabels()
+	namespace := bythepowerofv1.GetDomainLabel(labels, bythepowerofv1.ScheduleRunNamespaceLabel)
+	name := bythepowerofv1.GetDomainLabel(labels, bythepowerofv1.ScheduleRunLabel)
+
+	if namespace == "" || name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{
+		Namespace: namespace,
+		Name:      name,
+	}}}
+}
+
+// setChildOwner labels a child with the schedule run and makes the schedule
+// run its controller. Owner references can't cross namespaces so children in
+// another kmake namespace are owned by the kmake and found by label instead
+func (r *KmakeScheduleRunReconciler) setChildOwner(instance *bythepowerofv1.KmakeScheduleRun, kmake *bythepowerofv1.Kmake, object metav1.Object) error {
+	object.SetLabels(bythepowerofv1.SetDomainLabel(object.GetLabels(), bythepowerofv1.ScheduleRunLabel, instance.GetName()))
+
+	if instance.IsCrossNamespace() {
+		object.SetLabels(bythepowerofv1.SetDomainLabel(object.GetLabels(), bythepowerofv1.ScheduleRunNamespaceLabel, instance.GetNamespace()))
+		return SetOwnerReference(kmake, object, r.Scheme)
+	}
+	return ctrl.SetControllerReference(instance, object, r.Scheme)
+}
+
+// copyScheduleEnv copies the schedule env, with the run's variable overrides,
+// into the kmake namespace and returns the name of the copy
+func (r *KmakeScheduleRunReconciler) copyScheduleEnv(ctx context.Context, instance *bythepowerofv1.KmakeScheduleRun, kmake *bythepowerofv1.Kmake, childName types.NamespacedName, name string) (string, error) {
+
+	schedenv := &corev1.ConfigMap{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: instance.GetNamespace(), Name: name}, schedenv)
+	if err != nil {
+		return name, err
+	}
+
+	data := map[string]string{}
+	for k, v := range schedenv.Data {
+		data[k] = v
+	}
+	for k, v := range instance.Spec.Start.Variables {
+		data[k] = v
+	}
+
+	envcopy := &corev1.ConfigMap{}
+	meta := ObjectMetaConcat(instance, childName, bythepowerofv1.SchEnvMap)
+	_, err = reconciler.Ensure(ctx, r.kind(), instance, bythepowerofv1.SchEnvMap, envcopy, meta, func(cm *corev1.ConfigMap) error {
+		cm.Data = data
+		return r.setChildOwner(instance, kmake, cm)
+	})
+	if err != nil {
+		return name, err
+	}
+	return envcopy.GetName(), nil
+}
+
+// expire deletes an ended schedule run once its TTL is up. The scheduler
+// that made it remembers the run was done without it
+func (r *KmakeScheduleRunReconciler) expire(ctx context.Context, instance *bythepowerofv1.KmakeScheduleRun) (ctrl.Result, error) {
+
+	expiry, ok := instance.Expiry()
+	if !ok {
+		return ctrl.Result{}, nil
+	}
+	if left := time.Until(expiry); left > 0 {
+		return ctrl.Result{RequeueAfter: left}, nil
+	}
+
+	logf.FromContext(ctx).Info(fmt.Sprintf("Deleting expired schedule run %v", instance.GetName()))
+	return ctrl.Result{}, ignoreNotFound(r.Delete(ctx, instance))
+}
+
+// ownerConfigMap creates the config map of owner patches for the job, or
+// brings the one from an earlier attempt up to date, and records it so
+// retries reuse it rather than leaking another
+func (r *KmakeScheduleRunReconciler) ownerConfigMap(ctx context.Context, instance *bythepowerofv1.KmakeScheduleRun, kmake *bythepowerofv1.Kmake, run *bythepowerofv1.KmakeRun, job *v1.Job, childName types.NamespacedName) (*corev1.ConfigMap, error) {
+
+	j, err := json.Marshal(job.OwnerReferences)
+	if err != nil {
+		return nil, err
+	}
+	y, err := yaml.Marshal(job.OwnerReferences)
+	if err != nil {
+		return nil, err
+	}
+	km, err := yaml.Marshal(NewOwnerReferencePatch(kmake, r.Scheme))
+	if err != nil {
+		return nil, err
+	}
+	kmr, err := yaml.Marshal(NewOwnerReferencePatch(run, r.Scheme))
+	if err != nil {
+		return nil, err
+	}
+	kms, err := yaml.Marshal(NewOwnerReferencePatch(instance, r.Scheme))
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]string{
+		"owner.yaml":                         string(y),
+		"owner.json":                         string(j),
+		"kmake-owner-patch.yaml":             string(km),
+		"kmakerun-owner-patch.yaml":          string(kmr),
+		"kmake-schedulerun-owner-patch.yaml": string(kms),
+	}
+
+	ownerconfigmap := &corev1.ConfigMap{}
+	meta := ObjectMetaConcat(instance, childName, bythepowerofv1.Owner)
+	outcome, err := reconciler.Ensure(ctx, r.kind(), instance, bythepowerofv1.Owner, ownerconfigmap, meta, func(cm *corev1.ConfigMap) error {
+		cm.Data = data
+		return r.setChildOwner(instance, kmake, cm)
+	})
+	if err != nil || outcome == reconciler.Unchanged {
+		return ownerconfigmap, err
+	}
+
+	// remember it before making the job so a failed attempt finds it again
+	instance.Status.UpdateSubResource(bythepowerofv1.Owner, ownerconfigmap.GetName())
+	return ownerconfigmap, r.Status().Update(ctx, instance)
+}
+
+// abort ends the schedule run, saying why, and then stops its job
+func (r *KmakeScheduleRunReconciler) abort(ctx context.Context, instance *bythepowerofv1.KmakeScheduleRun, reason bythepowerofv1.AbortReason) error {
+	logf.FromContext(ctx).Info(fmt.Sprintf("Aborting schedule run %v: %v", instance.GetName(), reason.String()))
+
+	if err := r.Event(ctx, instance, bythepowerofv1.Abort, bythepowerofv1.Main, reason.String()); err != nil {
+		return err
+	}
+	return r.stopJob(ctx, instance)
+}
+
+// stopJob deletes the schedule run's jobs, and its up to date check, if they
+// haven't finished. One without pods yet would start them after we've ended
+func (r *KmakeScheduleRunReconciler) stopJob(ctx context.Context, instance *bythepowerofv1.KmakeScheduleRun) error {
+
+	keys := []types.NamespacedName{
+		instance.Status.NamespacedNameConcat(bythepowerofv1.Job, instance.GetKmakeNamespace()),
+		{Namespace: instance.GetKmakeNamespace(), Name: ChildName(instance, instance.GetName(), bythepowerofv1.Check)},
+	}
+	for target := range instance.Status.Targets {
+		keys = append(keys, types.NamespacedName{
+			Namespace: instance.GetKmakeNamespace(),
+			Name:      ChildName(instance, instance.GetName(), bythepowerofv1.Job, target),
+		})
+	}
+
+	for _, key := range keys {
+		if key.Name == "" {
+			continue
+		}
+		job := &v1.Job{}
+		if err := r.Get(ctx, key, job); err != nil {
+			if ignoreNotFound(err) != nil {
+				return err
+			}
+			continue
+		}
+		if bythepowerofv1.IsJobFinished(job) {
+			continue
+		}
+		if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); ignoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upToDateCheck runs the job as make -q before the job itself and ends the
+// schedule run as a success if nothing needs making. It is true while the
+// check is going or once it has ended the schedule run
+func (r *KmakeScheduleRunReconciler) upToDateCheck(ctx context.Context, instance *bythepowerofv1.KmakeScheduleRun, run *bythepowerofv1.KmakeRun, job *v1.Job) (bool, error) {
+
+	checkjob := job.DeepCopy()
+	checkjob.SetName(ChildName(instance, instance.GetName(), bythepowerofv1.Check))
+
+	currentjob := &v1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: checkjob.GetNamespace(), Name: checkjob.GetName()}, currentjob)
+	if errors.IsNotFound(err) {
+		// make -q exits non-zero when anything needs making, so don't retry it
+		args := append([]string{}, run.Spec.KmakeRunOperation.Job.Template.Spec.Containers[0].Args...)
+		args = append(args, "-q")
+		checkjob.Spec.Template.Spec.Containers[0].Args = append(args, run.Spec.KmakeRunOperation.Job.Targets...)
+		backoffLimit := int32(0)
+		checkjob.Spec.BackoffLimit = &backoffLimit
+
+		err = r.Create(ctx, checkjob)
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return true, err
+		}
+		return true, r.Event(ctx, instance, bythepowerofv1.Provision, bythepowerofv1.Check, checkjob.GetName())
+	}
+	if err != nil {
+		return true, err
+	}
+
+	if currentjob.Status.Succeeded > 0 {
+		upToDateRuns.WithLabelValues(instance.GetNamespace(), instance.GetKmakeName()).Inc()
+		return true, r.Event(ctx, instance, bythepowerofv1.Success, bythepowerofv1.Check, bythepowerofv1.UpToDate)
+	}
+	if currentjob.Status.Failed > 0 {
+		// something needs making
+		return false, nil
+	}
+	return true, nil
+}
+
+// supersede aborts any older schedule runs of the same run still going
+func (r *KmakeScheduleRunReconciler) supersede(ctx context.Context, instance *bythepowerofv1.KmakeScheduleRun) error {
+	si := bythepowerofv1.GetDomainLabel(instance.Labels, bythepowerofv1.ScheduleInstLabel)
+	if si == "" {
+		return nil
+	}
+
+	kmsrs := &bythepowerofv1.KmakeScheduleRunList{}
+	err := r.live().List(ctx, kmsrs,
+		client.InNamespace(instance.GetNamespace()),
+		client.MatchingLabels{
+			bythepowerofv1.MakeDomainString(bythepowerofv1.ScheduleInstLabel): si,
+			bythepowerofv1.MakeDomainString(bythepowerofv1.RunLabel):          instance.GetKmakeRunName(),
+			bythepowerofv1.MakeDomainString(bythepowerofv1.WorkloadLabel):     "yes",
+		})
+	if err != nil {
+		return err
+	}
+	// only those of our scheduler, one of another kind can share its name
+	owner := metav1.GetControllerOf(instance)
+	for i := range kmsrs.Items {
+		kmsr := &kmsrs.Items[i]
+		if kmsr.GetName() == instance.GetName() || kmsr.HasEnded() ||
+			!kmsr.CreationTimestamp.Before(&instance.CreationTimestamp) {
+			continue
+		}
+		if ref := metav1.GetControllerOf(kmsr); owner != nil && (ref == nil || ref.UID != owner.UID) {
+			continue
+		}
+		if err = r.abort(ctx, kmsr, bythepowerofv1.Superseded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fanOut runs a job per target, each once the targets it needs have succeeded,
+// and ends the schedule run when they have all succeeded or one has failed.
+// It's false, having done nothing, when there are no targets to fan out, as
+// when they're all pattern rules, so the one job runs instead. Each target
+// job waits for room under the kmake's quotas. The run's deadline is for all
+// of them, from when it started, and it's aborted when that passes
+func (r *KmakeScheduleRunReconciler) fanOut(ctx context.Context, instance *bythepowerofv1.KmakeScheduleRun, run *bythepowerofv1.KmakeRun, kmake *bythepowerofv1.Kmake, job *v1.Job) (bool, ctrl.Result, error) {
+
+	fanout, err := kmake.Spec.ToGraph().FanOut(run.Spec.KmakeRunOperation.Job.Targets...)
+	if err != nil {
+		return true, ctrl.Result{}, r.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.Job, err.Error())
+	}
+	if len(fanout) == 0 {
+		return false, ctrl.Result{}, nil
+	}
+
+	rwx := false
+	for _, mode := range kmake.Spec.PersistentVolumeClaimTemplate.AccessModes {
+		rwx = rwx || mode == corev1.ReadWriteMany
+	}
+	if !rwx {
+		return true, ctrl.Result{}, r.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.PVC, "fan out needs ReadWriteMany")
+	}
+
+	// find how each target is doing
+	phases := map[string]string{}
+	timedOut := false
+	for _, target := range fanout.Targets() {
+		currentjob := &v1.Job{}
+		err = r.Get(ctx, types.NamespacedName{
+			Namespace: instance.GetKmakeNamespace(),
+			Name:      ChildName(instance, instance.GetName(), bythepowerofv1.Job, target),
+		}, currentjob)
+
+		switch {
+		case errors.IsNotFound(err):
+			phases[target] = bythepowerofv1.Wait.String()
+		case err != nil:
+			return true, ctrl.Result{}, err
+		case currentjob.Status.Succeeded > 0:
+			phases[target] = bythepowerofv1.Success.String()
+		case isDeadlineExceeded(currentjob):
+			timedOut = true
+			phases[target] = bythepowerofv1.Error.String()
+		case isJobFailed(currentjob):
+			phases[target] = bythepowerofv1.Error.String()
+		default:
+			phases[target] = bythepowerofv1.Active.String()
+		}
+	}
+
+	// the deadline is for the run as a whole, from when it started, each
+	// target job only gets what's left of it
+	result := ctrl.Result{}
+	if deadline := job.Spec.ActiveDeadlineSeconds; deadline != nil {
+		started := time.Now()
+		if instance.Status.StartTime != nil {
+			started = instance.Status.StartTime.Time
+		}
+		left := time.Until(started.Add(time.Duration(*deadline) * time.Second))
+		if timedOut || left <= 0 {
+			return true, ctrl.Result{}, r.abort(ctx, instance, bythepowerofv1.Timeout)
+		}
+		seconds := int64(math.Ceil(left.Seconds()))
+		job = job.DeepCopy()
+		job.Spec.ActiveDeadlineSeconds = &seconds
+		result.RequeueAfter = left
+	}
+
+	// start the ones that can go, telling make their prereqs are done
+	held := ""
+	for _, target := range fanout.Ready(phases) {
+		targetjob := job.DeepCopy()
+		targetjob.SetName(ChildName(instance, instance.GetName(), bythepowerofv1.Job, target))
+		targetjob.SetLabels(bythepowerofv1.SetDomainLabel(targetjob.GetLabels(), bythepowerofv1.TargetLabel, target))
+
+		args := append([]string{}, run.Spec.KmakeRunOperation.Job.Template.Spec.Containers[0].Args...)
+		for _, p := range fanout[target] {
+			args = append(args, "-o", p)
+		}
+		targetjob.Spec.Template.Spec.Containers[0].Args = append(args, target)
+
+		held, err = r.quotaExceeded(ctx, kmake, targetjob)
+		if err != nil {
+			return true, ctrl.Result{}, err
+		}
+		if held != "" {
+			break
+		}
+
+		err = r.Create(ctx, targetjob)
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return true, ctrl.Result{}, err
+		}
+		phases[target] = bythepowerofv1.Active.String()
+	}
+
+	if !equality.Semantic.DeepEqual(instance.Status.Targets, phases) {
+		instance.Status.Targets = phases
+		if err = r.Status().Update(ctx, instance); err != nil {
+			return true, ctrl.Result{}, err
+		}
+	}
+
+	done := 0
+	for _, target := range fanout.Targets() {
+		switch phases[target] {
+		case bythepowerofv1.Error.String():
+			// no point carrying on with the others
+			if err = r.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.Target, target); err != nil {
+				return true, ctrl.Result{}, err
+			}
+			return true, ctrl.Result{}, r.stopJob(ctx, instance)
+		case bythepowerofv1.Success.String():
+			done++
+		}
+	}
+	if done == len(fanout) {
+		return true, ctrl.Result{}, r.Event(ctx, instance, bythepowerofv1.Success, bythepowerofv1.Target, fmt.Sprintf("%d/%d", done, len(fanout)))
+	}
+
+	// look again for room, the jobs taking it may not be ours
+	if held != "" {
+		wait := result
+		if d := r.Config.Get().Requeue.Wait.Duration; wait.RequeueAfter == 0 || d < wait.RequeueAfter {
+			wait.RequeueAfter = d
+		}
+		active := false
+		for _, phase := range phases {
+			active = active || phase == bythepowerofv1.Active.String()
+		}
+		if !active {
+			return true, wait, r.Event(ctx, instance, bythepowerofv1.Wait, bythepowerofv1.Quota, held)
+		}
+		return true, wait, r.Event(ctx, instance, bythepowerofv1.Active, bythepowerofv1.Target, fmt.Sprintf("%d/%d", done, len(fanout)))
+	}
+	return true, result, r.Event(ctx, instance, bythepowerofv1.Active, bythepowerofv1.Target, fmt.Sprintf("%d/%d", done, len(fanout)))
+}
+
+// schedulerHolds is true if the now scheduler that made the schedule run is
+// suspended and holding its pending runs
+func (r *KmakeScheduleRunReconciler) schedulerHolds(ctx context.Context, instance *bythepowerofv1.KmakeScheduleRun) (bool, error) {
+	owner := metav1.GetControllerOf(instance)
+	if owner == nil || owner.APIVersion != bythepowerofv1.GroupVersion.String() || owner.Kind != "KmakeNowScheduler" {
+		return false, nil
+	}
+
+	scheduler := &bythepowerofv1.KmakeNowScheduler{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: instance.GetNamespace(), Name: owner.Name}, scheduler)
+	if err != nil {
+		return false, ignoreNotFound(err)
+	}
+	return scheduler.HoldsPending(), nil
+}
+
+// quotaExceeded says which quota on the kmake has no room for the job, if any
+func (r *KmakeScheduleRunReconciler) quotaExceeded(ctx context.Context, kmake *bythepowerofv1.Kmake, job *v1.Job) (string, error) {
+
+	quotas := &bythepowerofv1.KmakeQuotaList{}
+	err := r.List(ctx, quotas, client.InNamespace(kmake.GetNamespace()))
+	if err != nil {
+		return "", err
+	}
+
+	for _, quota := range quotas.Items {
+		if !quota.Applies(kmake.GetName()) {
+			continue
+		}
+
+		// what the quota covers, the jobs are labelled like their schedule runs
+		labels := client.MatchingLabels{
+			bythepowerofv1.MakeDomainString(bythepowerofv1.KmakeNamespaceLabel): kmake.GetNamespace(),
+		}
+		if quota.Spec.Kmake != "" {
+			labels[bythepowerofv1.MakeDomainString(bythepowerofv1.KmakeLabel)] = kmake.GetName()
+		}
+
+		// what the other workers started may not be cached yet
+		jobs := &v1.JobList{}
+		if err = r.live().List(ctx, jobs, client.InNamespace(kmake.GetNamespace()), labels); err != nil {
+			return "", err
+		}
+		kmsrs := &bythepowerofv1.KmakeScheduleRunList{}
+		if err = r.live().List(ctx, kmsrs, labels); err != nil {
+			return "", err
+		}
+
+		reason := quota.Exceeded(jobs.Items, kmsrs.Items, bythepowerofv1.JobRequests(&job.Spec.Template), time.Now())
+		if reason != "" {
+			return fmt.Sprintf("%v: %v", quota.GetName(), reason), nil
+		}
+	}
+	return "", nil
+}
+
+// isJobFailed is true once the job has given up, not when a pod it will
+// retry fails
+func isJobFailed(job *v1.Job) bool {
+	for _, c := range job.Status.Conditions {
+		if c.Type == v1.JobFailed && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+func isDeadlineExceeded(job *v1.Job) bool {
+	for _, c := range job.Status.Conditions {
+		if c.Type == v1.JobFailed && c.Status == corev1.ConditionTrue && c.Reason == "DeadlineExceeded" {
+			return true
+		}
+	}
+	return false
+}
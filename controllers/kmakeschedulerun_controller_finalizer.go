@@ -18,54 +18,45 @@ package controllers
 
 import (
 	"context"
-	"fmt"
 
 	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
 	v1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func (r *KmakeScheduleRunReconciler) addFinalizer(instance *bythepowerofv1.KmakeScheduleRun) error {
-	instance.AddFinalizer(bythepowerofv1.KmakeScheduleRunFinalizerName)
-	err := r.Update(context.Background(), instance)
-	if err != nil {
-		return fmt.Errorf("failed to update kmake schedule run finalizer: %v", err)
+// cleanup deletes the jobs and config maps the schedule run made, those in
+// the kmake's namespace when it's elsewhere aren't owned by it
+func (r *KmakeScheduleRunReconciler) cleanup(ctx context.Context, instance *bythepowerofv1.KmakeScheduleRun) error {
+	labels := client.MatchingLabels{}
+	labels = bythepowerofv1.SetDomainLabel(labels, bythepowerofv1.ScheduleRunLabel, instance.Name)
+	if instance.IsCrossNamespace() {
+		labels = bythepowerofv1.SetDomainLabel(labels, bythepowerofv1.ScheduleRunNamespaceLabel, instance.Namespace)
 	}
-	return nil
-}
-
-func (r *KmakeScheduleRunReconciler) handleFinalizer(instance *bythepowerofv1.KmakeScheduleRun) error {
-	if instance.HasFinalizer(bythepowerofv1.KmakeScheduleRunFinalizerName) {
-		// remove all jobs owned by us
-		del := &v1.Job{}
-
-		do := &client.DeleteAllOfOptions{}
-		do.ApplyOptions([]client.DeleteAllOfOption{
-			client.InNamespace(instance.Namespace)})
-		labels := client.MatchingLabels{}
-		labels = bythepowerofv1.SetDomainLabel(labels, bythepowerofv1.ScheduleRunLabel, instance.Name)
-
-		do.ApplyOptions([]client.DeleteAllOfOption{labels})
-
-		policy := metav1.DeletePropagationBackground
-		o := &client.DeleteAllOfOptions{DeleteOptions: client.DeleteOptions{PropagationPolicy: &policy}}
 
-		do.ApplyToDeleteAllOf(o)
+	// remove all jobs owned by us
+	if err := r.DeleteAllOf(ctx, &v1.Job{},
+		client.InNamespace(instance.GetKmakeNamespace()), labels,
+		client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil {
+		return err
+	}
 
-		if err := r.DeleteAllOf(context.Background(), del, do); err != nil {
-			return err
-		}
-		instance.RemoveFinalizer(bythepowerofv1.KmakeNowSchedulerFinalizerName)
-		if err := r.Update(context.Background(), instance); err != nil {
-			return err
-		}
-		instance.RemoveFinalizer(bythepowerofv1.KmakeScheduleRunFinalizerName)
-		if err := r.Update(context.Background(), instance); err != nil {
+	// the owner config map would outlive the job if the job was never made
+	owner := &corev1.ConfigMap{}
+	ownerKey := instance.Status.NamespacedNameConcat(bythepowerofv1.Owner, instance.GetKmakeNamespace())
+	if ownerKey.Name != "" {
+		owner.SetNamespace(ownerKey.Namespace)
+		owner.SetName(ownerKey.Name)
+		if err := ignoreNotFound(r.Delete(ctx, owner)); err != nil {
 			return err
 		}
+	}
 
+	// the kmake owns our config maps in its namespace so they'd outlive us
+	if instance.IsCrossNamespace() {
+		return r.DeleteAllOf(ctx, &corev1.ConfigMap{},
+			client.InNamespace(instance.GetKmakeNamespace()), labels)
 	}
-	// Our finalizer has finished, so the reconciler can do nothing.
 	return nil
 }
@@ -11,9 +11,12 @@ import (
 	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
 	v1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var _ = Describe("Controllers/KmakeRunController", func() {
@@ -136,7 +139,7 @@ var _ = Describe("Controllers/KmakeRunController", func() {
 				Spec: bythepowerofv1.KmakeSpec{
 					PersistentVolumeClaimTemplate: corev1.PersistentVolumeClaimSpec{
 						AccessModes: []corev1.PersistentVolumeAccessMode{"ReadWriteOnce"},
-						Resources: corev1.ResourceRequirements{
+						Resources: corev1.VolumeResourceRequirements{
 							Requests: *cap,
 						},
 						StorageClassName: &storageClass,
@@ -427,4 +430,731 @@ var _ = Describe("Controllers/KmakeRunController", func() {
 
 		})
 	})
+
+	Context("Kmake schedule run created before its kmake", func() {
+		It("Should start once the kmake is ready", func() {
+			key := types.NamespacedName{
+				Name:      "foo13",
+				Namespace: namespace,
+			}
+
+			By("Create kmake run and kmake schedule run")
+			Expect(k8sClient.Create(context.Background(), newTestKmakeRun("foo12", namespace, "kmake8"))).Should(Succeed())
+			Expect(k8sClient.Create(context.Background(), &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "schedenv2",
+					Namespace: namespace,
+				},
+			})).Should(Succeed())
+			Expect(k8sClient.Create(context.Background(), newTestKmakeScheduleRun("foo13", namespace, "kmake8", "foo12", "schedenv2"))).Should(Succeed())
+
+			By("waiting for the kmake")
+			Eventually(func() bool {
+				f := &bythepowerofv1.KmakeScheduleRun{}
+				k8sClient.Get(context.Background(), key, f)
+				return f.IsWaiting()
+			}, timeout, interval).Should(BeTrue())
+
+			By("Create kmake")
+			Expect(k8sClient.Create(context.Background(), newTestKmake("kmake8", namespace))).Should(Succeed())
+
+			name := ""
+			Eventually(func() string {
+				f := &bythepowerofv1.KmakeScheduleRun{}
+				k8sClient.Get(context.Background(), key, f)
+				name = f.Status.GetSubReference(bythepowerofv1.Job)
+				return name
+			}, timeout, interval).ShouldNot(BeEmpty())
+
+			Eventually(func() error {
+				return k8sClient.Get(context.Background(), types.NamespacedName{
+					Name:      name,
+					Namespace: namespace,
+				}, &v1.Job{})
+			}, timeout, interval).Should(Succeed())
+
+			f := &bythepowerofv1.KmakeScheduleRun{}
+			Expect(k8sClient.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(k8sClient.Delete(context.Background(), f)).Should(Succeed())
+		})
+	})
+
+	Context("Kmake schedule run whose job can't be created", func() {
+		It("Should make one owner config map and delete it with the run", func() {
+			key := types.NamespacedName{
+				Name:      "foo16",
+				Namespace: namespace,
+			}
+
+			ownerMaps := func() int {
+				cms := &corev1.ConfigMapList{}
+				k8sClient.List(context.Background(), cms,
+					client.InNamespace(namespace),
+					client.MatchingLabels{"bythepowerof.github.io/schedulerun": "foo16"})
+				return len(cms.Items)
+			}
+
+			By("Create kmake, a run with an invalid job and the kmake schedule run")
+			Expect(k8sClient.Create(context.Background(), newTestKmake("kmake10", namespace))).Should(Succeed())
+			kmakerun := newTestKmakeRun("foo15", namespace, "kmake10")
+			kmakerun.Spec.KmakeRunOperation.Job.Template.Spec.Containers[0].Name = ""
+			Expect(k8sClient.Create(context.Background(), kmakerun)).Should(Succeed())
+			Expect(k8sClient.Create(context.Background(), &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "schedenv3",
+					Namespace: namespace,
+				},
+			})).Should(Succeed())
+			Expect(k8sClient.Create(context.Background(), newTestKmakeScheduleRun("foo16", namespace, "kmake10", "foo15", "schedenv3"))).Should(Succeed())
+
+			Eventually(func() string {
+				f := &bythepowerofv1.KmakeScheduleRun{}
+				k8sClient.Get(context.Background(), key, f)
+				return f.Status.Status
+			}, timeout, interval).Should(HavePrefix("Error Job"))
+
+			By("Recording a single owner config map")
+			f := &bythepowerofv1.KmakeScheduleRun{}
+			Expect(k8sClient.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(f.Status.GetSubReference(bythepowerofv1.Owner)).To(HavePrefix("foo16-owner-"))
+			Consistently(ownerMaps, time.Second*5, interval).Should(Equal(1))
+
+			By("delete kmsr")
+			Expect(k8sClient.Delete(context.Background(), f)).Should(Succeed())
+			Eventually(ownerMaps, timeout, interval).Should(Equal(0))
+		})
+	})
+
+	Context("Kmake schedule run with a deadline that is cancelled", func() {
+		It("Should bound the job and abort with the reason", func() {
+			key := types.NamespacedName{
+				Name:      "foo18",
+				Namespace: namespace,
+			}
+			deadline := int64(60)
+
+			By("Create kmake, kmake run and kmake schedule run")
+			Expect(k8sClient.Create(context.Background(), newTestKmake("kmake11", namespace))).Should(Succeed())
+			kmakerun := newTestKmakeRun("foo17", namespace, "kmake11")
+			kmakerun.Spec.ActiveDeadlineSeconds = &deadline
+			Expect(k8sClient.Create(context.Background(), kmakerun)).Should(Succeed())
+			Expect(k8sClient.Create(context.Background(), &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "schedenv4",
+					Namespace: namespace,
+				},
+			})).Should(Succeed())
+			Expect(k8sClient.Create(context.Background(), newTestKmakeScheduleRun("foo18", namespace, "kmake11", "foo17", "schedenv4"))).Should(Succeed())
+
+			name := ""
+			Eventually(func() string {
+				f := &bythepowerofv1.KmakeScheduleRun{}
+				k8sClient.Get(context.Background(), key, f)
+				name = f.Status.GetSubReference(bythepowerofv1.Job)
+				return name
+			}, timeout, interval).ShouldNot(BeEmpty())
+
+			job := &v1.Job{}
+			Expect(k8sClient.Get(context.Background(), types.NamespacedName{Name: name, Namespace: namespace}, job)).Should(Succeed())
+			Expect(job.Spec.ActiveDeadlineSeconds).To(Equal(&deadline))
+
+			By("Cancelling it")
+			f := &bythepowerofv1.KmakeScheduleRun{}
+			Expect(k8sClient.Get(context.Background(), key, f)).Should(Succeed())
+			f.Spec.Cancel = true
+			Expect(k8sClient.Update(context.Background(), f)).Should(Succeed())
+
+			Eventually(func() string {
+				f := &bythepowerofv1.KmakeScheduleRun{}
+				k8sClient.Get(context.Background(), key, f)
+				return f.Status.Status
+			}, timeout, interval).Should(Equal("Abort Main (cancelled)"))
+
+			Expect(k8sClient.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(f.IsAborted()).To(BeTrue())
+			Expect(f.Status.CompletionTime).ToNot(BeNil())
+
+			By("Deleting the job, though it had no pods yet")
+			Eventually(func() bool {
+				err := k8sClient.Get(context.Background(), types.NamespacedName{Name: name, Namespace: namespace}, &v1.Job{})
+				return errors.IsNotFound(err)
+			}, timeout, interval).Should(BeTrue())
+
+			Expect(k8sClient.Delete(context.Background(), f)).Should(Succeed())
+		})
+	})
+
+	Context("Kmake schedule run with an up to date check", func() {
+		It("Should skip the job only when make has nothing to do", func() {
+			checkJob := func(name string) *v1.Job {
+				key := types.NamespacedName{Name: name, Namespace: namespace}
+				check := ""
+				Eventually(func() string {
+					f := &bythepowerofv1.KmakeScheduleRun{}
+					k8sClient.Get(context.Background(), key, f)
+					check = f.Status.GetSubReference(bythepowerofv1.Check)
+					return check
+				}, timeout, interval).ShouldNot(BeEmpty())
+
+				job := &v1.Job{}
+				Expect(k8sClient.Get(context.Background(), types.NamespacedName{Name: check, Namespace: namespace}, job)).Should(Succeed())
+				return job
+			}
+
+			By("Create kmake, kmake run and kmake schedule run")
+			Expect(k8sClient.Create(context.Background(), newTestKmake("kmake13", namespace))).Should(Succeed())
+			kmakerun := newTestKmakeRun("foo20", namespace, "kmake13")
+			kmakerun.Spec.Job.UpToDateCheck = true
+			Expect(k8sClient.Create(context.Background(), kmakerun)).Should(Succeed())
+			Expect(k8sClient.Create(context.Background(), &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "schedenv5",
+					Namespace: namespace,
+				},
+			})).Should(Succeed())
+			Expect(k8sClient.Create(context.Background(), newTestKmakeScheduleRun("foo21", namespace, "kmake13", "foo20", "schedenv5"))).Should(Succeed())
+
+			job := checkJob("foo21")
+			Expect(job.Spec.Template.Spec.Containers[0].Args).To(Equal([]string{"-f", "/usr/share/kmake/kmake.mk", "-q", "Rule1"}))
+
+			By("Finding the targets up to date")
+			job.Status.Succeeded = 1
+			Expect(k8sClient.Status().Update(context.Background(), job)).Should(Succeed())
+
+			Eventually(func() string {
+				f := &bythepowerofv1.KmakeScheduleRun{}
+				k8sClient.Get(context.Background(), types.NamespacedName{Name: "foo21", Namespace: namespace}, f)
+				return f.Status.Status
+			}, timeout, interval).Should(Equal("Success Check (UpToDate)"))
+
+			f := &bythepowerofv1.KmakeScheduleRun{}
+			Expect(k8sClient.Get(context.Background(), types.NamespacedName{Name: "foo21", Namespace: namespace}, f)).Should(Succeed())
+			Expect(f.Status.GetSubReference(bythepowerofv1.Job)).To(BeEmpty())
+
+			By("Running the job when something needs making")
+			Expect(k8sClient.Create(context.Background(), newTestKmakeScheduleRun("foo22", namespace, "kmake13", "foo20", "schedenv5"))).Should(Succeed())
+
+			job = checkJob("foo22")
+			job.Status.Failed = 1
+			Expect(k8sClient.Status().Update(context.Background(), job)).Should(Succeed())
+
+			Eventually(func() string {
+				f := &bythepowerofv1.KmakeScheduleRun{}
+				k8sClient.Get(context.Background(), types.NamespacedName{Name: "foo22", Namespace: namespace}, f)
+				return f.Status.GetSubReference(bythepowerofv1.Job)
+			}, timeout, interval).ShouldNot(BeEmpty())
+		})
+	})
+
+	Context("Kmake schedule run fanned out per target", func() {
+		It("Should run the targets in prerequisite order", func() {
+			key := types.NamespacedName{Name: "foo24", Namespace: namespace}
+
+			targetJob := func(target string) *v1.Job {
+				f := &bythepowerofv1.KmakeScheduleRun{}
+				Expect(k8sClient.Get(context.Background(), key, f)).Should(Succeed())
+				job := &v1.Job{}
+				Expect(k8sClient.Get(context.Background(), types.NamespacedName{
+					Name:      ChildName(f, f.GetName(), bythepowerofv1.Job, target),
+					Namespace: namespace,
+				}, job)).Should(Succeed())
+				return job
+			}
+			targets := func() map[string]string {
+				f := &bythepowerofv1.KmakeScheduleRun{}
+				k8sClient.Get(context.Background(), key, f)
+				return f.Status.Targets
+			}
+
+			By("Create kmake, kmake run and kmake schedule run")
+			kmake := newTestKmake("kmake14", namespace)
+			kmake.Spec.PersistentVolumeClaimTemplate.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}
+			kmake.Spec.Rules = []bythepowerofv1.KmakeRule{
+				bythepowerofv1.KmakeRule{Targets: []string{"Rule1"}, Prereqs: []string{"Rule2"}, Commands: []string{"@echo $@"}},
+				bythepowerofv1.KmakeRule{Targets: []string{"Rule2"}, Commands: []string{"@echo $@"}},
+			}
+			Expect(k8sClient.Create(context.Background(), kmake)).Should(Succeed())
+			kmakerun := newTestKmakeRun("foo23", namespace, "kmake14")
+			kmakerun.Spec.Job.FanOut = true
+			Expect(k8sClient.Create(context.Background(), kmakerun)).Should(Succeed())
+			Expect(k8sClient.Create(context.Background(), &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "schedenv6",
+					Namespace: namespace,
+				},
+			})).Should(Succeed())
+			Expect(k8sClient.Create(context.Background(), newTestKmakeScheduleRun("foo24", namespace, "kmake14", "foo23", "schedenv6"))).Should(Succeed())
+
+			Eventually(targets, timeout, interval).Should(Equal(map[string]string{"Rule1": "Wait", "Rule2": "Active"}))
+
+			By("Starting the target once its prereq is made")
+			job := targetJob("Rule2")
+			Expect(job.Spec.Template.Spec.Containers[0].Args).To(Equal([]string{"-f", "/usr/share/kmake/kmake.mk", "Rule2"}))
+			job.Status.Succeeded = 1
+			Expect(k8sClient.Status().Update(context.Background(), job)).Should(Succeed())
+
+			Eventually(targets, timeout, interval).Should(Equal(map[string]string{"Rule1": "Active", "Rule2": "Success"}))
+
+			job = targetJob("Rule1")
+			Expect(job.Spec.Template.Spec.Containers[0].Args).To(Equal([]string{"-f", "/usr/share/kmake/kmake.mk", "-o", "Rule2", "Rule1"}))
+			job.Status.Succeeded = 1
+			Expect(k8sClient.Status().Update(context.Background(), job)).Should(Succeed())
+
+			Eventually(func() string {
+				f := &bythepowerofv1.KmakeScheduleRun{}
+				k8sClient.Get(context.Background(), key, f)
+				return f.Status.Status
+			}, timeout, interval).Should(Equal("Success Target (2/2)"))
+		})
+	})
+
+	Context("Kmake schedule run over its kmake's quota", func() {
+		It("Should wait until there is room", func() {
+			key := types.NamespacedName{Name: "foo26", Namespace: namespace}
+			none := int32(0)
+
+			By("Create a quota with no room")
+			quota := &bythepowerofv1.KmakeQuota{
+				ObjectMeta: metav1.ObjectMeta{Name: "quota1", Namespace: namespace},
+				Spec: bythepowerofv1.KmakeQuotaSpec{
+					Kmake:         "kmake15",
+					MaxActiveJobs: &none,
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), quota)).Should(Succeed())
+
+			By("Create kmake, kmake run and kmake schedule run")
+			Expect(k8sClient.Create(context.Background(), newTestKmake("kmake15", namespace))).Should(Succeed())
+			Expect(k8sClient.Create(context.Background(), newTestKmakeRun("foo25", namespace, "kmake15"))).Should(Succeed())
+			Expect(k8sClient.Create(context.Background(), &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "schedenv7",
+					Namespace: namespace,
+				},
+			})).Should(Succeed())
+			Expect(k8sClient.Create(context.Background(), newTestKmakeScheduleRun("foo26", namespace, "kmake15", "foo25", "schedenv7"))).Should(Succeed())
+
+			Eventually(func() string {
+				f := &bythepowerofv1.KmakeScheduleRun{}
+				k8sClient.Get(context.Background(), key, f)
+				return f.Status.Status
+			}, timeout, interval).Should(Equal("Wait Quota (quota1: 0 active jobs)"))
+
+			f := &bythepowerofv1.KmakeScheduleRun{}
+			Expect(k8sClient.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(f.HasStarted()).To(BeFalse())
+
+			By("Making room")
+			Expect(k8sClient.Delete(context.Background(), quota)).Should(Succeed())
+
+			Eventually(func() string {
+				f := &bythepowerofv1.KmakeScheduleRun{}
+				k8sClient.Get(context.Background(), key, f)
+				return f.Status.GetSubReference(bythepowerofv1.Job)
+			}, timeout2, interval).ShouldNot(BeEmpty())
+		})
+	})
+
+	Context("Kmake schedule run of a suspended scheduler", func() {
+		It("Should wait until the scheduler is resumed", func() {
+			key := types.NamespacedName{Name: "foo30", Namespace: namespace}
+			kmnskey := types.NamespacedName{Name: "foo31", Namespace: namespace}
+
+			By("Create a scheduler holding its pending runs")
+			kmns := &bythepowerofv1.KmakeNowScheduler{
+				ObjectMeta: metav1.ObjectMeta{Name: kmnskey.Name, Namespace: namespace},
+				Spec: bythepowerofv1.KmakeNowSchedulerSpec{
+					Monitor:        []string{"held"},
+					Suspend:        true,
+					SuspendPending: true,
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), kmns)).Should(Succeed())
+
+			By("Create kmake, kmake run and kmake schedule run")
+			Expect(k8sClient.Create(context.Background(), newTestKmake("kmake17", namespace))).Should(Succeed())
+			Expect(k8sClient.Create(context.Background(), newTestKmakeRun("foo29", namespace, "kmake17"))).Should(Succeed())
+			Expect(k8sClient.Create(context.Background(), &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "schedenv8",
+					Namespace: namespace,
+				},
+			})).Should(Succeed())
+
+			kmsr := newTestKmakeScheduleRun(key.Name, namespace, "kmake17", "foo29", "schedenv8")
+			Expect(ctrl.SetControllerReference(kmns, kmsr, scheme)).Should(Succeed())
+			Expect(k8sClient.Create(context.Background(), kmsr)).Should(Succeed())
+
+			Eventually(func() string {
+				f := &bythepowerofv1.KmakeScheduleRun{}
+				k8sClient.Get(context.Background(), key, f)
+				return f.Status.Status
+			}, timeout, interval).Should(Equal("Wait Schedule (suspended)"))
+
+			f := &bythepowerofv1.KmakeScheduleRun{}
+			Expect(k8sClient.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(f.HasStarted()).To(BeFalse())
+
+			By("Resuming the scheduler")
+			Expect(k8sClient.Get(context.Background(), kmnskey, kmns)).Should(Succeed())
+			kmns.Spec.Suspend = false
+			Expect(k8sClient.Update(context.Background(), kmns)).Should(Succeed())
+
+			Eventually(func() string {
+				f := &bythepowerofv1.KmakeScheduleRun{}
+				k8sClient.Get(context.Background(), key, f)
+				return f.Status.GetSubReference(bythepowerofv1.Job)
+			}, timeout2, interval).ShouldNot(BeEmpty())
+		})
+	})
+
+	Context("Kmake schedule run of a kmake in another namespace", func() {
+		It("Should not run the job as a service account of the kmake namespace", func() {
+			key := types.NamespacedName{Name: "foo40", Namespace: "tenant"}
+
+			kmake := newReadyTestKmake("kmake20", "platform")
+			kmake.Annotations = map[string]string{"bythepowerof.github.io/allowed-namespaces": "tenant"}
+
+			run := newTestKmakeRun("foo39", "tenant", "")
+			run.Labels = nil
+			run.Spec.KmakeRef = &bythepowerofv1.KmakeReference{Name: "kmake20", Namespace: "platform"}
+			automount := true
+			run.Spec.KmakeRunOperation.Job.Template.Spec.ServiceAccountName = "platform-admin"
+			run.Spec.KmakeRunOperation.Job.Template.Spec.AutomountServiceAccountToken = &automount
+
+			kmsr := newTestKmakeScheduleRun(key.Name, "tenant", "kmake20", "foo39", "schedenv9")
+			kmsr.Labels = bythepowerofv1.SetDomainLabel(kmsr.Labels, bythepowerofv1.KmakeNamespaceLabel, "platform")
+
+			r, c := newFakeScheduleRunReconciler(kmake, run, kmsr, &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "schedenv9", Namespace: "tenant"},
+			})
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+			Expect(err).ToNot(HaveOccurred())
+
+			f := &bythepowerofv1.KmakeScheduleRun{}
+			Expect(c.Get(context.Background(), key, f)).Should(Succeed())
+			job := &v1.Job{}
+			Expect(c.Get(context.Background(), types.NamespacedName{
+				Namespace: "platform",
+				Name:      f.Status.GetSubReference(bythepowerofv1.Job),
+			}, job)).Should(Succeed())
+			Expect(job.Spec.Template.Spec.ServiceAccountName).To(BeEmpty())
+			Expect(job.Spec.Template.Spec.AutomountServiceAccountToken).To(Equal(new(bool)))
+		})
+	})
+
+	Context("Kmake schedule run whose job retries a failed pod", func() {
+		It("Should keep going with the same owner config map", func() {
+			key := types.NamespacedName{Name: "foo42", Namespace: namespace}
+
+			r, c := newFakeScheduleRunReconciler(
+				newReadyTestKmake("kmake21", namespace),
+				newTestKmakeRun("foo41", namespace, "kmake21"),
+				newTestKmakeScheduleRun(key.Name, namespace, "kmake21", "foo41", "schedenv10"),
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "schedenv10", Namespace: namespace}},
+			)
+			reconcileKmsr := func() *bythepowerofv1.KmakeScheduleRun {
+				_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+				Expect(err).ToNot(HaveOccurred())
+				f := &bythepowerofv1.KmakeScheduleRun{}
+				Expect(c.Get(context.Background(), key, f)).Should(Succeed())
+				return f
+			}
+			ownerMaps := func() []corev1.ConfigMap {
+				cms := &corev1.ConfigMapList{}
+				Expect(c.List(context.Background(), cms, client.InNamespace(namespace),
+					client.MatchingLabels{"bythepowerof.github.io/schedulerun": key.Name})).Should(Succeed())
+				return cms.Items
+			}
+			mounts := func(job *v1.Job, name string) bool {
+				for _, v := range job.Spec.Template.Spec.Volumes {
+					if v.ConfigMap != nil && v.ConfigMap.Name == name {
+						return true
+					}
+				}
+				return false
+			}
+
+			By("Starting the job")
+			f := reconcileKmsr()
+			Expect(f.Status.GetSubReference(bythepowerofv1.Job)).ToNot(BeEmpty())
+			owner := f.Status.GetSubReference(bythepowerofv1.Owner)
+			Expect(owner).ToNot(BeEmpty())
+
+			job := &v1.Job{}
+			Expect(c.Get(context.Background(), types.NamespacedName{
+				Namespace: namespace,
+				Name:      f.Status.GetSubReference(bythepowerofv1.Job),
+			}, job)).Should(Succeed())
+			Expect(mounts(job, owner)).To(BeTrue())
+
+			By("Failing a pod the job will retry")
+			backoffLimit := int32(2)
+			job.Spec.BackoffLimit = &backoffLimit
+			Expect(c.Update(context.Background(), job)).Should(Succeed())
+			job.Status.Failed = 1
+			Expect(c.Status().Update(context.Background(), job)).Should(Succeed())
+			f = reconcileKmsr()
+			Expect(f.HasEnded()).To(BeFalse())
+
+			By("Retrying")
+			job.Status.Active = 1
+			Expect(c.Status().Update(context.Background(), job)).Should(Succeed())
+			f = reconcileKmsr()
+			Expect(f.Status.Status).To(HavePrefix("Active Job"))
+
+			Expect(f.Status.GetSubReference(bythepowerofv1.Owner)).To(Equal(owner))
+			Expect(ownerMaps()).To(HaveLen(1))
+			Expect(ownerMaps()[0].GetName()).To(Equal(owner))
+			Expect(c.Get(context.Background(), client.ObjectKeyFromObject(job), job)).Should(Succeed())
+			Expect(mounts(job, owner)).To(BeTrue())
+
+			By("Ending in error only once the job gives up")
+			job.Status.Active = 0
+			job.Status.Failed = 3
+			job.Status.Conditions = []v1.JobCondition{{Type: v1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded"}}
+			Expect(c.Status().Update(context.Background(), job)).Should(Succeed())
+			f = reconcileKmsr()
+			Expect(f.Status.Status).To(HavePrefix("Error Job"))
+		})
+	})
+
+	Context("Kmake schedule run cancelled before its job has pods", func() {
+		It("Should delete the job but leave a finished one", func() {
+			key := types.NamespacedName{Name: "foo44", Namespace: namespace}
+
+			r, c := newFakeScheduleRunReconciler(
+				newReadyTestKmake("kmake22", namespace),
+				newTestKmakeRun("foo43", namespace, "kmake22"),
+				newTestKmakeScheduleRun(key.Name, namespace, "kmake22", "foo43", "schedenv11"),
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "schedenv11", Namespace: namespace}},
+			)
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+			Expect(err).ToNot(HaveOccurred())
+
+			f := &bythepowerofv1.KmakeScheduleRun{}
+			Expect(c.Get(context.Background(), key, f)).Should(Succeed())
+			jobKey := types.NamespacedName{Namespace: namespace, Name: f.Status.GetSubReference(bythepowerofv1.Job)}
+			Expect(c.Get(context.Background(), jobKey, &v1.Job{})).Should(Succeed())
+
+			By("Leaving a finished job")
+			job := &v1.Job{}
+			Expect(c.Get(context.Background(), jobKey, job)).Should(Succeed())
+			job.Status.Conditions = []v1.JobCondition{{Type: v1.JobComplete, Status: corev1.ConditionTrue}}
+			Expect(c.Status().Update(context.Background(), job)).Should(Succeed())
+			Expect(r.stopJob(context.Background(), f)).Should(Succeed())
+			Expect(c.Get(context.Background(), jobKey, &v1.Job{})).Should(Succeed())
+
+			By("Deleting one with no pods yet")
+			job.Status.Conditions = nil
+			Expect(c.Status().Update(context.Background(), job)).Should(Succeed())
+			f.Spec.Cancel = true
+			Expect(c.Update(context.Background(), f)).Should(Succeed())
+			_, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(c.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(f.Status.Status).To(Equal("Abort Main (cancelled)"))
+			Expect(errors.IsNotFound(c.Get(context.Background(), jobKey, &v1.Job{}))).To(BeTrue())
+		})
+	})
+
+	Context("Kmake schedule run fanned out with no targets to fan out", func() {
+		It("Should run the one job", func() {
+			key := types.NamespacedName{Name: "foo59", Namespace: namespace}
+
+			// only a pattern rule, which is left to make
+			kmake := newReadyTestKmake("kmake26", namespace)
+			kmake.Spec.Rules = []bythepowerofv1.KmakeRule{
+				bythepowerofv1.KmakeRule{Targets: []string{"%.o"}, Prereqs: []string{"%.c"}, Commands: []string{"@echo $@"}},
+			}
+			kmakerun := newTestKmakeRun("foo58", namespace, "kmake26")
+			kmakerun.Spec.Job.FanOut = true
+
+			r, c := newFakeScheduleRunReconciler(kmake, kmakerun,
+				newTestKmakeScheduleRun(key.Name, namespace, "kmake26", "foo58", "schedenv13"),
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "schedenv13", Namespace: namespace}},
+			)
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+			Expect(err).ToNot(HaveOccurred())
+
+			f := &bythepowerofv1.KmakeScheduleRun{}
+			Expect(c.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(f.Status.Targets).To(BeEmpty())
+			Expect(f.Status.GetSubReference(bythepowerofv1.Job)).ToNot(BeEmpty())
+
+			jobs := &v1.JobList{}
+			Expect(c.List(context.Background(), jobs, client.InNamespace(namespace))).Should(Succeed())
+			Expect(jobs.Items).To(HaveLen(1))
+			Expect(jobs.Items[0].GetName()).To(Equal(f.Status.GetSubReference(bythepowerofv1.Job)))
+		})
+	})
+
+	Context("Kmake schedule run fanned out under a quota", func() {
+		It("Should start a target job only when there's room", func() {
+			key := types.NamespacedName{Name: "foo62", Namespace: namespace}
+			one := int32(1)
+
+			kmake := newReadyTestKmake("kmake28", namespace)
+			kmake.Spec.PersistentVolumeClaimTemplate.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}
+			kmake.Spec.Rules = []bythepowerofv1.KmakeRule{
+				bythepowerofv1.KmakeRule{Targets: []string{"all"}, Prereqs: []string{"Rule1", "Rule2"}},
+				bythepowerofv1.KmakeRule{Targets: []string{"Rule1"}, Commands: []string{"@echo $@"}},
+				bythepowerofv1.KmakeRule{Targets: []string{"Rule2"}, Commands: []string{"@echo $@"}},
+			}
+			kmakerun := newTestKmakeRun("foo61", namespace, "kmake28")
+			kmakerun.Spec.Job.FanOut = true
+			kmakerun.Spec.Job.Targets = []string{"Rule1", "Rule2"}
+
+			r, c := newFakeScheduleRunReconciler(kmake, kmakerun,
+				newTestKmakeScheduleRun(key.Name, namespace, "kmake28", "foo61", "schedenv14"),
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "schedenv14", Namespace: namespace}},
+				&bythepowerofv1.KmakeQuota{
+					ObjectMeta: metav1.ObjectMeta{Name: "quota3", Namespace: namespace},
+					Spec:       bythepowerofv1.KmakeQuotaSpec{Kmake: "kmake28", MaxActiveJobs: &one},
+				},
+			)
+			reconcile := func() {
+				var result ctrl.Result
+				for i := 0; i < 3; i++ {
+					var err error
+					result, err = r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+					Expect(err).ToNot(HaveOccurred())
+				}
+				// looking again for room
+				Expect(result.RequeueAfter).ToNot(BeZero())
+			}
+			jobs := func() []v1.Job {
+				l := &v1.JobList{}
+				Expect(c.List(context.Background(), l, client.InNamespace(namespace),
+					client.MatchingLabels{"bythepowerof.github.io/kmake": "kmake28"})).Should(Succeed())
+				return l.Items
+			}
+
+			By("Starting one target")
+			reconcile()
+			Expect(jobs()).To(HaveLen(1))
+			f := &bythepowerofv1.KmakeScheduleRun{}
+			Expect(c.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(f.Status.Targets).To(Equal(map[string]string{"Rule1": "Active", "Rule2": "Wait"}))
+			Expect(f.Status.StartTime).ToNot(BeNil())
+
+			By("Starting the other once the first is done")
+			job := jobs()[0]
+			job.Status.Succeeded = 1
+			job.Status.Conditions = []v1.JobCondition{{Type: v1.JobComplete, Status: corev1.ConditionTrue}}
+			Expect(c.Status().Update(context.Background(), &job)).Should(Succeed())
+
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(jobs()).To(HaveLen(2))
+			Expect(c.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(f.Status.Targets).To(Equal(map[string]string{"Rule1": "Success", "Rule2": "Active"}))
+		})
+	})
+
+	Context("Kmake schedule run fanned out with a deadline", func() {
+		var (
+			r   *KmakeScheduleRunReconciler
+			c   client.Client
+			key types.NamespacedName
+		)
+		start := func(name string, run string, kmakename string, schedenv string) {
+			key = types.NamespacedName{Name: name, Namespace: namespace}
+			deadline := int64(60)
+
+			kmake := newReadyTestKmake(kmakename, namespace)
+			kmake.Spec.PersistentVolumeClaimTemplate.AccessModes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteMany}
+			kmake.Spec.Rules = []bythepowerofv1.KmakeRule{
+				bythepowerofv1.KmakeRule{Targets: []string{"Rule1"}, Commands: []string{"@echo $@"}},
+				bythepowerofv1.KmakeRule{Targets: []string{"Rule2"}, Commands: []string{"@echo $@"}},
+			}
+			kmakerun := newTestKmakeRun(run, namespace, kmakename)
+			kmakerun.Spec.Job.FanOut = true
+			kmakerun.Spec.Job.Targets = []string{"Rule1", "Rule2"}
+			kmsr := newTestKmakeScheduleRun(key.Name, namespace, kmakename, run, schedenv)
+			kmsr.Spec.ActiveDeadlineSeconds = &deadline
+
+			r, c = newFakeScheduleRunReconciler(kmake, kmakerun, kmsr,
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: schedenv, Namespace: namespace}},
+			)
+			for i := 0; i < 3; i++ {
+				_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+				Expect(err).ToNot(HaveOccurred())
+			}
+		}
+		jobs := func(kmake string) []v1.Job {
+			l := &v1.JobList{}
+			Expect(c.List(context.Background(), l, client.InNamespace(namespace),
+				client.MatchingLabels{"bythepowerof.github.io/kmake": kmake})).Should(Succeed())
+			return l.Items
+		}
+
+		It("Should abort the whole run once it has gone on too long", func() {
+			start("foo66", "foo65", "kmake30", "schedenv15")
+			Expect(jobs("kmake30")).To(HaveLen(2))
+			for _, job := range jobs("kmake30") {
+				Expect(*job.Spec.ActiveDeadlineSeconds).To(BeNumerically("<=", 60))
+			}
+
+			By("Passing the deadline")
+			f := &bythepowerofv1.KmakeScheduleRun{}
+			Expect(c.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(f.Status.Status).To(HavePrefix("Active Target"))
+			started := metav1.NewTime(time.Now().Add(-2 * time.Minute))
+			f.Status.StartTime = &started
+			Expect(c.Status().Update(context.Background(), f)).Should(Succeed())
+
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(f.Status.Status).To(Equal("Abort Main (timeout)"))
+		})
+
+		It("Should abort the run when a target runs out of time", func() {
+			start("foo68", "foo67", "kmake31", "schedenv16")
+			job := jobs("kmake31")[0]
+			job.Status.Conditions = []v1.JobCondition{{Type: v1.JobFailed, Status: corev1.ConditionTrue, Reason: "DeadlineExceeded"}}
+			Expect(c.Status().Update(context.Background(), &job)).Should(Succeed())
+
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+			Expect(err).ToNot(HaveOccurred())
+			f := &bythepowerofv1.KmakeScheduleRun{}
+			Expect(c.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(f.Status.Status).To(Equal("Abort Main (timeout)"))
+		})
+	})
+
+	Context("Kmake schedule run superseding another under a quota", func() {
+		It("Should leave the older run going while the newer one waits", func() {
+			one := int32(1)
+			older := newTestKmakeScheduleRun("foo70", namespace, "kmake32", "foo69", "schedenv17")
+			older.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Minute).Truncate(time.Second))
+			newer := newTestKmakeScheduleRun("foo71", namespace, "kmake32", "foo69", "schedenv17")
+			newer.CreationTimestamp = metav1.NewTime(time.Now().Truncate(time.Second))
+
+			r, c := newFakeScheduleRunReconciler(
+				newReadyTestKmake("kmake32", namespace),
+				newTestKmakeRun("foo69", namespace, "kmake32"),
+				older, newer,
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "schedenv17", Namespace: namespace}},
+				&bythepowerofv1.KmakeQuota{
+					ObjectMeta: metav1.ObjectMeta{Name: "quota4", Namespace: namespace},
+					Spec:       bythepowerofv1.KmakeQuotaSpec{Kmake: "kmake32", MaxActiveJobs: &one},
+				},
+			)
+			reconcile := func(name string) *bythepowerofv1.KmakeScheduleRun {
+				key := types.NamespacedName{Name: name, Namespace: namespace}
+				_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+				Expect(err).ToNot(HaveOccurred())
+				f := &bythepowerofv1.KmakeScheduleRun{}
+				Expect(c.Get(context.Background(), key, f)).Should(Succeed())
+				return f
+			}
+
+			Expect(reconcile("foo70").Status.Status).To(HavePrefix("Provision Job"))
+			Expect(reconcile("foo71").Status.Status).To(HavePrefix("Wait Quota"))
+			Expect(reconcile("foo70").Status.Status).To(HavePrefix("Provision Job"))
+		})
+	})
 })
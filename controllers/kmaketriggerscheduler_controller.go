@@ -0,0 +1,371 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+	"github.com/bythepowerof/kmake-controller/controllerconfig"
+	"github.com/bythepowerof/kmake-controller/internal/reconciler"
+	"github.com/bythepowerof/kmake-controller/scope"
+)
+
+// KmakeTriggerSchedulerReconciler reconciles a KmakeTriggerScheduler object
+type KmakeTriggerSchedulerReconciler struct {
+	client.Client
+	Recorder record.EventRecorder
+	Scheme   *runtime.Scheme
+	Scope    *scope.Scope
+	Config   *controllerconfig.Store
+	// APIReader reads the secrets, which we only watch the metadata of so
+	// they're not all cached. Nil reads the cache
+	APIReader client.Reader
+}
+
+// secrets is the reader for the content of secrets
+func (r *KmakeTriggerSchedulerReconciler) secrets() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+// kind is how we handle trigger schedulers
+func (r *KmakeTriggerSchedulerReconciler) kind() *reconciler.Kind[*bythepowerofv1.KmakeTriggerScheduler] {
+	return &reconciler.Kind[*bythepowerofv1.KmakeTriggerScheduler]{
+		Client:    r.Client,
+		Recorder:  r.Recorder,
+		Scheme:    r.Scheme,
+		Finalizer: bythepowerofv1.KmakeTriggerSchedulerFinalizerName,
+		Cleanup:   cleanupScheduleRuns[*bythepowerofv1.KmakeTriggerScheduler](r.Client),
+	}
+}
+
+func (r *KmakeTriggerSchedulerReconciler) Event(ctx context.Context, instance *bythepowerofv1.KmakeTriggerScheduler, phase bythepowerofv1.Phase, subresource bythepowerofv1.SubResource, name string) error {
+	return r.kind().Event(ctx, instance, phase, subresource, name)
+}
+
+// +kubebuilder:rbac:groups=bythepowerof.github.com,resources=kmaketriggerschedulers,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=bythepowerof.github.com,resources=kmaketriggerschedulers/status,verbs=get;update;patch
+
+func (r *KmakeTriggerSchedulerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+
+	log := logf.FromContext(ctx)
+	requeue := ctrl.Result{Requeue: true}
+	backoff5 := ctrl.Result{RequeueAfter: r.Config.Get().Requeue.Scheduler.Duration}
+
+	instance := &bythepowerofv1.KmakeTriggerScheduler{}
+	err := r.Get(ctx, req.NamespacedName, instance)
+
+	log.Info(fmt.Sprintf("Starting reconcile loop for %v", req.NamespacedName))
+	defer log.Info(fmt.Sprintf("Finish reconcile loop for %v", req.NamespacedName))
+
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	done, err := r.kind().Finalize(ctx, instance)
+	if done {
+		return reconcile.Result{}, err
+	}
+
+	// env configmap
+
+	envmap := &corev1.ConfigMap{}
+	envmeta := ObjectMetaConcat(instance, req.NamespacedName, bythepowerofv1.EnvMap,
+		instance.Spec.Variables, instance.GetLabels())
+
+	log.Info(fmt.Sprintf("Checking env map %v", envmeta.Name))
+
+	outcome, err := reconciler.Ensure(ctx, r.kind(), instance, bythepowerofv1.EnvMap, envmap, envmeta, func(cm *corev1.ConfigMap) error {
+		cm.Data = instance.Spec.Variables
+		return ctrl.SetControllerReference(instance, cm, r.Scheme)
+	})
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if outcome != reconciler.Unchanged {
+		err = r.Event(ctx, instance, outcome.Phase(), bythepowerofv1.EnvMap, envmeta.Name)
+		return requeue, err
+	}
+
+	// hash the trigger inputs, waiting for any that aren't there yet
+	inputs, missing, err := r.triggerInputs(ctx, instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if missing != "" {
+		err = r.Event(ctx, instance, bythepowerofv1.BackOff, bythepowerofv1.Trigger, missing)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		return backoff5, nil
+	}
+
+	hash, err := bythepowerofv1.TriggerHash(inputs...)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// look at the scheduleruns just for this instance...
+	kmsrs, err := scheduleRunsOf(ctx, r, instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// tidy up the ended ones past our history limits
+	for _, kmsr := range bythepowerofv1.ExpiredScheduleRuns(kmsrs,
+		instance.Spec.SuccessfulRunsHistoryLimit, instance.Spec.FailedRunsHistoryLimit, time.Now()) {
+		log.Info(fmt.Sprintf("Deleting old schedule run %v", kmsr.GetName()))
+		err = r.Delete(ctx, &kmsr)
+		if ignoreNotFound(err) != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	// the hash each run was last started with, by name, from the newest of
+	// its schedule runs for before we remembered them by uid
+	started := map[string]bythepowerofv1.KmakeTriggerStart{}
+	newest := map[string]metav1.Time{}
+
+	for _, kmsr := range kmsrs {
+		run := kmsr.GetKmakeRunName()
+		created := kmsr.GetCreationTimestamp()
+		if t, ok := newest[run]; ok && created.Before(&t) {
+			continue
+		}
+		newest[run] = created
+		started[run] = bythepowerofv1.KmakeTriggerStart{
+			Hash: bythepowerofv1.GetDomainLabel(kmsr.GetLabels(), bythepowerofv1.TriggerHashLabel),
+		}
+	}
+
+	// what to remember, how each run we still monitor was started
+	current := map[string]bythepowerofv1.KmakeTriggerStart{}
+
+	// look at the kmakerun items
+	for _, element := range instance.Spec.Monitor {
+		runs := &bythepowerofv1.KmakeRunList{}
+		scheduleLabel := bythepowerofv1.MakeDomainString(bythepowerofv1.ScheduleLabel)
+		opts := []client.ListOption{
+			client.InNamespace(req.NamespacedName.Namespace),
+			client.MatchingLabels{scheduleLabel: element},
+		}
+
+		err = r.List(ctx, runs, opts...)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+
+		for _, run := range runs.Items {
+			kmakeName := run.GetKmakeName()
+			if kmakeName == "" {
+				log.Info(fmt.Sprintf("run %v not connected to kmake", run.GetName()))
+				continue
+			}
+			uid := string(run.GetUID())
+			last, ok := instance.Status.Started[uid]
+			if !ok {
+				last, ok = started[run.GetName()]
+			}
+			if last.Hash == hash {
+				current[uid] = last
+				continue
+			}
+
+			// a run we've not seen before waits for its inputs to change,
+			// unless asked to start it as they are
+			if !ok && !instance.Spec.StartNewRuns {
+				current[uid] = bythepowerofv1.KmakeTriggerStart{Hash: hash}
+				continue
+			}
+
+			// let the inputs settle before starting anything
+			if instance.Status.PendingHash != hash {
+				now := metav1.Now()
+				instance.Status.PendingHash = hash
+				instance.Status.PendingSince = &now
+				err = r.Status().Update(ctx, instance)
+				if err != nil {
+					return reconcile.Result{}, err
+				}
+			}
+			if wait := instance.Debounced(instance.Status.PendingSince.Time, time.Now()); wait > 0 {
+				err = r.Event(ctx, instance, bythepowerofv1.Wait, bythepowerofv1.Trigger, hash)
+				if err != nil {
+					return reconcile.Result{}, err
+				}
+				return ctrl.Result{RequeueAfter: wait}, nil
+			}
+
+			// the count keeps the name new when the inputs come back to a
+			// hash the run was started with before
+			next := bythepowerofv1.KmakeTriggerStart{Hash: hash, Count: last.Count + 1}
+			kmsr := &bythepowerofv1.KmakeScheduleRun{
+				ObjectMeta: ObjectMetaConcat(instance, req.NamespacedName, bythepowerofv1.ScheduleRun, run.GetUID(), hash, next.Count),
+				Spec: bythepowerofv1.KmakeScheduleRunSpec{
+					KmakeScheduleRunOperation: bythepowerofv1.KmakeScheduleRunOperation{
+						Start: &bythepowerofv1.KmakeScheduleRunStart{},
+					},
+					TTLSecondsAfterFinished: instance.Spec.TTLSecondsAfterFinished,
+					ActiveDeadlineSeconds:   instance.Spec.ActiveDeadlineSeconds,
+				},
+			}
+			ctrl.SetControllerReference(instance, kmsr, r.Scheme)
+			SetOwnerReference(&run, kmsr, r.Scheme)
+
+			kmsr.SetLabels(ScheduleRunLabels(instance, map[string]string{
+				bythepowerofv1.MakeDomainString(bythepowerofv1.KmakeLabel):          kmakeName,
+				bythepowerofv1.MakeDomainString(bythepowerofv1.KmakeNamespaceLabel): run.GetKmakeNamespace(),
+				bythepowerofv1.MakeDomainString(bythepowerofv1.ScheduleInstLabel):   instance.Name,
+				bythepowerofv1.MakeDomainString(bythepowerofv1.ScheduleEnvLabel):    envmap.GetName(),
+				bythepowerofv1.MakeDomainString(bythepowerofv1.RunLabel):            run.GetName(),
+				bythepowerofv1.MakeDomainString(bythepowerofv1.WorkloadLabel):       "yes",
+				bythepowerofv1.MakeDomainString(bythepowerofv1.StatusLabel):         "Provision",
+				bythepowerofv1.MakeDomainString(bythepowerofv1.TriggerHashLabel):    hash,
+			}))
+
+			err = r.Create(ctx, kmsr)
+			if errors.IsAlreadyExists(err) {
+				// made on an earlier pass we didn't get to remember
+				current[uid] = next
+				continue
+			}
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+			err = r.Event(ctx, instance, bythepowerofv1.Provision, bythepowerofv1.Runs, kmsr.GetName())
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+			current[uid] = next
+		}
+	}
+
+	// remember them for when their schedule runs are deleted, forgetting the
+	// runs that have gone
+	if len(current) == 0 {
+		current = nil
+	}
+	if !equality.Semantic.DeepEqual(instance.Status.Started, current) {
+		instance.Status.Started = current
+		err = r.Status().Update(ctx, instance)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	_ = r.Event(ctx, instance, bythepowerofv1.Ready, bythepowerofv1.Main, "")
+	return backoff5, nil
+}
+
+// triggerInputs fetches the content of each trigger, or names the first one
+// that isn't there
+func (r *KmakeTriggerSchedulerReconciler) triggerInputs(ctx context.Context, instance *bythepowerofv1.KmakeTriggerScheduler) ([]interface{}, string, error) {
+	inputs := make([]interface{}, 0)
+
+	for _, t := range instance.Spec.Triggers {
+		var obj client.Object
+		var name string
+		var reader client.Reader = r.Client
+
+		switch {
+		case t.ConfigMap != "":
+			obj, name = &corev1.ConfigMap{}, t.ConfigMap
+		case t.Secret != "":
+			obj, name, reader = &corev1.Secret{}, t.Secret, r.secrets()
+		case t.Kmake != "":
+			obj, name = &bythepowerofv1.Kmake{}, t.Kmake
+		default:
+			continue
+		}
+
+		err := reader.Get(ctx, types.NamespacedName{Namespace: instance.GetNamespace(), Name: name}, obj)
+		if errors.IsNotFound(err) {
+			return nil, name, nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		switch o := obj.(type) {
+		case *corev1.ConfigMap:
+			inputs = append(inputs, o.Data, o.BinaryData)
+		case *corev1.Secret:
+			inputs = append(inputs, o.Data)
+		case *bythepowerofv1.Kmake:
+			inputs = append(inputs, o.Spec.Variables)
+		}
+	}
+	return inputs, "", nil
+}
+
+func (r *KmakeTriggerSchedulerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// look again at the schedulers whenever one of their inputs changes,
+	// caching only the metadata of the secrets
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&bythepowerofv1.KmakeTriggerScheduler{}).
+		Owns(&bythepowerofv1.KmakeScheduleRun{}).
+		Owns(&corev1.ConfigMap{}).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.triggeredBy("ConfigMap"))).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.triggeredBy("Secret")), builder.OnlyMetadata).
+		Watches(&bythepowerofv1.Kmake{}, handler.EnqueueRequestsFromMapFunc(r.triggeredBy("Kmake"))).
+		WithEventFilter(r.Scope.Predicate(mgr.GetClient())).
+		WithOptions(r.Config.Get().Controller("KmakeTriggerScheduler")).
+		Complete(r)
+}
+
+// triggeredBy maps an input of the kind to the schedulers it triggers
+func (r *KmakeTriggerSchedulerReconciler) triggeredBy(kind string) func(ctx context.Context, o client.Object) []reconcile.Request {
+	return func(ctx context.Context, o client.Object) []reconcile.Request {
+		schedulers := &bythepowerofv1.KmakeTriggerSchedulerList{}
+		err := r.List(ctx, schedulers, client.InNamespace(o.GetNamespace()))
+		if err != nil {
+			logf.FromContext(ctx).Error(err, "unable to list trigger schedulers")
+			return nil
+		}
+
+		requests := make([]reconcile.Request, 0)
+		for _, s := range schedulers.Items {
+			if s.Triggers(kind, o.GetName()) {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Namespace: s.GetNamespace(), Name: s.GetName()},
+				})
+			}
+		}
+		return requests
+	}
+}
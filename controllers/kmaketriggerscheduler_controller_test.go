@@ -0,0 +1,288 @@
+package controllers
+
+import (
+	"golang.org/x/net/context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Controllers/KmakeTriggerSchedulerController", func() {
+	const timeout = time.Second * 30
+	const interval = time.Second * 1
+	const namespace = "default"
+
+	Context("Trigger scheduler watching a config map", func() {
+		It("Should start the runs again when the config map changes", func() {
+			kmsrs := func() []bythepowerofv1.KmakeScheduleRun {
+				l := &bythepowerofv1.KmakeScheduleRunList{}
+				k8sClient.List(context.Background(), l, client.InNamespace(namespace),
+					client.MatchingLabels{"bythepowerof.github.io/schedule-instance": "trigger1"})
+				return l.Items
+			}
+
+			By("Create kmake and run")
+			Expect(k8sClient.Create(context.Background(), newTestKmake("kmake12", namespace))).Should(Succeed())
+
+			kmakerun := newTestKmakeRun("foo19", namespace, "kmake12")
+			kmakerun.Labels["bythepowerof.github.io/scheduler"] = "trigger"
+			Expect(k8sClient.Create(context.Background(), kmakerun)).Should(Succeed())
+
+			By("Create the trigger config map")
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "trigger-input", Namespace: namespace},
+				Data:       map[string]string{"key": "one"},
+			}
+			Expect(k8sClient.Create(context.Background(), cm)).Should(Succeed())
+
+			By("Create kmake trigger scheduler")
+			kmts := &bythepowerofv1.KmakeTriggerScheduler{
+				ObjectMeta: metav1.ObjectMeta{Name: "trigger1", Namespace: namespace},
+				Spec: bythepowerofv1.KmakeTriggerSchedulerSpec{
+					Monitor:      []string{"trigger"},
+					Triggers:     []bythepowerofv1.KmakeTrigger{bythepowerofv1.KmakeTrigger{ConfigMap: "trigger-input"}},
+					StartNewRuns: true,
+				},
+			}
+			Expect(k8sClient.Create(context.Background(), kmts)).Should(Succeed())
+
+			Eventually(func() int {
+				return len(kmsrs())
+			}, timeout, interval).Should(Equal(1))
+
+			By("Changing the config map")
+			f := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(context.Background(), types.NamespacedName{Name: "trigger-input", Namespace: namespace}, f)).Should(Succeed())
+			f.Data["key"] = "two"
+			Expect(k8sClient.Update(context.Background(), f)).Should(Succeed())
+
+			Eventually(func() int {
+				return len(kmsrs())
+			}, timeout, interval).Should(Equal(2))
+
+			By("Leaving the runs alone while it stays the same")
+			Consistently(func() int {
+				return len(kmsrs())
+			}, time.Second*5, interval).Should(Equal(2))
+
+			By("delete trigger scheduler")
+			f2 := &bythepowerofv1.KmakeTriggerScheduler{}
+			Expect(k8sClient.Get(context.Background(), types.NamespacedName{Name: "trigger1", Namespace: namespace}, f2)).Should(Succeed())
+			Expect(k8sClient.Delete(context.Background(), f2)).Should(Succeed())
+		})
+	})
+
+	Context("Trigger scheduler with no history", func() {
+		It("Should delete its ended schedule runs and only start them again on a change", func() {
+			key := types.NamespacedName{Name: "trigger3", Namespace: namespace}
+			none := int32(0)
+
+			kmakerun := newTestKmakeRun("foo52", namespace, "kmake19")
+			kmakerun.UID = "foo52-uid"
+			kmakerun.Labels["bythepowerof.github.io/scheduler"] = "trigger-history"
+
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "trigger-input3", Namespace: namespace},
+				Data:       map[string]string{"key": "one"},
+			}
+
+			c, testScheme := newFakeClient(kmakerun, cm, &bythepowerofv1.KmakeTriggerScheduler{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: namespace,
+					Finalizers: []string{bythepowerofv1.KmakeTriggerSchedulerFinalizerName}},
+				Spec: bythepowerofv1.KmakeTriggerSchedulerSpec{
+					Monitor:                    []string{"trigger-history"},
+					Triggers:                   []bythepowerofv1.KmakeTrigger{{ConfigMap: "trigger-input3"}},
+					StartNewRuns:               true,
+					SuccessfulRunsHistoryLimit: &none,
+				},
+			})
+			r := &KmakeTriggerSchedulerReconciler{Client: c, Recorder: record.NewFakeRecorder(100), Scheme: testScheme}
+
+			kmsrs := func() []bythepowerofv1.KmakeScheduleRun {
+				_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+				Expect(err).ToNot(HaveOccurred())
+				l := &bythepowerofv1.KmakeScheduleRunList{}
+				Expect(c.List(context.Background(), l, client.InNamespace(namespace))).Should(Succeed())
+				return l.Items
+			}
+			succeed := func(kmsr bythepowerofv1.KmakeScheduleRun) {
+				kmsr.Labels["bythepowerof.github.io/status"] = "Success"
+				Expect(c.Update(context.Background(), &kmsr)).Should(Succeed())
+			}
+
+			By("Starting the run")
+			kmsrs()
+			l := kmsrs()
+			Expect(l).To(HaveLen(1))
+			f := &bythepowerofv1.KmakeTriggerScheduler{}
+			Expect(c.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(f.Status.Started).To(HaveKeyWithValue("foo52-uid", bythepowerofv1.KmakeTriggerStart{
+				Hash:  l[0].Labels["bythepowerof.github.io/trigger-hash"],
+				Count: 1,
+			}))
+
+			By("Deleting it once it succeeds")
+			succeed(l[0])
+			Expect(kmsrs()).To(BeEmpty())
+			Expect(kmsrs()).To(BeEmpty())
+
+			By("Starting it again when the config map changes")
+			cm.Data["key"] = "two"
+			Expect(c.Update(context.Background(), cm)).Should(Succeed())
+			Expect(kmsrs()).To(HaveLen(1))
+		})
+	})
+
+	Context("Trigger scheduler whose inputs change back", func() {
+		It("Should start the run again though it has a schedule run for those inputs", func() {
+			key := types.NamespacedName{Name: "trigger4", Namespace: namespace}
+
+			kmakerun := newTestKmakeRun("foo56", namespace, "kmake24")
+			kmakerun.UID = "foo56-uid"
+			kmakerun.Labels["bythepowerof.github.io/scheduler"] = "trigger-back"
+
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "trigger-input4", Namespace: namespace},
+				Data:       map[string]string{"key": "one"},
+			}
+
+			c, testScheme := newFakeClient(kmakerun, cm, &bythepowerofv1.KmakeTriggerScheduler{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: namespace,
+					Finalizers: []string{bythepowerofv1.KmakeTriggerSchedulerFinalizerName}},
+				Spec: bythepowerofv1.KmakeTriggerSchedulerSpec{
+					Monitor:      []string{"trigger-back"},
+					Triggers:     []bythepowerofv1.KmakeTrigger{{ConfigMap: "trigger-input4"}},
+					StartNewRuns: true,
+				},
+			})
+			r := &KmakeTriggerSchedulerReconciler{Client: c, Recorder: record.NewFakeRecorder(100), Scheme: testScheme}
+
+			kmsrs := func() []bythepowerofv1.KmakeScheduleRun {
+				_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+				Expect(err).ToNot(HaveOccurred())
+				l := &bythepowerofv1.KmakeScheduleRunList{}
+				Expect(c.List(context.Background(), l, client.InNamespace(namespace))).Should(Succeed())
+				return l.Items
+			}
+			change := func(value string) {
+				cm.Data["key"] = value
+				Expect(c.Update(context.Background(), cm)).Should(Succeed())
+			}
+
+			By("Starting the run")
+			kmsrs()
+			Expect(kmsrs()).To(HaveLen(1))
+
+			By("Starting it again for each change")
+			change("two")
+			Expect(kmsrs()).To(HaveLen(2))
+			change("one")
+			Expect(kmsrs()).To(HaveLen(3))
+			Expect(kmsrs()).To(HaveLen(3))
+
+			f := &bythepowerofv1.KmakeTriggerScheduler{}
+			Expect(c.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(f.Status.Started["foo56-uid"].Count).To(Equal(int64(3)))
+		})
+	})
+
+	Context("Trigger scheduler on a secret", func() {
+		It("Should read the secret around the cache", func() {
+			key := types.NamespacedName{Name: "trigger5", Namespace: namespace}
+
+			kmakerun := newTestKmakeRun("foo57", namespace, "kmake25")
+			kmakerun.UID = "foo57-uid"
+			kmakerun.Labels["bythepowerof.github.io/scheduler"] = "trigger-secret"
+
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "trigger-input5", Namespace: namespace},
+				Data:       map[string][]byte{"key": []byte("one")},
+			}
+
+			// the cache only has the metadata of secrets
+			c, testScheme := newFakeClient(kmakerun, &bythepowerofv1.KmakeTriggerScheduler{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: namespace,
+					Finalizers: []string{bythepowerofv1.KmakeTriggerSchedulerFinalizerName}},
+				Spec: bythepowerofv1.KmakeTriggerSchedulerSpec{
+					Monitor:      []string{"trigger-secret"},
+					Triggers:     []bythepowerofv1.KmakeTrigger{{Secret: "trigger-input5"}},
+					StartNewRuns: true,
+				},
+			})
+			api, _ := newFakeClient(secret)
+			r := &KmakeTriggerSchedulerReconciler{Client: c, Recorder: record.NewFakeRecorder(100), Scheme: testScheme, APIReader: api}
+
+			for i := 0; i < 2; i++ {
+				_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+				Expect(err).ToNot(HaveOccurred())
+			}
+			l := &bythepowerofv1.KmakeScheduleRunList{}
+			Expect(c.List(context.Background(), l, client.InNamespace(namespace))).Should(Succeed())
+			Expect(l.Items).To(HaveLen(1))
+		})
+	})
+
+	Context("Trigger scheduler seeing a run for the first time", func() {
+		It("Should only remember its inputs until they change", func() {
+			key := types.NamespacedName{Name: "trigger6", Namespace: namespace}
+			ttl := int32(60)
+			deadline := int64(600)
+
+			kmakerun := newTestKmakeRun("foo72", namespace, "kmake33")
+			kmakerun.UID = "foo72-uid"
+			kmakerun.Labels["bythepowerof.github.io/scheduler"] = "trigger-first"
+
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "trigger-input6", Namespace: namespace},
+				Data:       map[string]string{"key": "one"},
+			}
+
+			c, testScheme := newFakeClient(kmakerun, cm, &bythepowerofv1.KmakeTriggerScheduler{
+				ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: namespace,
+					Finalizers: []string{bythepowerofv1.KmakeTriggerSchedulerFinalizerName}},
+				Spec: bythepowerofv1.KmakeTriggerSchedulerSpec{
+					Monitor:                 []string{"trigger-first"},
+					Triggers:                []bythepowerofv1.KmakeTrigger{{ConfigMap: "trigger-input6"}},
+					TTLSecondsAfterFinished: &ttl,
+					ActiveDeadlineSeconds:   &deadline,
+				},
+			})
+			r := &KmakeTriggerSchedulerReconciler{Client: c, Recorder: record.NewFakeRecorder(100), Scheme: testScheme}
+
+			kmsrs := func() []bythepowerofv1.KmakeScheduleRun {
+				_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+				Expect(err).ToNot(HaveOccurred())
+				l := &bythepowerofv1.KmakeScheduleRunList{}
+				Expect(c.List(context.Background(), l, client.InNamespace(namespace))).Should(Succeed())
+				return l.Items
+			}
+
+			By("Remembering the inputs without starting the run")
+			kmsrs()
+			Expect(kmsrs()).To(BeEmpty())
+			f := &bythepowerofv1.KmakeTriggerScheduler{}
+			Expect(c.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(f.Status.Started).To(HaveKey("foo72-uid"))
+			Expect(f.Status.Started["foo72-uid"].Count).To(BeZero())
+
+			By("Starting it when the config map changes")
+			cm.Data["key"] = "two"
+			Expect(c.Update(context.Background(), cm)).Should(Succeed())
+			l := kmsrs()
+			Expect(l).To(HaveLen(1))
+			Expect(l[0].Spec.TTLSecondsAfterFinished).To(Equal(&ttl))
+			Expect(l[0].Spec.ActiveDeadlineSeconds).To(Equal(&deadline))
+			Expect(c.Get(context.Background(), key, f)).Should(Succeed())
+			Expect(f.Status.Started["foo72-uid"].Count).To(Equal(int64(1)))
+		})
+	})
+})
@@ -0,0 +1,43 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+)
+
+// cleanupScheduleRuns deletes the schedule runs a scheduler made, for the
+// now and trigger schedulers alike
+func cleanupScheduleRuns[T bythepowerofv1.KmakeObject](c client.Client) func(context.Context, T) error {
+	return func(ctx context.Context, instance T) error {
+		kmsrs, err := scheduleRunsOf(ctx, c, instance)
+		if err != nil {
+			return err
+		}
+		for i := range kmsrs {
+			err = c.Delete(ctx, &kmsrs[i], client.PropagationPolicy(metav1.DeletePropagationBackground))
+			if ignoreNotFound(err) != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
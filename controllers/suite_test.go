@@ -33,6 +33,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -48,13 +49,11 @@ var scheme = runtime.NewScheme()
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
 
-	RunSpecsWithDefaultAndCustomReporters(t,
-		"Controller Suite",
-		[]Reporter{envtest.NewlineReporter{}})
+	RunSpecs(t, "Controller Suite")
 }
 
 var _ = BeforeSuite(func(done Done) {
-	logf.SetLogger(zap.LoggerTo(GinkgoWriter, true))
+	logf.SetLogger(zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)))
 
 	By("bootstrapping test environment")
 	t := true
@@ -79,19 +78,17 @@ var _ = BeforeSuite(func(done Done) {
 	err = bythepowerofv1.AddToScheme(scheme)
 	Expect(err).NotTo(HaveOccurred())
 
-	namespace := "default"
-
 	// +kubebuilder:scaffold:scheme
+	// watch every namespace, as the manager does by default, so runs can use
+	// kmakes in other namespaces
 	k8sManager, err = ctrl.NewManager(cfg, ctrl.Options{
-		Scheme:             scheme,
-		Namespace:          namespace,
-		MetricsBindAddress: "0",
+		Scheme:  scheme,
+		Metrics: metricsserver.Options{BindAddress: "0"},
 	})
 	Expect(err).ToNot(HaveOccurred())
 
 	err = (&KmakeReconciler{
 		Client:   k8sManager.GetClient(),
-		Log:      ctrl.Log.WithName("controllers").WithName("kmake").WithName(namespace),
 		Recorder: k8sManager.GetEventRecorderFor("kmake-controller"),
 		Scheme:   scheme,
 	}).SetupWithManager(k8sManager)
@@ -99,23 +96,29 @@ var _ = BeforeSuite(func(done Done) {
 
 	err = (&KmakeNowSchedulerReconciler{
 		Client:   k8sManager.GetClient(),
-		Log:      ctrl.Log.WithName("controllers").WithName("KmakeNowScheduler").WithName(namespace),
 		Recorder: k8sManager.GetEventRecorderFor("kmake-now-scheduler-controller"),
 		Scheme:   scheme,
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
+	err = (&KmakeTriggerSchedulerReconciler{
+		Client:    k8sManager.GetClient(),
+		Recorder:  k8sManager.GetEventRecorderFor("kmake-trigger-scheduler-controller"),
+		Scheme:    scheme,
+		APIReader: k8sManager.GetAPIReader(),
+	}).SetupWithManager(k8sManager)
+	Expect(err).ToNot(HaveOccurred())
+
 	err = (&KmakeScheduleRunReconciler{
-		Client:   k8sManager.GetClient(),
-		Log:      ctrl.Log.WithName("controllers").WithName("KmakeScheduleRun").WithName(namespace),
-		Recorder: k8sManager.GetEventRecorderFor("kmake-schedule-run-controller"),
-		Scheme:   scheme,
+		Client:    k8sManager.GetClient(),
+		APIReader: k8sManager.GetAPIReader(),
+		Recorder:  k8sManager.GetEventRecorderFor("kmake-schedule-run-controller"),
+		Scheme:    scheme,
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
 	err = (&KmakeRunReconciler{
 		Client:   k8sManager.GetClient(),
-		Log:      ctrl.Log.WithName("controllers").WithName("KmakeRun").WithName(namespace),
 		Recorder: k8sManager.GetEventRecorderFor("kmake-run-controller"),
 		Scheme:   scheme,
 	}).SetupWithManager(k8sManager)
@@ -0,0 +1,85 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+)
+
+const tracerName = "github.com/bythepowerof/kmake-controller/controllers"
+
+// startSpan starts the reconcile's span, in the trace the object was made in
+// when its annotations carry one, and has the context's logger log the trace id
+func startSpan(ctx context.Context, name string, object client.Object) (context.Context, trace.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, bythepowerofv1.TraceCarrier{Object: object})
+	ctx, span := otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(
+		attribute.String("k8s.namespace.name", object.GetNamespace()),
+		attribute.String("kmake.object.name", object.GetName()),
+	))
+
+	if sc := span.SpanContext(); sc.HasTraceID() {
+		ctx = logf.IntoContext(ctx, logf.FromContext(ctx).WithValues("traceID", sc.TraceID().String()))
+	}
+	return ctx, span
+}
+
+// endSpan ends the reconcile's span, marking it failed when it errored
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// injectTrace annotates the object with the context's trace so its own
+// reconciles join it
+func injectTrace(ctx context.Context, object metav1.Object) {
+	otel.GetTextMapPropagator().Inject(ctx, bythepowerofv1.TraceCarrier{Object: object})
+}
+
+// injectTraceEnv sets TRACEPARENT, and TRACESTATE if any, in the containers of
+// the pod for what runs there to join the context's trace
+func injectTraceEnv(ctx context.Context, spec *corev1.PodSpec) {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	keys := carrier.Keys()
+	sort.Strings(keys)
+
+	for i := range spec.Containers {
+		for _, key := range keys {
+			spec.Containers[i].Env = append(spec.Containers[i].Env, corev1.EnvVar{
+				Name:  strings.ToUpper(key),
+				Value: carrier.Get(key),
+			})
+		}
+	}
+}
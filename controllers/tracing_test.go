@@ -0,0 +1,126 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+)
+
+var _ = Describe("Controllers/Tracing", func() {
+	var (
+		recorder   *tracetest.SpanRecorder
+		provider   trace.TracerProvider
+		propagator propagation.TextMapPropagator
+	)
+
+	BeforeEach(func() {
+		provider = otel.GetTracerProvider()
+		propagator = otel.GetTextMapPropagator()
+
+		recorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		otel.SetTextMapPropagator(propagation.TraceContext{})
+	})
+
+	AfterEach(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	Context("Propagation", func() {
+		It("Should carry the scheduler's trace to the schedule run and its job", func() {
+			kmns := &bythepowerofv1.KmakeNowScheduler{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+			}
+			ctx, scheduler := startSpan(context.Background(), "KmakeNowScheduler.Reconcile", kmns)
+
+			kmsr := &bythepowerofv1.KmakeScheduleRun{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo-kmsr", Namespace: "default"},
+			}
+			injectTrace(ctx, kmsr)
+			endSpan(scheduler, nil)
+
+			traceID := scheduler.SpanContext().TraceID().String()
+			Expect(kmsr.GetAnnotations()).To(HaveKeyWithValue("bythepowerof.github.io/traceparent", ContainSubstring(traceID)))
+
+			ctx, run := startSpan(context.Background(), "KmakeScheduleRun.Reconcile", kmsr)
+			Expect(run.SpanContext().TraceID()).To(Equal(scheduler.SpanContext().TraceID()))
+
+			spec := &corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: "kmake", Env: []corev1.EnvVar{{Name: "VAR1", Value: "Value1"}}},
+					{Name: "sidecar"},
+				},
+			}
+			injectTraceEnv(ctx, spec)
+			endSpan(run, nil)
+
+			traceparent := fmt.Sprintf("00-%v-%v-01", traceID, run.SpanContext().SpanID())
+			for _, c := range spec.Containers {
+				Expect(c.Env).To(ContainElement(corev1.EnvVar{Name: "TRACEPARENT", Value: traceparent}))
+			}
+			Expect(spec.Containers[0].Env[0].Name).To(Equal("VAR1"))
+
+			spans := recorder.Ended()
+			Expect(spans).To(HaveLen(2))
+			Expect(spans[1].Parent().SpanID()).To(Equal(scheduler.SpanContext().SpanID()))
+			Expect(spans[1].Parent().IsRemote()).To(BeTrue())
+		})
+
+		It("Should start a new trace without one", func() {
+			kmake := &bythepowerofv1.Kmake{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+			}
+			_, span := startSpan(context.Background(), "Kmake.Reconcile", kmake)
+			endSpan(span, nil)
+
+			spans := recorder.Ended()
+			Expect(spans).To(HaveLen(1))
+			Expect(spans[0].Parent().IsValid()).To(BeFalse())
+			Expect(spans[0].Name()).To(Equal("Kmake.Reconcile"))
+		})
+
+		It("Should mark failed reconciles", func() {
+			kmake := &bythepowerofv1.Kmake{
+				ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+			}
+			_, span := startSpan(context.Background(), "Kmake.Reconcile", kmake)
+			endSpan(span, errors.New("BOOM"))
+
+			spans := recorder.Ended()
+			Expect(spans).To(HaveLen(1))
+			Expect(spans[0].Status().Code).To(Equal(codes.Error))
+			Expect(spans[0].Status().Description).To(Equal("BOOM"))
+			Expect(spans[0].Events()).To(HaveLen(1))
+		})
+	})
+})
@@ -0,0 +1,110 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gql
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// go test ./gql -update rewrites the golden files in testdata
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+var _ = Describe("KmakeGraph", func() {
+	const namespace = "default"
+
+	labels := func(run string, status string) map[string]string {
+		return map[string]string{
+			"bythepowerof.github.io/kmake":  "graph1",
+			"bythepowerof.github.io/run":    run,
+			"bythepowerof.github.io/status": status,
+		}
+	}
+	kmake := &bythepowerofv1.Kmake{
+		ObjectMeta: metav1.ObjectMeta{Name: "graph1", Namespace: namespace},
+		Spec: bythepowerofv1.KmakeSpec{
+			Rules: []bythepowerofv1.KmakeRule{
+				bythepowerofv1.KmakeRule{Targets: []string{"all"}, Prereqs: []string{"main.o"}},
+				bythepowerofv1.KmakeRule{Targets: []string{"%.o"}, Prereqs: []string{"%.c"}},
+				bythepowerofv1.KmakeRule{Targets: []string{"clean"}},
+			},
+		},
+	}
+	run := func(name string, targets ...string) *bythepowerofv1.KmakeRun {
+		return &bythepowerofv1.KmakeRun{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels(name, "")},
+			Spec: bythepowerofv1.KmakeRunSpec{
+				KmakeRunOperation: bythepowerofv1.KmakeRunOperation{
+					Job: &bythepowerofv1.KmakeRunJob{Targets: targets},
+				},
+			},
+		}
+	}
+	kmsr := func(name string, run string, status string) *bythepowerofv1.KmakeScheduleRun {
+		return &bythepowerofv1.KmakeScheduleRun{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels(run, status)},
+		}
+	}
+
+	render := func(format string) (string, error) {
+		testScheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(testScheme)).Should(Succeed())
+		Expect(bythepowerofv1.AddToScheme(testScheme)).Should(Succeed())
+
+		c := fake.NewClientBuilder().WithScheme(testScheme).WithObjects(kmake,
+			run("graph2", "%.o"), run("graph3", "clean"),
+			kmsr("graph4", "graph2", "Success"), kmsr("graph5", "graph3", "Abort"),
+		).Build()
+		return RenderKmakeGraph(context.Background(), c, namespace, "graph1", format)
+	}
+	golden := func(name string, got string) {
+		path := filepath.Join("testdata", name)
+		if *update {
+			Expect(os.WriteFile(path, []byte(got), 0644)).Should(Succeed())
+		}
+		want, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(got).To(Equal(string(want)))
+	}
+
+	Context("Render a kmake", func() {
+		It("Should overlay the last outcome of its runs", func() {
+			dot, err := render("dot")
+			Expect(err).ToNot(HaveOccurred())
+			golden("kmake_graph.dot", dot)
+
+			mermaid, err := render("Mermaid")
+			Expect(err).ToNot(HaveOccurred())
+			golden("kmake_graph.mmd", mermaid)
+		})
+
+		It("Should refuse a format it doesn't know", func() {
+			_, err := render("svg")
+			Expect(err).To(MatchError(`graph format "svg" not supported`))
+		})
+	})
+})
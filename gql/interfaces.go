@@ -16,6 +16,7 @@ type KmakeScheduler interface {
 	GetStatus() string
 	Variables() []v1.KV
 	Monitor() []string
+	IsSuspended() bool
 }
 
 type KmakeRunOperation interface {
@@ -25,3 +26,10 @@ type KmakeRunOperation interface {
 type KmakeScheduleRunOperation interface {
 	Dummy() string
 }
+
+type KmakeGraph interface {
+	ToDot() string
+	ToMermaid() string
+	Cycles() [][]string
+	Unreachable(roots ...string) []string
+}
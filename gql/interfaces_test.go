@@ -21,6 +21,19 @@ var _ = Describe("Interfaces", func() {
 		})
 	})
 
+	Context("KmakeTriggerScheduler Is KmakeScheduler", func() {
+		It("Should create successfully", func() {
+			v := v1.KmakeTriggerScheduler{}
+			var i interface{} = v
+			_, ok := i.(KmakeScheduler)
+			Expect(ok).To(Equal(false))
+
+			var p interface{} = &v
+			_, ok = p.(KmakeScheduler)
+			Expect(ok).To(Equal(true))
+		})
+	})
+
 	Context("KmakeNowScheduler Is KmakeObject", func() {
 		It("Should create successfully", func() {
 			v := v1.KmakeNowScheduler{}
@@ -177,4 +190,16 @@ var _ = Describe("Interfaces", func() {
 			Expect(ok).To(Equal(true))
 		})
 	})
+	Context("KmakeGraph Is KmakeGraph", func() {
+		It("Should create successfully", func() {
+			v := v1.KmakeGraph{}
+			var i interface{} = v
+			_, ok := i.(KmakeGraph)
+			Expect(ok).To(Equal(false))
+
+			var p interface{} = &v
+			_, ok = p.(KmakeGraph)
+			Expect(ok).To(Equal(true))
+		})
+	})
 })
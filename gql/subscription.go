@@ -10,7 +10,10 @@ import (
 	"sync"
 
 	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+	"github.com/bythepowerof/kmake-controller/logrusr"
+	"github.com/bythepowerof/kmake-controller/scope"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -18,6 +21,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
@@ -28,11 +32,28 @@ type KmakeListener struct {
 	mutex      sync.Mutex
 	changes    map[string]map[int]chan KmakeObject
 	index      int
-	namespace  string
+	scope      *scope.Scope
 	ownManager bool
 }
 
+// NewKmakeListener listens in the namespace, all, or a comma separated list,
+// exiting if it can't
 func NewKmakeListener(namespace string, mgr manager.Manager) *KmakeListener {
+	s, err := scope.Options{Namespaces: namespace}.Build()
+	if err == nil {
+		var r *KmakeListener
+		if r, err = NewScopedKmakeListener(s, mgr); err == nil {
+			return r
+		}
+	}
+	ctrl.Log.WithName("kmake-listener").Error(err, "unable to listen", "namespace", namespace)
+	os.Exit(1)
+	return nil
+}
+
+// NewScopedKmakeListener listens to what the scope watches, a nil scope
+// watches everything
+func NewScopedKmakeListener(s *scope.Scope, mgr manager.Manager) (*KmakeListener, error) {
 
 	ownManager := false
 	if mgr == nil {
@@ -40,18 +61,16 @@ func NewKmakeListener(namespace string, mgr manager.Manager) *KmakeListener {
 		_ = clientgoscheme.AddToScheme(scheme)
 		_ = bythepowerofv1.AddToScheme(scheme)
 
-		var err error
-
-		// facilitate testing by passing manager in
-		mo := manager.Options{Scheme: scheme, MetricsBindAddress: "0"}
-		if strings.ToLower(namespace) != "all" {
-			mo.Namespace = namespace
+		cfg, err := ctrl.GetConfig()
+		if err != nil {
+			return nil, err
 		}
-		mgr, err = manager.New(ctrl.GetConfigOrDie(), mo)
 
+		// facilitate testing by passing manager in
+		mo := manager.Options{Scheme: scheme, Metrics: metricsserver.Options{BindAddress: "0"}, Cache: s.Cache()}
+		mgr, err = manager.New(cfg, mo)
 		if err != nil {
-			fmt.Println("failed to create manager")
-			os.Exit(1)
+			return nil, fmt.Errorf("failed to create manager: %w", err)
 		}
 		ownManager = true
 	}
@@ -61,15 +80,45 @@ func NewKmakeListener(namespace string, mgr manager.Manager) *KmakeListener {
 		manager:    mgr,
 		mutex:      sync.Mutex{},
 		changes:    map[string]map[int]chan KmakeObject{},
-		namespace:  namespace,
+		scope:      s,
 		ownManager: ownManager,
+	}, nil
+
+}
+
+// NewKmakeListenerWithLogging is NewScopedKmakeListener with its own manager,
+// watching and logging as the options say, bind them with
+// scope.Options.BindFlags and logrusr.Options.BindFlags
+func NewKmakeListenerWithLogging(scopeOptions scope.Options, logOptions logrusr.Options) (*KmakeListener, error) {
+	logger, err := logOptions.Build("kmake-listener")
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up logging: %w", err)
 	}
+	ctrl.SetLogger(logger)
 
+	s, err := scopeOptions.Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up the scope: %w", err)
+	}
+	return NewScopedKmakeListener(s, nil)
+}
+
+// watches is whether the scope has the namespace, reading its labels past the
+// cache as that may not have started
+func (r *KmakeListener) watches(ctx context.Context, namespace string) error {
+	ok, err := r.scope.Contains(ctx, r.manager.GetAPIReader(), namespace)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("namespace %q not supported", namespace)
+	}
+	return nil
 }
 
 func (r *KmakeListener) AddChangeClient(ctx context.Context, namespace string) (<-chan KmakeObject, error) {
-	if r.namespace != "all" && r.namespace != namespace {
-		return nil, fmt.Errorf("namespace %s not supported", namespace)
+	if err := r.watches(ctx, namespace); err != nil {
+		return nil, err
 	}
 
 	kmo := make(chan KmakeObject, 1)
@@ -81,14 +130,14 @@ func (r *KmakeListener) AddChangeClient(ctx context.Context, namespace string) (
 		r.changes[namespace] = make(map[int]chan KmakeObject)
 	}
 
-	r.changes[namespace][r.index] = kmo
+	r.changes[namespace][idx] = kmo
 	r.mutex.Unlock()
 
 	// Delete channel when done
 	go func(index int) {
 		<-ctx.Done()
 		r.mutex.Lock()
-		delete(r.changes[r.namespace], index)
+		delete(r.changes[namespace], index)
 		r.mutex.Unlock()
 	}(idx)
 
@@ -99,8 +148,8 @@ func (r *KmakeListener) KmakeChanges(namespace string) error {
 	// Create a new Controller that will call the provided Reconciler function in response
 	// to events.
 
-	if r.namespace != "all" && r.namespace != namespace {
-		return fmt.Errorf("namespace %q not supported", namespace)
+	if err := r.watches(context.Background(), namespace); err != nil {
+		return err
 	}
 
 	err := r.prepareKmakeWatch()
@@ -143,14 +192,14 @@ func (r *KmakeListener) prepareKmakeWatch() error {
 		return err
 	}
 	// Watch for kmake objects create / update / delete events and call Reconcile
-	return c.Watch(&source.Kind{Type: &v1.Kmake{}}, &handler.EnqueueRequestForObject{})
+	return c.Watch(source.Kind(r.manager.GetCache(), &v1.Kmake{}, &handler.TypedEnqueueRequestForObject[*v1.Kmake]{}))
 }
 
-func (r *KmakeListener) watchKmake(o reconcile.Request) (reconcile.Result, error) {
+func (r *KmakeListener) watchKmake(ctx context.Context, o reconcile.Request) (reconcile.Result, error) {
 	// Your business logic to implement the API by creating, updating, deleting objects goes here.
 	ret := &v1.Kmake{}
 
-	err := r.client.Get(context.Background(), o.NamespacedName, ret)
+	err := r.client.Get(ctx, o.NamespacedName, ret)
 	if err != nil {
 		return reconcile.Result{}, err
 	}
@@ -181,14 +230,14 @@ func (r *KmakeListener) prepareKmakeRunWatch() error {
 		return err
 	}
 	// Watch for kmake objects create / update / delete events and call Reconcile
-	return c.Watch(&source.Kind{Type: &v1.KmakeRun{}}, &handler.EnqueueRequestForObject{})
+	return c.Watch(source.Kind(r.manager.GetCache(), &v1.KmakeRun{}, &handler.TypedEnqueueRequestForObject[*v1.KmakeRun]{}))
 }
 
-func (r *KmakeListener) watchKmakeRun(o reconcile.Request) (reconcile.Result, error) {
+func (r *KmakeListener) watchKmakeRun(ctx context.Context, o reconcile.Request) (reconcile.Result, error) {
 	// Your business logic to implement the API by creating, updating, deleting objects goes here.
 	ret := &v1.KmakeRun{}
 
-	err := r.client.Get(context.Background(), o.NamespacedName, ret)
+	err := r.client.Get(ctx, o.NamespacedName, ret)
 	if err != nil {
 		return reconcile.Result{}, err
 	}
@@ -218,14 +267,14 @@ func (r *KmakeListener) prepareKmakeNowSchedulerWatch() error {
 		return err
 	}
 	// Watch for kmake objects create / update / delete events and call Reconcile
-	return c.Watch(&source.Kind{Type: &v1.KmakeNowScheduler{}}, &handler.EnqueueRequestForObject{})
+	return c.Watch(source.Kind(r.manager.GetCache(), &v1.KmakeNowScheduler{}, &handler.TypedEnqueueRequestForObject[*v1.KmakeNowScheduler]{}))
 }
 
-func (r *KmakeListener) watchKmakeNowScheduler(o reconcile.Request) (reconcile.Result, error) {
+func (r *KmakeListener) watchKmakeNowScheduler(ctx context.Context, o reconcile.Request) (reconcile.Result, error) {
 	// Your business logic to implement the API by creating, updating, deleting objects goes here.
 	ret := &v1.KmakeNowScheduler{}
 
-	err := r.client.Get(context.Background(), o.NamespacedName, ret)
+	err := r.client.Get(ctx, o.NamespacedName, ret)
 	if err != nil {
 		return reconcile.Result{}, err
 	}
@@ -255,14 +304,14 @@ func (r *KmakeListener) prepareKmakeScheduleRunWatch() error {
 		return err
 	}
 	// Watch for kmake objects create / update / delete events and call Reconcile
-	return c.Watch(&source.Kind{Type: &v1.KmakeScheduleRun{}}, &handler.EnqueueRequestForObject{})
+	return c.Watch(source.Kind(r.manager.GetCache(), &v1.KmakeScheduleRun{}, &handler.TypedEnqueueRequestForObject[*v1.KmakeScheduleRun]{}))
 }
 
-func (r *KmakeListener) watchKmakeScheduleRun(o reconcile.Request) (reconcile.Result, error) {
+func (r *KmakeListener) watchKmakeScheduleRun(ctx context.Context, o reconcile.Request) (reconcile.Result, error) {
 	// Your business logic to implement the API by creating, updating, deleting objects goes here.
 	ret := &v1.KmakeScheduleRun{}
 
-	err := r.client.Get(context.Background(), o.NamespacedName, ret)
+	err := r.client.Get(ctx, o.NamespacedName, ret)
 	if err != nil {
 		// if errors.IsNotFound(err) {
 		// 	return reconcile.Result{}, nil
@@ -286,3 +335,50 @@ func (r *KmakeListener) watchKmakeScheduleRun(o reconcile.Request) (reconcile.Re
 	r.mutex.Unlock()
 	return reconcile.Result{}, nil
 }
+
+// KmakeGraph renders the dependency graph of a kmake as dot or mermaid,
+// with the last schedule run outcome of each target overlaid
+func (r *KmakeListener) KmakeGraph(ctx context.Context, namespace string, name string, format string) (string, error) {
+	if err := r.watches(ctx, namespace); err != nil {
+		return "", err
+	}
+	return RenderKmakeGraph(ctx, r.client, namespace, name, format)
+}
+
+// RenderKmakeGraph is KmakeGraph reading through any client, the listener's
+// cache or straight from the API server as the kmake-graph command does
+func RenderKmakeGraph(ctx context.Context, c client.Reader, namespace string, name string, format string) (string, error) {
+	kmake := &v1.Kmake{}
+	err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, kmake)
+	if err != nil {
+		return "", err
+	}
+
+	opts := []client.ListOption{
+		client.InNamespace(namespace),
+		client.MatchingLabels{
+			v1.MakeDomainString(v1.KmakeLabel): name,
+		},
+	}
+	runs := &v1.KmakeRunList{}
+	err = c.List(ctx, runs, opts...)
+	if err != nil {
+		return "", err
+	}
+	kmsrs := &v1.KmakeScheduleRunList{}
+	err = c.List(ctx, kmsrs, opts...)
+	if err != nil {
+		return "", err
+	}
+
+	graph := kmake.Spec.ToGraph()
+	graph.Overlay(runs.Items, kmsrs.Items)
+
+	switch strings.ToLower(format) {
+	case "dot", "":
+		return graph.ToDot(), nil
+	case "mermaid":
+		return graph.ToMermaid(), nil
+	}
+	return "", fmt.Errorf("graph format %q not supported", format)
+}
@@ -8,6 +8,8 @@ import (
 	. "github.com/onsi/gomega"
 
 	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+	"github.com/bythepowerof/kmake-controller/logrusr"
+	"github.com/bythepowerof/kmake-controller/scope"
 	corev1 "k8s.io/api/core/v1"
 	// storage "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -95,7 +97,7 @@ var _ = Describe("Controllers/KmakeController", func() {
 				Spec: bythepowerofv1.KmakeSpec{
 					PersistentVolumeClaimTemplate: corev1.PersistentVolumeClaimSpec{
 						AccessModes: []corev1.PersistentVolumeAccessMode{"ReadWriteOnce"},
-						Resources: corev1.ResourceRequirements{
+						Resources: corev1.VolumeResourceRequirements{
 							Requests: *cap,
 						},
 						StorageClassName: &storageClass,
@@ -292,4 +294,48 @@ var _ = Describe("Controllers/KmakeController", func() {
 			// Expect(kmakeStatus).Should(Equal("Deleting"))
 		})
 	})
+
+	Context("Scoped Listener", func() {
+		It("Should only take clients in the namespaces watched", func() {
+			s, err := scope.Options{Namespaces: "team-a,default"}.Build()
+			Expect(err).ToNot(HaveOccurred())
+			listener, err := NewScopedKmakeListener(s, k8sManager)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = listener.AddChangeClient(context.Background(), "team-b")
+			Expect(err).To(HaveOccurred())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			_, err = listener.AddChangeClient(ctx, "default")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(listener.changes["default"]).To(HaveLen(1))
+
+			By("dropping the client when it's done")
+			cancel()
+			Eventually(func() int {
+				listener.mutex.Lock()
+				defer listener.mutex.Unlock()
+				return len(listener.changes["default"])
+			}, timeout, interval).Should(Equal(0))
+
+			By("checking the namespace labels")
+			s, err = scope.Options{Namespaces: "all", NamespaceSelector: "kmake=yes"}.Build()
+			Expect(err).ToNot(HaveOccurred())
+			listener, err = NewScopedKmakeListener(s, k8sManager)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = listener.AddChangeClient(context.Background(), "default")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("Listener with bad options", func() {
+		It("Should return the error rather than exit", func() {
+			_, err := NewKmakeListenerWithLogging(scope.Options{}, logrusr.Options{Format: "xml"})
+			Expect(err).To(MatchError(ContainSubstring("failed to set up logging")))
+
+			_, err = NewKmakeListenerWithLogging(scope.Options{NamespaceSelector: "!!"}, logrusr.Options{})
+			Expect(err).To(MatchError(ContainSubstring("failed to set up the scope")))
+		})
+	})
 })
@@ -0,0 +1,133 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconciler
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+)
+
+// Outcome is what Ensure did to a child
+type Outcome int
+
+const (
+	// Unchanged is a child as required that the owner's status has
+	Unchanged Outcome = iota
+	// Created is a new child
+	Created
+	// Adopted is a child that was there already, that the owner didn't own
+	// or its status didn't have
+	Adopted
+	// Updated is a child that had drifted from what's required
+	Updated
+)
+
+func (o Outcome) String() string {
+	return [...]string{"Unchanged", "Created", "Adopted", "Updated"}[o]
+}
+
+// Phase is the phase of the owner's subresource after the outcome
+func (o Outcome) Phase() bythepowerofv1.Phase {
+	if o == Updated {
+		return bythepowerofv1.Update
+	}
+	return bythepowerofv1.Provision
+}
+
+// Ensure makes the owner's child of the subresource as required. It creates
+// the child, adopts it if it's there already and updates it if it's drifted.
+// A child the owner's status has under another name, made for what the owner
+// used to be, is deleted.
+//
+// The child is an empty object of its type that Ensure fills in. The metadata
+// names and labels the child, mutate sets the rest of it, its owner
+// references too, on a new child or on the child as it is. The owner's status
+// is left for the caller to record the child in, unless it's Unchanged
+func Ensure[T bythepowerofv1.KmakeObject, C client.Object](ctx context.Context, k *Kind[T], owner T, subresource bythepowerofv1.SubResource, child C, meta metav1.ObjectMeta, mutate func(child C) error) (Outcome, error) {
+	log := logf.FromContext(ctx)
+	outcome := Unchanged
+	empty := child.DeepCopyObject().(C)
+
+	err := k.Client.Get(ctx, types.NamespacedName{Namespace: meta.Namespace, Name: meta.Name}, child)
+	switch {
+	case errors.IsNotFound(err):
+		child.SetNamespace(meta.Namespace)
+		child.SetName(meta.Name)
+		child.SetLabels(meta.Labels)
+		if err = mutate(child); err != nil {
+			return outcome, err
+		}
+
+		log.Info(fmt.Sprintf("Creating %v %v", subresource.String(), meta.Name))
+		err = k.Client.Create(ctx, child)
+		if errors.IsAlreadyExists(err) {
+			// made before we could record it, the next pass compares it
+			outcome = Adopted
+			break
+		}
+		if err != nil {
+			return outcome, err
+		}
+		outcome = Created
+
+	case err != nil:
+		return outcome, err
+
+	default:
+		before := child.DeepCopyObject().(C)
+		child.SetLabels(meta.Labels)
+		if err = mutate(child); err != nil {
+			return outcome, err
+		}
+		if equality.Semantic.DeepEqual(before, child) {
+			break
+		}
+
+		log.Info(fmt.Sprintf("Updating %v %v", subresource.String(), meta.Name))
+		if err = k.Client.Update(ctx, child); err != nil {
+			return outcome, err
+		}
+		outcome = Updated
+		if metav1.GetControllerOf(before) == nil && metav1.GetControllerOf(child) != nil {
+			outcome = Adopted
+		}
+	}
+
+	recorded := owner.GetKmakeStatus().GetSubReference(subresource)
+	if recorded != "" && recorded != meta.Name {
+		stale := empty
+		stale.SetNamespace(meta.Namespace)
+		stale.SetName(recorded)
+
+		log.Info(fmt.Sprintf("Deleting %v %v", subresource.String(), recorded))
+		if err = client.IgnoreNotFound(k.Client.Delete(ctx, stale)); err != nil {
+			return outcome, err
+		}
+	}
+	if outcome == Unchanged && recorded != meta.Name {
+		outcome = Adopted
+	}
+	return outcome, nil
+}
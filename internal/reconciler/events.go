@@ -0,0 +1,40 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconciler
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+
+	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+)
+
+// recordEvent records the phase of the instance with the phase's reason, as a
+// Warning when it went wrong. When the name is the subresource's child object,
+// in the namespace given, the event's annotations point to it
+func recordEvent(recorder record.EventRecorder, instance runtime.Object, phase bythepowerofv1.Phase, subresource bythepowerofv1.SubResource, name string, namespace string, message string) {
+	annotations := map[string]string{
+		bythepowerofv1.MakeDomainString(bythepowerofv1.SubResourceLabel): subresource.String(),
+	}
+	if kind := subresource.ChildKind(); kind != "" && len(validation.IsDNS1123Subdomain(name)) == 0 {
+		annotations[bythepowerofv1.MakeDomainString(bythepowerofv1.ChildKindLabel)] = kind
+		annotations[bythepowerofv1.MakeDomainString(bythepowerofv1.ChildNamespaceLabel)] = namespace
+		annotations[bythepowerofv1.MakeDomainString(bythepowerofv1.ChildNameLabel)] = name
+	}
+
+	recorder.AnnotatedEventf(instance, annotations, phase.EventType(), phase.Reason().String(), "%s", message)
+}
@@ -0,0 +1,101 @@
+package reconciler
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+)
+
+// annotatedEvent is an event as the recorder was given it
+type annotatedEvent struct {
+	annotations map[string]string
+	eventtype   string
+	reason      string
+	message     string
+}
+
+// annotatedRecorder keeps the annotations the fake recorder drops
+type annotatedRecorder struct {
+	events []annotatedEvent
+}
+
+func (r *annotatedRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.AnnotatedEventf(object, nil, eventtype, reason, "%s", message)
+}
+
+func (r *annotatedRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.AnnotatedEventf(object, nil, eventtype, reason, messageFmt, args...)
+}
+
+func (r *annotatedRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.events = append(r.events, annotatedEvent{annotations, eventtype, reason, fmt.Sprintf(messageFmt, args...)})
+}
+
+func TestEventReasons(t *testing.T) {
+	recorder := &annotatedRecorder{}
+	kmake := &bythepowerofv1.Kmake{ObjectMeta: metav1.ObjectMeta{Name: "kmake", Namespace: "default"}}
+
+	recordEvent(recorder, kmake, bythepowerofv1.Error, bythepowerofv1.Job, "job-abc", "default", "Error Job (job-abc)")
+	recordEvent(recorder, kmake, bythepowerofv1.Abort, bythepowerofv1.Job, "job-abc", "default", "Abort Job (job-abc)")
+	recordEvent(recorder, kmake, bythepowerofv1.Provision, bythepowerofv1.PVC, "kmake-pvc", "default", "Provision PVC (kmake-pvc)")
+
+	want := []struct{ eventtype, reason string }{
+		{corev1.EventTypeWarning, "Failed"},
+		{corev1.EventTypeWarning, "Aborted"},
+		{corev1.EventTypeNormal, "Provisioned"},
+	}
+	if len(recorder.events) != len(want) {
+		t.Fatalf("got %v", recorder.events)
+	}
+	for i, w := range want {
+		if e := recorder.events[i]; e.eventtype != w.eventtype || e.reason != w.reason {
+			t.Errorf("event %d got %v %v, want %v %v", i, e.eventtype, e.reason, w.eventtype, w.reason)
+		}
+	}
+	if m := recorder.events[2].message; m != "Provision PVC (kmake-pvc)" {
+		t.Errorf("got message %q", m)
+	}
+}
+
+func TestEventChild(t *testing.T) {
+	kmake := &bythepowerofv1.Kmake{ObjectMeta: metav1.ObjectMeta{Name: "kmake", Namespace: "default"}}
+
+	for sub, kind := range map[bythepowerofv1.SubResource]string{
+		bythepowerofv1.Job:    "Job",
+		bythepowerofv1.PVC:    "PersistentVolumeClaim",
+		bythepowerofv1.EnvMap: "ConfigMap",
+	} {
+		recorder := &annotatedRecorder{}
+		recordEvent(recorder, kmake, bythepowerofv1.Provision, sub, "child-abc", "other", "")
+
+		want := map[string]string{
+			"bythepowerof.github.io/subresource":     sub.String(),
+			"bythepowerof.github.io/child-kind":      kind,
+			"bythepowerof.github.io/child-namespace": "other",
+			"bythepowerof.github.io/child-name":      "child-abc",
+		}
+		if len(recorder.events) != 1 || !reflect.DeepEqual(recorder.events[0].annotations, want) {
+			t.Errorf("%v got %v", sub, recorder.events)
+		}
+	}
+
+	// only children with a name
+	for sub, name := range map[bythepowerofv1.SubResource]string{
+		bythepowerofv1.Job:  "no job for you",
+		bythepowerofv1.Main: "kmake",
+	} {
+		recorder := &annotatedRecorder{}
+		recordEvent(recorder, kmake, bythepowerofv1.Error, sub, name, "default", "")
+
+		want := map[string]string{"bythepowerof.github.io/subresource": sub.String()}
+		if len(recorder.events) != 1 || !reflect.DeepEqual(recorder.events[0].annotations, want) {
+			t.Errorf("%v got %v", sub, recorder.events)
+		}
+	}
+}
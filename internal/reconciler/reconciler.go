@@ -0,0 +1,140 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package reconciler is what the kmake controllers have in common: writing
+// an object's phase to its status, its finalizer and making its children
+package reconciler
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+)
+
+// Kind is how a controller handles the objects of its kind. It's cheap to
+// make, a reconciler can make one as it needs it
+type Kind[T bythepowerofv1.KmakeObject] struct {
+	Client   client.Client
+	Recorder record.EventRecorder
+	Scheme   *runtime.Scheme
+
+	// Finalizer is the kind's finalizer
+	Finalizer string
+	// Cleanup deletes what owner references won't before the finalizer is
+	// removed, nil when there's nothing
+	Cleanup func(ctx context.Context, instance T) error
+	// ChildNamespace is where the children of an object are, its own
+	// namespace when nil
+	ChildNamespace func(instance T) string
+	// OnStatus sets more of the status for a new phase before it's written,
+	// nil for nothing
+	OnStatus func(instance T, phase bythepowerofv1.Phase)
+	// OnMetadata sets more of the metadata for a new phase before it's
+	// written, nil for nothing
+	OnMetadata func(instance T, phase bythepowerofv1.Phase)
+}
+
+func (k *Kind[T]) childNamespace(instance T) string {
+	if k.ChildNamespace != nil {
+		return k.ChildNamespace(instance)
+	}
+	return instance.GetNamespace()
+}
+
+// Event records the phase of the object's subresource, the name of the
+// subresource's child if any, as an event. When the phase is new it writes
+// it, and the child, to the object's status and annotations
+func (k *Kind[T]) Event(ctx context.Context, instance T, phase bythepowerofv1.Phase, subresource bythepowerofv1.SubResource, name string) error {
+	m := ""
+	if name != "" {
+		m = fmt.Sprintf("%v %v (%v)", phase.String(), subresource.String(), name)
+	} else {
+		m = fmt.Sprintf("%v %v", phase.String(), subresource.String())
+	}
+	recordEvent(k.Recorder, instance, phase, subresource, name, k.childNamespace(instance), m)
+
+	log := logf.FromContext(ctx)
+	log.Info(m)
+
+	status := instance.GetKmakeStatus()
+	if status.Status == m {
+		return nil
+	}
+	status.Status = m
+	status.UpdateSubResource(subresource, name)
+	if k.OnStatus != nil {
+		k.OnStatus(instance, phase)
+	}
+	if err := k.Client.Status().Update(ctx, instance); err != nil {
+		return err
+	}
+
+	// the status update brought back the stored metadata, set ours after it
+	if k.OnMetadata != nil {
+		k.OnMetadata(instance, phase)
+	}
+	annotations, err := bythepowerofv1.SetDomainAnnotation(instance.GetAnnotations(), instance.GetKmakeStatus().Resources)
+	if err != nil {
+		return err
+	}
+	instance.SetAnnotations(annotations)
+	return k.Client.Update(ctx, instance)
+}
+
+// Finalize cleans up after an object being deleted and lets it go, or adds
+// the finalizer to an object without it. It's true when it did either, and
+// the reconcile has nothing more to do
+func (k *Kind[T]) Finalize(ctx context.Context, instance T) (bool, error) {
+	if instance.IsBeingDeleted() {
+		if err := k.removeFinalizer(ctx, instance); err != nil {
+			k.Event(ctx, instance, bythepowerofv1.Delete, bythepowerofv1.Main, "finalizer")
+			return true, fmt.Errorf("error when handling finalizer: %v", err)
+		}
+		// without the finalizer it may have gone already
+		return true, client.IgnoreNotFound(k.Event(ctx, instance, bythepowerofv1.Delete, bythepowerofv1.Main, ""))
+	}
+
+	if !instance.HasFinalizer(k.Finalizer) {
+		instance.AddFinalizer(k.Finalizer)
+		if err := k.Client.Update(ctx, instance); err != nil {
+			k.Event(ctx, instance, bythepowerofv1.Error, bythepowerofv1.Main, "finalizer")
+			return true, fmt.Errorf("error when adding finalizer %v: %v", k.Finalizer, err)
+		}
+		k.Event(ctx, instance, bythepowerofv1.Provision, bythepowerofv1.Main, "finalizer")
+		return true, nil
+	}
+	return false, nil
+}
+
+// removeFinalizer runs the cleanup and removes our finalizer, if it's still
+// there
+func (k *Kind[T]) removeFinalizer(ctx context.Context, instance T) error {
+	if !instance.HasFinalizer(k.Finalizer) {
+		return nil
+	}
+	if k.Cleanup != nil {
+		if err := k.Cleanup(ctx, instance); err != nil {
+			return err
+		}
+	}
+	instance.RemoveFinalizer(k.Finalizer)
+	return k.Client.Update(ctx, instance)
+}
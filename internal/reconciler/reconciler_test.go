@@ -0,0 +1,249 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+)
+
+const testFinalizer = "test.finalizers.bythepowerof.github.com"
+
+var testKey = types.NamespacedName{Namespace: "default", Name: "kmake"}
+
+func newTestKind(t *testing.T, objects ...client.Object) (*Kind[*bythepowerofv1.Kmake], *annotatedRecorder) {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := bythepowerofv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	objects = append(objects, &bythepowerofv1.Kmake{
+		ObjectMeta: metav1.ObjectMeta{Name: testKey.Name, Namespace: testKey.Namespace, UID: "kmake-uid"},
+	})
+	recorder := &annotatedRecorder{}
+	return &Kind[*bythepowerofv1.Kmake]{
+		Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).
+			WithStatusSubresource(&bythepowerofv1.Kmake{}).Build(),
+		Recorder:  recorder,
+		Scheme:    scheme,
+		Finalizer: testFinalizer,
+	}, recorder
+}
+
+func get(t *testing.T, c client.Client, key types.NamespacedName, obj client.Object) {
+	t.Helper()
+
+	if err := c.Get(context.Background(), key, obj); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKindEvent(t *testing.T) {
+	k, recorder := newTestKind(t)
+	k.OnStatus = func(instance *bythepowerofv1.Kmake, phase bythepowerofv1.Phase) {
+		instance.Status.Warnings = []string{phase.String()}
+	}
+	k.OnMetadata = func(instance *bythepowerofv1.Kmake, phase bythepowerofv1.Phase) {
+		instance.Labels = bythepowerofv1.SetDomainLabel(instance.Labels, bythepowerofv1.StatusLabel, phase.String())
+	}
+
+	instance := &bythepowerofv1.Kmake{}
+	get(t, k.Client, testKey, instance)
+	if err := k.Event(context.Background(), instance, bythepowerofv1.Provision, bythepowerofv1.EnvMap, "kmake-envmap-1234"); err != nil {
+		t.Fatal(err)
+	}
+
+	fetched := &bythepowerofv1.Kmake{}
+	get(t, k.Client, testKey, fetched)
+	if fetched.Status.Status != "Provision EnvMap (kmake-envmap-1234)" || fetched.Status.GetSubReference(bythepowerofv1.EnvMap) != "kmake-envmap-1234" {
+		t.Errorf("got status %+v", fetched.Status)
+	}
+	if len(fetched.Status.Warnings) != 1 || bythepowerofv1.GetDomainLabel(fetched.Labels, bythepowerofv1.StatusLabel) != "Provision" {
+		t.Errorf("hooks not written %+v", fetched)
+	}
+	if !strings.Contains(bythepowerofv1.GetDomainAnnotation(fetched.Annotations), "kmake-envmap-1234") {
+		t.Errorf("got annotations %v", fetched.Annotations)
+	}
+
+	// the same phase again is only an event
+	version := fetched.ResourceVersion
+	if err := k.Event(context.Background(), fetched, bythepowerofv1.Provision, bythepowerofv1.EnvMap, "kmake-envmap-1234"); err != nil {
+		t.Fatal(err)
+	}
+	get(t, k.Client, testKey, fetched)
+	if fetched.ResourceVersion != version {
+		t.Error("wrote the same phase again")
+	}
+	if len(recorder.events) != 2 {
+		t.Errorf("got events %v", recorder.events)
+	}
+}
+
+func TestKindFinalize(t *testing.T) {
+	k, _ := newTestKind(t)
+	cleaned := 0
+	k.Cleanup = func(ctx context.Context, instance *bythepowerofv1.Kmake) error {
+		cleaned++
+		return nil
+	}
+
+	instance := &bythepowerofv1.Kmake{}
+	get(t, k.Client, testKey, instance)
+	done, err := k.Finalize(context.Background(), instance)
+	if !done || err != nil {
+		t.Fatalf("adding got %v %v", done, err)
+	}
+	get(t, k.Client, testKey, instance)
+	if !instance.HasFinalizer(testFinalizer) || instance.Status.Status != "Provision Main (finalizer)" {
+		t.Errorf("got %+v", instance)
+	}
+
+	done, err = k.Finalize(context.Background(), instance)
+	if done || err != nil {
+		t.Fatalf("with the finalizer got %v %v", done, err)
+	}
+
+	if err = k.Client.Delete(context.Background(), instance); err != nil {
+		t.Fatal(err)
+	}
+	get(t, k.Client, testKey, instance)
+	done, err = k.Finalize(context.Background(), instance)
+	if !done || err != nil {
+		t.Fatalf("deleting got %v %v", done, err)
+	}
+	if cleaned != 1 {
+		t.Errorf("cleaned up %d times", cleaned)
+	}
+	if err = k.Client.Get(context.Background(), testKey, instance); !apierrors.IsNotFound(err) {
+		t.Errorf("still there %v", err)
+	}
+}
+
+func TestKindFinalizeCleanupFails(t *testing.T) {
+	k, _ := newTestKind(t)
+	k.Cleanup = func(ctx context.Context, instance *bythepowerofv1.Kmake) error {
+		return errors.New("BOOM")
+	}
+
+	instance := &bythepowerofv1.Kmake{}
+	get(t, k.Client, testKey, instance)
+	if _, err := k.Finalize(context.Background(), instance); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Client.Delete(context.Background(), instance); err != nil {
+		t.Fatal(err)
+	}
+	get(t, k.Client, testKey, instance)
+
+	done, err := k.Finalize(context.Background(), instance)
+	if !done || err == nil || !strings.Contains(err.Error(), "BOOM") {
+		t.Fatalf("got %v %v", done, err)
+	}
+	get(t, k.Client, testKey, instance)
+	if !instance.HasFinalizer(testFinalizer) {
+		t.Error("let it go without cleaning up")
+	}
+}
+
+func ensureEnvMap(t *testing.T, k *Kind[*bythepowerofv1.Kmake], instance *bythepowerofv1.Kmake, name string, data map[string]string) (*corev1.ConfigMap, Outcome, error) {
+	t.Helper()
+
+	cm := &corev1.ConfigMap{}
+	meta := metav1.ObjectMeta{Namespace: testKey.Namespace, Name: name, Labels: map[string]string{"team": "build"}}
+	outcome, err := Ensure(context.Background(), k, instance, bythepowerofv1.EnvMap, cm, meta, func(cm *corev1.ConfigMap) error {
+		cm.Data = data
+		return ctrl.SetControllerReference(instance, cm, k.Scheme)
+	})
+	return cm, outcome, err
+}
+
+func TestEnsure(t *testing.T) {
+	k, _ := newTestKind(t)
+	instance := &bythepowerofv1.Kmake{}
+	get(t, k.Client, testKey, instance)
+	data := map[string]string{"VAR1": "Value1"}
+
+	cm, outcome, err := ensureEnvMap(t, k, instance, "kmake-env-1", data)
+	if err != nil || outcome != Created {
+		t.Fatalf("got %v %v", outcome, err)
+	}
+	if cm.Labels["team"] != "build" || metav1.GetControllerOf(cm) == nil {
+		t.Errorf("got %+v", cm)
+	}
+
+	// not recorded yet, so it's taken
+	if _, outcome, err = ensureEnvMap(t, k, instance, "kmake-env-1", data); err != nil || outcome != Adopted {
+		t.Fatalf("unrecorded got %v %v", outcome, err)
+	}
+	instance.Status.UpdateSubResource(bythepowerofv1.EnvMap, "kmake-env-1")
+	if _, outcome, err = ensureEnvMap(t, k, instance, "kmake-env-1", data); err != nil || outcome != Unchanged {
+		t.Fatalf("recorded got %v %v", outcome, err)
+	}
+
+	// drifted
+	cm.Data = map[string]string{"VAR1": "changed"}
+	cm.Labels = nil
+	if err = k.Client.Update(context.Background(), cm); err != nil {
+		t.Fatal(err)
+	}
+	cm, outcome, err = ensureEnvMap(t, k, instance, "kmake-env-1", data)
+	if err != nil || outcome != Updated {
+		t.Fatalf("drifted got %v %v", outcome, err)
+	}
+	get(t, k.Client, types.NamespacedName{Namespace: testKey.Namespace, Name: "kmake-env-1"}, cm)
+	if cm.Data["VAR1"] != "Value1" || cm.Labels["team"] != "build" {
+		t.Errorf("got %+v", cm)
+	}
+
+	// what the kmake needs changed, the old one goes
+	if _, outcome, err = ensureEnvMap(t, k, instance, "kmake-env-2", map[string]string{"VAR1": "Value2"}); err != nil || outcome != Created {
+		t.Fatalf("replaced got %v %v", outcome, err)
+	}
+	err = k.Client.Get(context.Background(), types.NamespacedName{Namespace: testKey.Namespace, Name: "kmake-env-1"}, cm)
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("old one still there %v", err)
+	}
+}
+
+func TestEnsureAdopts(t *testing.T) {
+	other := true
+	k, _ := newTestKind(t,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: testKey.Namespace, Name: "orphan"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: testKey.Namespace, Name: "taken",
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: "v1", Kind: "Pod", Name: "pod", UID: "pod-uid", Controller: &other,
+			}}}},
+	)
+	instance := &bythepowerofv1.Kmake{}
+	get(t, k.Client, testKey, instance)
+
+	cm, outcome, err := ensureEnvMap(t, k, instance, "orphan", nil)
+	if err != nil || outcome != Adopted {
+		t.Fatalf("orphan got %v %v", outcome, err)
+	}
+	get(t, k.Client, types.NamespacedName{Namespace: testKey.Namespace, Name: "orphan"}, cm)
+	if owner := metav1.GetControllerOf(cm); owner == nil || owner.UID != "kmake-uid" {
+		t.Errorf("not adopted %+v", cm)
+	}
+
+	if _, _, err = ensureEnvMap(t, k, instance, "taken", nil); err == nil {
+		t.Error("took another controller's child")
+	}
+}
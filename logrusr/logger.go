@@ -2,25 +2,15 @@ package logrusr
 
 import (
 	"fmt"
+	"path/filepath"
+	"runtime"
+	"time"
+
 	"github.com/activeshadow/logr/util"
 	"github.com/go-logr/logr"
 	"github.com/sirupsen/logrus"
-	"time"
-)
-
-var (
-	verbosity int
-	loggers   []string
 )
 
-func SetVerbosity(v int) {
-	verbosity = v
-}
-
-func LimitToLoggers(names ...string) {
-	loggers = append(loggers, names...)
-}
-
 type clock struct {
 	mock time.Time // set in tests
 }
@@ -33,71 +23,140 @@ func (this *clock) now() time.Time {
 	return this.mock // testing only
 }
 
-type LogrusInfoLogr struct {
-	enabled bool
-	name    string
-	kvs     map[string]interface{}
-	logger  logrus.Logger
+// vLevel is where V(v) logs, Info at 0, Debug at 1 and Trace beyond
+func vLevel(v int) logrus.Level {
+	switch {
+	case v <= 0:
+		return logrus.InfoLevel
+	case v == 1:
+		return logrus.DebugLevel
+	default:
+		return logrus.TraceLevel
+	}
+}
+
+// LogrusSink is a logr.LogSink writing to a logrus logger
+type LogrusSink struct {
+	name   string
+	kvs    map[string]interface{}
+	depth  int
+	info   logr.RuntimeInfo
+	logger *logrus.Logger
+
+	// verbosity is the highest V level logged
+	verbosity int
+	// loggers limits the logging to those named, all of them when empty
+	loggers []string
 
 	// Normally nil, set by test code only.
 	clock *clock
 }
 
-func (this LogrusInfoLogr) Info(msg string, kvs ...interface{}) {
-	if !this.enabled {
-		return
-	}
+var _ logr.LogSink = &LogrusSink{}
+var _ logr.CallDepthLogSink = &LogrusSink{}
 
-	logger := this.logger.WithFields(logrus.Fields{
-		"request": &logrus.Fields{
-			"name": this.name,
-			"kvs":  kvs,
-			// "this_kvs": this.kvs,
-		},
-	})
+func (this *LogrusSink) Init(info logr.RuntimeInfo) {
+	this.info = info
+}
 
-	if logger != nil {
-		logger.Info(msg)
+// Enabled is true for the levels up to the verbosity logrus logs, and only on
+// the loggers we're limited to. Errors are always logged
+func (this *LogrusSink) Enabled(level int) bool {
+	if level > this.verbosity || !this.logger.IsLevelEnabled(vLevel(level)) {
+		return false
 	}
+	return len(this.loggers) == 0 || util.StringSliceContains(this.loggers, this.name)
+}
 
+func (this *LogrusSink) Info(level int, msg string, kvs ...interface{}) {
+	if level > 0 {
+		kvs = append([]interface{}{"v", level}, kvs...)
+	}
+	this.entry(this.caller(), kvs).Log(vLevel(level), msg)
 }
 
-func (this LogrusInfoLogr) Enabled() bool {
-	return this.enabled
+func (this *LogrusSink) Error(err error, msg string, kvs ...interface{}) {
+	this.entry(this.caller(), append([]interface{}{logrus.ErrorKey, err}, kvs...)).Error(msg)
 }
 
-type LogrusLogr struct {
-	LogrusInfoLogr
+// caller is the file and line that called the logr.Logger, as
+// <package>/<file>:<line>
+func (this *LogrusSink) caller() string {
+	// past us, Info or Error and logr's own frames
+	_, file, line, ok := runtime.Caller(2 + this.info.CallDepth + this.depth)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s:%d", filepath.Base(filepath.Dir(file)), filepath.Base(file), line)
 }
 
-func (this LogrusLogr) Error(err error, msg string, kvs ...interface{}) {
+// entry carries the logger's name, the caller, its values and then the
+// call's values as logrus fields, the call's win
+func (this *LogrusSink) entry(caller string, kvs []interface{}) *logrus.Entry {
+	fields := logrus.Fields{}
+
+	if this.name != "" {
+		fields["logger"] = this.name
+	}
+	if caller != "" {
+		fields["caller"] = caller
+	}
+
+	for k, v := range this.kvs {
+		addField(fields, k, v)
+	}
+
+	for i := 0; i < len(kvs); i += 2 {
+		key, ok := kvs[i].(string)
+		if !ok {
+			key = fmt.Sprintf("%v", kvs[i])
+		}
+		if i+1 == len(kvs) {
+			fields[key] = "(MISSING)"
+			break
+		}
+		addField(fields, key, kvs[i+1])
+	}
 
-	logger := this.logger.WithFields(logrus.Fields{
-		"request": &logrus.Fields{
-			"error": err,
-			"name":  this.name,
-			"kvs":   kvs,
-			// "this_kvs": this.kvs,
-		},
-	})
+	return this.logger.WithTime(this.clock.now()).WithFields(fields)
+}
 
-	if logger != nil {
-		logger.Error(msg)
+// addField sets the field, errors become their message and, when they wrap
+// others, a <key>Causes field with the messages of each cause in turn
+func addField(fields logrus.Fields, key string, value interface{}) {
+	err, ok := value.(error)
+	if !ok || err == nil {
+		fields[key] = value
+		return
 	}
 
+	fields[key] = err.Error()
+	if causes := causes(err); len(causes) > 0 {
+		fields[key+"Causes"] = causes
+	}
 }
 
-func (this LogrusLogr) V(level int) logr.InfoLogger {
-	if level <= verbosity {
-		if len(loggers) == 0 || util.StringSliceContains(loggers, this.name) {
-			return this.WithValues("v", level)
+// causes follows both Unwrap and the github.com/pkg/errors Cause
+func causes(err error) []string {
+	ret := make([]string, 0)
+
+	for {
+		switch e := err.(type) {
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		case interface{ Cause() error }:
+			err = e.Cause()
+		default:
+			err = nil
+		}
+		if err == nil {
+			return ret
 		}
+		ret = append(ret, err.Error())
 	}
-
-	return &LogrusInfoLogr{enabled: false}
 }
 
-func (this LogrusLogr) WithValues(kvs ...interface{}) logr.Logger {
+func (this *LogrusSink) WithValues(kvs ...interface{}) logr.LogSink {
 	newKVs := make(map[string]interface{})
 
 	for k, v := range this.kvs {
@@ -105,39 +164,64 @@ func (this LogrusLogr) WithValues(kvs ...interface{}) logr.Logger {
 	}
 
 	for i := 0; i < len(kvs); i += 2 {
-		newKVs[kvs[i].(string)] = kvs[i+1]
+		key, ok := kvs[i].(string)
+		if !ok {
+			key = fmt.Sprintf("%v", kvs[i])
+		}
+		if i+1 == len(kvs) {
+			newKVs[key] = "(MISSING)"
+			break
+		}
+		newKVs[key] = kvs[i+1]
 	}
 
-	return &LogrusLogr{
-		LogrusInfoLogr: LogrusInfoLogr{
-			enabled: this.enabled,
-			name:    this.name,
-			kvs:     newKVs,
-			logger:  this.logger,
-		},
+	sink := *this
+	sink.kvs = newKVs
+	return &sink
+}
+
+func (this *LogrusSink) WithName(name string) logr.LogSink {
+	if this.name != "" {
+		name = fmt.Sprintf("%s.%s", this.name, name)
 	}
+
+	sink := *this
+	sink.name = name
+	return &sink
 }
 
-func (this LogrusLogr) WithName(name string) logr.Logger {
-	name = fmt.Sprintf("%s.%s", this.name, name)
+// WithCallDepth reports the caller depth frames further up the stack
+func (this *LogrusSink) WithCallDepth(depth int) logr.LogSink {
+	sink := *this
+	sink.depth += depth
+	return &sink
+}
 
-	return &LogrusLogr{
-		LogrusInfoLogr: LogrusInfoLogr{
-			enabled: this.enabled,
-			name:    name,
-			kvs:     this.kvs,
-			logger:  this.logger,
-		},
-	}
+// WithVerbosity logs the V levels up to v
+func (this *LogrusSink) WithVerbosity(v int) *LogrusSink {
+	sink := *this
+	sink.verbosity = v
+	return &sink
+}
+
+// WithLoggers limits the logging to the loggers with those full names, none
+// lifts the limit
+func (this *LogrusSink) WithLoggers(names ...string) *LogrusSink {
+	sink := *this
+	sink.loggers = append([]string(nil), names...)
+	return &sink
+}
+
+// New logs to the logrus logger at V(0) on all loggers, see WithVerbosity and
+// WithLoggers for more
+func New(name string, logger *logrus.Logger) logr.Logger {
+	return logr.New(newSink(name, logger))
 }
 
-func New(name string, logger logrus.Logger) logr.Logger {
-	return &LogrusLogr{
-		LogrusInfoLogr: LogrusInfoLogr{
-			enabled: true,
-			name:    name,
-			kvs:     make(map[string]interface{}),
-			logger:  logger,
-		},
+func newSink(name string, logger *logrus.Logger) *LogrusSink {
+	return &LogrusSink{
+		name:   name,
+		kvs:    make(map[string]interface{}),
+		logger: logger,
 	}
 }
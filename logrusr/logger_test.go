@@ -1,86 +1,324 @@
 package logrusr
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/go-logr/logr"
 	"github.com/sirupsen/logrus"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 )
 
-func TestInfoLogger(t *testing.T) {
+// newTestLogger logs JSON to the returned buffer at the mocked time
+func newTestLogger(name string) (logr.Logger, *bytes.Buffer) {
 	mock, _ := time.Parse("2006-01-02", "2015-12-15")
+	out := &bytes.Buffer{}
+
 	l := logrus.New()
+	l.SetOutput(out)
+	l.SetFormatter(&logrus.JSONFormatter{})
+	l.SetLevel(logrus.TraceLevel)
+
+	logger := New(name, l)
+	logger.GetSink().(*LogrusSink).clock = &clock{mock: mock}
+	return logger, out
+}
+
+// filtered logs the V levels up to verbosity, only on the loggers named
+// when there are any
+func filtered(logger logr.Logger, verbosity int, loggers ...string) logr.Logger {
+	return logr.New(logger.GetSink().(*LogrusSink).WithVerbosity(verbosity).WithLoggers(loggers...))
+}
+
+func decode(t *testing.T, out *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+
+	if out.Len() == 0 {
+		t.Fatal("nothing logged")
+	}
+	ret := map[string]interface{}{}
+	if err := json.Unmarshal(out.Bytes(), &ret); err != nil {
+		t.Fatalf("not json: %v: %s", err, out.String())
+	}
+	return ret
+}
+
+func expectFields(t *testing.T, got map[string]interface{}, want map[string]interface{}) {
+	t.Helper()
 
-	logger := New("foo", *l)
-	logger.(*LogrusLogr).clock = &clock{mock: mock}
-	logger.Info("test log", "hello", "world")
+	if caller, _ := got["caller"].(string); !strings.HasPrefix(caller, "logrusr/logger_test.go:") {
+		t.Errorf("got caller %v", got["caller"])
+	}
+	delete(got, "caller")
+
+	want["time"] = "2015-12-15T00:00:00Z"
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestInfoLogger(t *testing.T) {
+	logger, out := newTestLogger("foo")
+
+	logger.Info("test log", "hello", "world", "count", 3)
+	expectFields(t, decode(t, out), map[string]interface{}{
+		"level":  "info",
+		"msg":    "test log",
+		"logger": "foo",
+		"hello":  "world",
+		"count":  float64(3),
+	})
+}
+
+func TestOddKVsLogger(t *testing.T) {
+	logger, out := newTestLogger("foo")
+
+	logger.Info("test log", "hello")
+	expectFields(t, decode(t, out), map[string]interface{}{
+		"level":  "info",
+		"msg":    "test log",
+		"logger": "foo",
+		"hello":  "(MISSING)",
+	})
 }
 
 func TestErrLogger(t *testing.T) {
-	mock, _ := time.Parse("2006-01-02", "2015-12-15")
-	err := errors.New("BOOM SUCKA!")
-	l := logrus.New()
+	logger, out := newTestLogger("bar")
 
-	logger := New("bar", *l)
-	logger.(*LogrusLogr).clock = &clock{mock: mock}
+	err := errors.New("BOOM SUCKA!")
 	logger.Error(err, "test error log", "hello", "world")
+	expectFields(t, decode(t, out), map[string]interface{}{
+		"level":  "error",
+		"msg":    "test error log",
+		"logger": "bar",
+		"error":  "BOOM SUCKA!",
+		"hello":  "world",
+	})
 }
 
-func TestNonVerboseLogger(t *testing.T) {
-	mock, _ := time.Parse("2006-01-02", "2015-12-15")
-	l := logrus.New()
+type causer struct {
+	cause error
+}
 
-	logger := New("sucka", *l)
-	logger.(*LogrusLogr).clock = &clock{mock: mock}
-	logger.V(1).Info("test verbose log", "hello", "crazy world")
+func (c causer) Error() string { return "caused: " + c.cause.Error() }
+func (c causer) Cause() error  { return c.cause }
+
+func TestWrappedErrLogger(t *testing.T) {
+	logger, out := newTestLogger("bar")
+
+	err := fmt.Errorf("reconcile: %w", causer{cause: errors.New("BOOM SUCKA!")})
+	logger.Error(err, "test error log")
+	expectFields(t, decode(t, out), map[string]interface{}{
+		"level":  "error",
+		"msg":    "test error log",
+		"logger": "bar",
+		"error":  "reconcile: caused: BOOM SUCKA!",
+		"errorCauses": []interface{}{
+			"caused: BOOM SUCKA!",
+			"BOOM SUCKA!",
+		},
+	})
 }
 
-func TestVerboseLogger(t *testing.T) {
-	mock, _ := time.Parse("2006-01-02", "2015-12-15")
+func TestErrValueLogger(t *testing.T) {
+	logger, out := newTestLogger("bar")
 
-	SetVerbosity(1)
+	logger.Info("test log", "last", fmt.Errorf("retry: %w", errors.New("BOOM SUCKA!")))
+	expectFields(t, decode(t, out), map[string]interface{}{
+		"level":      "info",
+		"msg":        "test log",
+		"logger":     "bar",
+		"last":       "retry: BOOM SUCKA!",
+		"lastCauses": []interface{}{"BOOM SUCKA!"},
+	})
+}
 
-	l := logrus.New()
+func TestNonVerboseLogger(t *testing.T) {
+	logger, out := newTestLogger("sucka")
 
-	logger := New("sucka", *l)
+	vLogger := logger.V(1)
+	if vLogger.Enabled() {
+		t.Error("V(1) enabled at verbosity 0")
+	}
+	vLogger.Info("test verbose log", "hello", "crazy world")
+	if out.Len() != 0 {
+		t.Errorf("logged %s", out.String())
+	}
+}
+
+func TestVerboseLogger(t *testing.T) {
+	logger, out := newTestLogger("sucka")
+	logger = filtered(logger, 1)
 
 	vLogger := logger.V(1)
-	vLogger.(*LogrusLogr).clock = &clock{mock: mock}
+	if !vLogger.Enabled() {
+		t.Error("V(1) disabled at verbosity 1")
+	}
 	vLogger.Info("test verbose log", "hello", "crazy world")
+	expectFields(t, decode(t, out), map[string]interface{}{
+		"level":  "debug",
+		"msg":    "test verbose log",
+		"logger": "sucka",
+		"v":      float64(1),
+		"hello":  "crazy world",
+	})
 }
 
-func TestNamedLogger(t *testing.T) {
-	mock, _ := time.Parse("2006-01-02", "2015-12-15")
+func TestTraceLogger(t *testing.T) {
+	logger, out := newTestLogger("sucka")
+	logger = filtered(logger, 3)
 
-	l := logrus.New()
+	logger.V(3).Info("test trace log")
+	expectFields(t, decode(t, out), map[string]interface{}{
+		"level":  "trace",
+		"msg":    "test trace log",
+		"logger": "sucka",
+		"v":      float64(3),
+	})
+}
+
+func TestLevelLimitsVerboseLogger(t *testing.T) {
+	logger, out := newTestLogger("sucka")
+	logger = filtered(logger, 2)
+	logger.GetSink().(*LogrusSink).logger.SetLevel(logrus.DebugLevel)
 
-	logger := New("foo", *l)
-	namedLogger := logger.WithName("bar")
-	namedLogger.(*LogrusLogr).clock = &clock{mock: mock}
+	if !logger.V(1).Enabled() {
+		t.Error("V(1) disabled at debug")
+	}
+	vLogger := logger.V(2)
+	if vLogger.Enabled() {
+		t.Error("V(2) enabled at debug")
+	}
+	vLogger.Info("test trace log")
+	if out.Len() != 0 {
+		t.Errorf("logged %s", out.String())
+	}
+}
+
+func TestNamedLogger(t *testing.T) {
+	logger, out := newTestLogger("foo")
+
+	namedLogger := logger.WithName("bar").WithName("baz")
 	namedLogger.Info("test log", "hello", "world")
+	expectFields(t, decode(t, out), map[string]interface{}{
+		"level":  "info",
+		"msg":    "test log",
+		"logger": "foo.bar.baz",
+		"hello":  "world",
+	})
 }
 
-func TestValuesLogger(t *testing.T) {
-	mock, _ := time.Parse("2006-01-02", "2015-12-15")
+func TestUnnamedLogger(t *testing.T) {
+	logger, out := newTestLogger("")
 
-	l := logrus.New()
+	logger.WithName("bar").Info("test log")
+	expectFields(t, decode(t, out), map[string]interface{}{
+		"level":  "info",
+		"msg":    "test log",
+		"logger": "bar",
+	})
+}
+
+func TestValuesLogger(t *testing.T) {
+	logger, out := newTestLogger("foo")
 
-	logger := New("foo", *l)
-	valuesLogger := logger.WithValues("goodbye", "crazy world")
-	valuesLogger.(*LogrusLogr).clock = &clock{mock: mock}
+	valuesLogger := logger.WithValues("goodbye", "crazy world", "hello", "overridden")
 	valuesLogger.Info("test log", "hello", "world")
+	expectFields(t, decode(t, out), map[string]interface{}{
+		"level":   "info",
+		"msg":     "test log",
+		"logger":  "foo",
+		"goodbye": "crazy world",
+		"hello":   "world",
+	})
+}
+
+func TestValuesErrLogger(t *testing.T) {
+	logger, out := newTestLogger("foo")
+
+	valuesLogger := logger.WithName("bar").WithValues("request", "default/kmake")
+	valuesLogger.Error(errors.New("BOOM SUCKA!"), "test error log")
+	expectFields(t, decode(t, out), map[string]interface{}{
+		"level":   "error",
+		"msg":     "test error log",
+		"logger":  "foo.bar",
+		"request": "default/kmake",
+		"error":   "BOOM SUCKA!",
+	})
 }
 
 func TestLimitedLogger(t *testing.T) {
-	mock, _ := time.Parse("2006-01-02", "2015-12-15")
+	logger, out := newTestLogger("foo")
+	logger = filtered(logger, 1, "bar")
 
-	SetVerbosity(1)
-	LimitToLoggers("bar")
+	logger.V(1).Info("test verbose log", "hello", "crazy world")
+	logger.Info("test log", "hello", "crazy world")
+	if out.Len() != 0 {
+		t.Errorf("logged %s", out.String())
+	}
 
-	l := logrus.New()
+	logger.Error(errors.New("BOOM SUCKA!"), "test error log")
+	if out.Len() == 0 {
+		t.Error("error not logged")
+	}
 
-	logger := New("foo", *l)
-	vLogger := logger.V(1)
-	vLogger.(*LogrusInfoLogr).clock = &clock{mock: mock}
-	vLogger.Info("test verbose log", "hello", "crazy world")
+	logger, out = newTestLogger("bar")
+	logger = filtered(logger, 1, "bar")
+	logger.V(1).Info("test verbose log", "hello", "crazy world")
+	expectFields(t, decode(t, out), map[string]interface{}{
+		"level":  "debug",
+		"msg":    "test verbose log",
+		"logger": "bar",
+		"v":      float64(1),
+		"hello":  "crazy world",
+	})
+}
+
+func TestLimitedLoggerReplaced(t *testing.T) {
+	logger, out := newTestLogger("foo")
+	sink := logger.GetSink().(*LogrusSink).WithLoggers("foo").WithLoggers("bar")
+
+	logr.New(sink).Info("test log")
+	if out.Len() != 0 {
+		t.Errorf("logged %s", out.String())
+	}
+
+	logr.New(sink.WithLoggers()).Info("test log")
+	if out.Len() == 0 {
+		t.Error("nothing logged once the limit is lifted")
+	}
+}
+
+// logVia logs as if it were its caller
+func logVia(logger logr.Logger) {
+	logger.WithCallDepth(1).Info("test log")
+}
+
+func TestCallDepthLogger(t *testing.T) {
+	logger, out := newTestLogger("foo")
+
+	_, _, line, _ := runtime.Caller(0)
+	logVia(logger)
+
+	got := decode(t, out)
+	if want := fmt.Sprintf("logrusr/logger_test.go:%d", line+1); got["caller"] != want {
+		t.Errorf("got caller %v, want %v", got["caller"], want)
+	}
+}
+
+func TestCallerLogger(t *testing.T) {
+	logger, out := newTestLogger("foo")
+
+	_, _, line, _ := runtime.Caller(0)
+	logger.WithName("bar").WithValues("hello", "world").Error(errors.New("BOOM SUCKA!"), "test error log")
+
+	got := decode(t, out)
+	if want := fmt.Sprintf("logrusr/logger_test.go:%d", line+1); got["caller"] != want {
+		t.Errorf("got caller %v, want %v", got["caller"], want)
+	}
 }
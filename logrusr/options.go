@@ -0,0 +1,88 @@
+package logrusr
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/namsral/flag"
+	"github.com/sirupsen/logrus"
+)
+
+// Options are how the loggers Build makes log
+type Options struct {
+	// Verbosity is the highest V level logged
+	Verbosity int
+	// Level is the logrus level, empty for the one Verbosity needs
+	Level string
+	// Format is json, text or logfmt
+	Format string
+	// Color is when text is coloured, auto on a terminal, always or never
+	Color string
+	// PrettyPrint indents the json
+	PrettyPrint bool
+	// Loggers, comma separated, limits the logging to those named
+	Loggers string
+}
+
+// BindFlags adds --v, --log-level, --log-format, --log-color, --log-loggers
+// and --enable-pretty-print to the flag set
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	fs.IntVar(&o.Verbosity, "v", 0,
+		"The verbosity, V(1) logs at debug and higher at trace")
+	fs.StringVar(&o.Level, "log-level", "",
+		"The logrus level, one of panic, fatal, error, warn, info, debug or trace - defaults to what --v needs")
+	fs.StringVar(&o.Format, "log-format", "json",
+		"The log format, one of json, text or logfmt")
+	fs.StringVar(&o.Color, "log-color", "auto",
+		"When the text format is coloured, one of auto (on a terminal), always or never")
+	fs.BoolVar(&o.PrettyPrint, "enable-pretty-print", false,
+		"Enable pretty print JSON logging")
+	fs.StringVar(&o.Loggers, "log-loggers", "",
+		"Comma separated full names of the loggers to limit logging to, errors are always logged - leave empty for all")
+}
+
+// Build makes the named logger with the verbosity and logger limits
+func (o Options) Build(name string) (logr.Logger, error) {
+	l := logrus.New()
+
+	level := vLevel(o.Verbosity)
+	if o.Level != "" {
+		var err error
+		level, err = logrus.ParseLevel(o.Level)
+		if err != nil {
+			return logr.Logger{}, err
+		}
+	}
+	l.SetLevel(level)
+
+	switch strings.ToLower(o.Format) {
+	case "", "json":
+		l.SetFormatter(&logrus.JSONFormatter{PrettyPrint: o.PrettyPrint})
+	case "text":
+		// for people, the values unquoted and coloured as --log-color says,
+		// always for kubectl logs as that's not a terminal
+		f := &logrus.TextFormatter{DisableQuote: true, PadLevelText: true, FullTimestamp: true}
+		switch strings.ToLower(o.Color) {
+		case "", "auto":
+		case "always":
+			f.ForceColors = true
+		case "never":
+			f.DisableColors = true
+		default:
+			return logr.Logger{}, fmt.Errorf("unknown log color %v, use auto, always or never", o.Color)
+		}
+		l.SetFormatter(f)
+	case "logfmt":
+		// for machines, plain sorted key=value pairs whatever the output
+		l.SetFormatter(&logrus.TextFormatter{DisableColors: true, DisableQuote: false, DisableSorting: false, FullTimestamp: true})
+	default:
+		return logr.Logger{}, fmt.Errorf("unknown log format %v, use json, text or logfmt", o.Format)
+	}
+
+	sink := newSink(name, l).WithVerbosity(o.Verbosity)
+	if o.Loggers != "" {
+		sink = sink.WithLoggers(strings.Split(o.Loggers, ",")...)
+	}
+	return logr.New(sink), nil
+}
@@ -0,0 +1,131 @@
+package logrusr
+
+import (
+	"bytes"
+	"github.com/namsral/flag"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"testing"
+)
+
+func TestOptionsFlags(t *testing.T) {
+	o := Options{}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	o.BindFlags(fs)
+
+	err := fs.Parse([]string{"--v=2", "--log-level=warn", "--log-format=logfmt", "--log-color=never", "--log-loggers=foo,bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Options{Verbosity: 2, Level: "warn", Format: "logfmt", Color: "never", Loggers: "foo,bar"}
+	if o != want {
+		t.Errorf("got %+v, want %+v", o, want)
+	}
+}
+
+func TestOptionsBuild(t *testing.T) {
+	for _, test := range []struct {
+		options Options
+		level   logrus.Level
+		format  interface{}
+		loggers []string
+	}{
+		{Options{}, logrus.InfoLevel, &logrus.JSONFormatter{}, nil},
+		{Options{Verbosity: 1}, logrus.DebugLevel, &logrus.JSONFormatter{}, nil},
+		{Options{Verbosity: 2, Format: "text"}, logrus.TraceLevel,
+			&logrus.TextFormatter{DisableQuote: true, FullTimestamp: true}, nil},
+		{Options{Format: "text", Color: "always"}, logrus.InfoLevel,
+			&logrus.TextFormatter{ForceColors: true, DisableQuote: true, FullTimestamp: true}, nil},
+		{Options{Format: "text", Color: "never"}, logrus.InfoLevel,
+			&logrus.TextFormatter{DisableColors: true, DisableQuote: true, FullTimestamp: true}, nil},
+		{Options{Verbosity: 2, Level: "error", Format: "logfmt", Loggers: "foo,bar"}, logrus.ErrorLevel,
+			&logrus.TextFormatter{DisableColors: true, FullTimestamp: true}, []string{"foo", "bar"}},
+		{Options{PrettyPrint: true}, logrus.InfoLevel, &logrus.JSONFormatter{PrettyPrint: true}, nil},
+	} {
+		logger, err := test.options.Build("foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		l := logger.GetSink().(*LogrusSink).logger
+
+		if l.Level != test.level {
+			t.Errorf("%+v: got level %v, want %v", test.options, l.Level, test.level)
+		}
+		if !equalFormatters(l.Formatter, test.format) {
+			t.Errorf("%+v: got formatter %+v, want %+v", test.options, l.Formatter, test.format)
+		}
+		sink := logger.GetSink().(*LogrusSink)
+		if sink.verbosity != test.options.Verbosity {
+			t.Errorf("%+v: got verbosity %v", test.options, sink.verbosity)
+		}
+		if strings.Join(sink.loggers, ",") != strings.Join(test.loggers, ",") {
+			t.Errorf("%+v: got loggers %v, want %v", test.options, sink.loggers, test.loggers)
+		}
+	}
+}
+
+func equalFormatters(got logrus.Formatter, want interface{}) bool {
+	switch w := want.(type) {
+	case *logrus.JSONFormatter:
+		g, ok := got.(*logrus.JSONFormatter)
+		return ok && g.PrettyPrint == w.PrettyPrint
+	case *logrus.TextFormatter:
+		g, ok := got.(*logrus.TextFormatter)
+		return ok && g.ForceColors == w.ForceColors && g.DisableColors == w.DisableColors &&
+			g.DisableQuote == w.DisableQuote && g.DisableSorting == w.DisableSorting && g.FullTimestamp == w.FullTimestamp
+	}
+	return false
+}
+
+func TestOptionsBuildErrors(t *testing.T) {
+	if _, err := (Options{Level: "loud"}).Build("foo"); err == nil {
+		t.Error("built with a bad level")
+	}
+	if _, err := (Options{Format: "xml"}).Build("foo"); err == nil {
+		t.Error("built with a bad format")
+	}
+	if _, err := (Options{Format: "text", Color: "sometimes"}).Build("foo"); err == nil {
+		t.Error("built with a bad color")
+	}
+}
+
+func TestOptionsLogfmt(t *testing.T) {
+	logger, err := (Options{Format: "logfmt"}).Build("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	logger.GetSink().(*LogrusSink).logger.SetOutput(out)
+
+	logger.Info("test log", "hello", "world")
+	for _, want := range []string{"level=info", `msg="test log"`, "logger=foo", "hello=world"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("%q missing from %q", want, out.String())
+		}
+	}
+}
+
+func TestOptionsTextAndLogfmtDiffer(t *testing.T) {
+	output := func(format string, color string) string {
+		logger, err := (Options{Format: format, Color: color}).Build("foo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := &bytes.Buffer{}
+		logger.GetSink().(*LogrusSink).logger.SetOutput(out)
+		logger.Info("test log", "hello", "world")
+		return out.String()
+	}
+
+	// not a terminal, so only coloured when asked, but never quoted
+	if text := output("text", ""); strings.Contains(text, "\x1b[") || !strings.Contains(text, "msg=test log") {
+		t.Errorf("text is coloured or quoted: %q", text)
+	}
+	if text := output("text", "always"); !strings.Contains(text, "\x1b[") {
+		t.Errorf("text isn't coloured: %q", text)
+	}
+	if logfmt := output("logfmt", "always"); strings.Contains(logfmt, "\x1b[") || !strings.Contains(logfmt, `msg="test log"`) {
+		t.Errorf("logfmt is coloured or unquoted: %q", logfmt)
+	}
+}
@@ -16,18 +16,27 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"fmt"
 	"github.com/namsral/flag"
+	"net/http"
 	"os"
-	"strings"
+	"time"
 
 	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+	"github.com/bythepowerof/kmake-controller/controllerconfig"
 	"github.com/bythepowerof/kmake-controller/controllers"
 	"github.com/bythepowerof/kmake-controller/logrusr"
-	"github.com/sirupsen/logrus"
+	"github.com/bythepowerof/kmake-controller/receiver"
+	"github.com/bythepowerof/kmake-controller/scope"
+	"github.com/bythepowerof/kmake-controller/tracing"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
-	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	// +kubebuilder:scaffold:imports
 )
 
@@ -45,41 +54,81 @@ func init() {
 
 func main() {
 	var metricsAddr string
+	var probeAddr string
+	var pprofAddr string
 	var enableLeaderElection bool
-	var enablePrettyPrint bool
-	var namespace string
+	var enableWebhooks bool
+	var receiverAddr string
 	flag.StringVar(&metricsAddr, "metrics-addr", ":8088", "The address the metric endpoint binds to.")
+	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the /healthz and /readyz probes bind to.")
+	flag.StringVar(&pprofAddr, "pprof-bind-address", "",
+		"The address the pprof endpoints bind to - leave empty to disable them.")
 	flag.BoolVar(&enableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. Enabling this will ensure there is only one active controller manager.")
-	flag.BoolVar(&enablePrettyPrint, "enable-pretty-print", false,
-		"Enable pretty print JSON logging")
-	flag.StringVar(&namespace, "namespace", "all",
-		"Namespace to watch - use 'all' for all namespaces")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Enable the validating admission webhooks - needs the webhook certificates")
+	flag.StringVar(&receiverAddr, "receiver-addr", "",
+		"The address the push webhook receiver binds to - leave empty to disable it.")
 
-	flag.Parse()
+	logOptions := logrusr.Options{}
+	logOptions.BindFlags(flag.CommandLine)
+
+	traceOptions := tracing.Options{}
+	traceOptions.BindFlags(flag.CommandLine)
 
-	// Create new "foo" logger that's enabled and has a verbosity level of 1.
-	l := logrus.New()
+	scopeOptions := scope.Options{}
+	scopeOptions.BindFlags(flag.CommandLine)
 
-	// PrettyPrint should be false/not set
-	l.SetFormatter(&logrus.JSONFormatter{PrettyPrint: enablePrettyPrint})
+	configOptions := controllerconfig.Options{}
+	configOptions.BindFlags(flag.CommandLine)
 
-	logger := logrusr.New("kmake", *l)
+	flag.Parse()
+
+	logger, err := logOptions.Build("kmake")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to set up logging: %v\n", err)
+		os.Exit(1)
+	}
 
 	ctrl.SetLogger(logger)
 
-	options := ctrl.Options{
-		Scheme:             scheme,
-		MetricsBindAddress: metricsAddr,
-		LeaderElection:     enableLeaderElection,
-		Port:               9443,
+	config, err := configOptions.Build()
+	if err != nil {
+		setupLog.Error(err, "unable to load the config")
+		os.Exit(1)
 	}
+	config.Log = ctrl.Log.WithName("config")
+	recorders := config.Get().Recorders
 
-	setupLog.Info("watching", "namespace", namespace)
+	ctx := ctrl.SetupSignalHandler()
 
-	if strings.ToLower(namespace) != "all" {
-		options.Namespace = namespace
+	shutdownTracing, err := traceOptions.Setup(ctx, "kmake-controller")
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+
+	options := ctrl.Options{
+		Scheme:                 scheme,
+		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
+		HealthProbeBindAddress: probeAddr,
+		PprofBindAddress:       pprofAddr,
+		LeaderElection:         enableLeaderElection,
+		LeaderElectionID:       "kmake-controller.bythepowerof.github.com",
+		WebhookServer:          webhook.NewServer(webhook.Options{Port: config.Get().Webhook.Port}),
+		// our own so a busy scheduler's events are limited and combined, it
+		// lives as long as the process so doesn't leak
+		EventBroadcaster: record.NewBroadcasterWithCorrelatorOptions(config.Get().Events.CorrelatorOptions()),
+	}
+
+	watching, err := scopeOptions.Build()
+	if err != nil {
+		setupLog.Error(err, "unable to set up what to watch")
+		os.Exit(1)
 	}
+	options.Cache = watching.Cache()
+
+	setupLog.Info("watching", "scope", watching.String())
 
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 
@@ -90,9 +139,10 @@ func main() {
 
 	if err = (&controllers.KmakeReconciler{
 		Client:   mgr.GetClient(),
-		Log:      ctrl.Log.WithName("controllers").WithName("kmake").WithName(namespace),
-		Recorder: mgr.GetEventRecorderFor("kmake-controller"),
+		Recorder: mgr.GetEventRecorderFor(recorders.Kmake),
 		Scheme:   scheme,
+		Scope:    watching,
+		Config:   config,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Kmake")
 		os.Exit(1)
@@ -100,36 +150,109 @@ func main() {
 
 	if err = (&controllers.KmakeNowSchedulerReconciler{
 		Client:   mgr.GetClient(),
-		Log:      ctrl.Log.WithName("controllers").WithName("KmakeNowScheduler").WithName(namespace),
-		Recorder: mgr.GetEventRecorderFor("kmake-now-scheduler-controller"),
+		Recorder: mgr.GetEventRecorderFor(recorders.NowScheduler),
 		Scheme:   scheme,
+		Scope:    watching,
+		Config:   config,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "KmakeNowScheduler")
 		os.Exit(1)
 	}
+	if err = (&controllers.KmakeTriggerSchedulerReconciler{
+		Client:    mgr.GetClient(),
+		Recorder:  mgr.GetEventRecorderFor(recorders.TriggerScheduler),
+		Scheme:    scheme,
+		Scope:     watching,
+		Config:    config,
+		APIReader: mgr.GetAPIReader(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "KmakeTriggerScheduler")
+		os.Exit(1)
+	}
 	if err = (&controllers.KmakeScheduleRunReconciler{
-		Client:   mgr.GetClient(),
-		Log:      ctrl.Log.WithName("controllers").WithName("KmakeScheduleRun").WithName(namespace),
-		Recorder: mgr.GetEventRecorderFor("kmake-schedule-run-controller"),
-		Scheme:   scheme,
+		Client:    mgr.GetClient(),
+		APIReader: mgr.GetAPIReader(),
+		Recorder:  mgr.GetEventRecorderFor(recorders.ScheduleRun),
+		Scheme:    scheme,
+		Scope:     watching,
+		Config:    config,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "KmakeScheduleRun")
 		os.Exit(1)
 	}
 	if err = (&controllers.KmakeRunReconciler{
 		Client:   mgr.GetClient(),
-		Log:      ctrl.Log.WithName("controllers").WithName("KmakeRun").WithName(namespace),
-		Recorder: mgr.GetEventRecorderFor("kmake-run-controller"),
+		Recorder: mgr.GetEventRecorderFor(recorders.KmakeRun),
 		Scheme:   scheme,
+		Scope:    watching,
+		Config:   config,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "KmakeRun")
 		os.Exit(1)
 	}
+	if enableWebhooks {
+		if err = (&bythepowerofv1.Kmake{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Kmake")
+			os.Exit(1)
+		}
+		if err = mgr.AddReadyzCheck("webhook", mgr.GetWebhookServer().StartedChecker()); err != nil {
+			setupLog.Error(err, "unable to set up ready check", "check", "webhook")
+			os.Exit(1)
+		}
+	}
+	if receiverAddr != "" {
+		r := &receiver.Receiver{
+			Client:    mgr.GetClient(),
+			APIReader: mgr.GetAPIReader(),
+			Log:       ctrl.Log.WithName("receiver"),
+			Scheme:    scheme,
+			Scope:     watching,
+			Addr:      receiverAddr,
+		}
+		if err = r.SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook receiver")
+			os.Exit(1)
+		}
+	}
 	// +kubebuilder:scaffold:builder
 
+	if err = mgr.Add(config); err != nil {
+		setupLog.Error(err, "unable to reload the config on SIGHUP")
+		os.Exit(1)
+	}
+
+	if err = mgr.AddHealthzCheck("ping", healthz.Ping); err != nil {
+		setupLog.Error(err, "unable to set up health check", "check", "ping")
+		os.Exit(1)
+	}
+	if err = mgr.AddReadyzCheck("cache", cacheSynced(mgr)); err != nil {
+		setupLog.Error(err, "unable to set up ready check", "check", "cache")
+		os.Exit(1)
+	}
+
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	err = mgr.Start(ctx)
+
+	// flush what's left of the traces
+	if err := shutdownTracing(context.Background()); err != nil {
+		setupLog.Error(err, "problem shutting down tracing")
+	}
+	if err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// cacheSynced is ready once the manager's informers have synced, it only
+// waits as long as the probe lets it
+func cacheSynced(mgr ctrl.Manager) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), time.Second)
+		defer cancel()
+
+		if !mgr.GetCache().WaitForCacheSync(ctx) {
+			return fmt.Errorf("informer caches haven't synced")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,409 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package receiver starts schedule runs from signed push webhooks
+package receiver
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+	"github.com/bythepowerof/kmake-controller/controllers"
+	"github.com/bythepowerof/kmake-controller/scope"
+)
+
+// HooksPath prefixes the receiver's routes, /hooks/<namespace>/<scheduler>/<run>
+const HooksPath = "/hooks/"
+
+// maxPayload bounds the push payloads we'll read
+const maxPayload = 1 << 20
+
+// Receiver creates a KmakeScheduleRun for each signed POST it is sent
+type Receiver struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+	// APIReader reads the schedulers' webhook secrets around the cache,
+	// which only has their metadata. Nil reads the cache
+	APIReader client.Reader
+	// Addr is where the receiver listens
+	Addr string
+	// Scope is the namespaces we start runs in, nil for all of them
+	Scope *scope.Scope
+
+	// listening is set while Start is serving
+	listening atomic.Bool
+}
+
+// pushEvent is the part of a GitHub or GitLab push payload we use
+type pushEvent struct {
+	Ref         string `json:"ref"`
+	After       string `json:"after"`
+	CheckoutSHA string `json:"checkout_sha"`
+}
+
+// Variables are the overrides a push gives the run
+func (p *pushEvent) Variables() map[string]string {
+	vars := map[string]string{}
+
+	if strings.HasPrefix(p.Ref, "refs/heads/") {
+		vars["BRANCH"] = strings.TrimPrefix(p.Ref, "refs/heads/")
+	}
+
+	commit := p.CheckoutSHA
+	if commit == "" {
+		commit = p.After
+	}
+	if commit != "" {
+		vars["COMMIT"] = commit
+	}
+	return vars
+}
+
+// Start runs the receiver until ctx is done, it's a manager.Runnable
+func (r *Receiver) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle(HooksPath, r)
+
+	listener, err := net.Listen("tcp", r.Addr)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: mux}
+	errc := make(chan error, 1)
+
+	r.listening.Store(true)
+	defer r.listening.Store(false)
+
+	go func() {
+		r.Log.Info("starting webhook receiver", "addr", listener.Addr().String())
+		errc <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return server.Shutdown(shutdown)
+	}
+}
+
+// NeedLeaderElection is false so each replica listens and passes its ready
+// check, a run started twice by the same delivery is only made once
+func (r *Receiver) NeedLeaderElection() bool {
+	return false
+}
+
+// Ready is a healthz.Checker that passes while the receiver is listening
+func (r *Receiver) Ready(_ *http.Request) error {
+	if !r.listening.Load() {
+		return fmt.Errorf("webhook receiver isn't listening on %v", r.Addr)
+	}
+	return nil
+}
+
+// SetupWithManager adds the receiver to the manager with its ready check, so
+// a replica only gets webhooks once its listener is bound
+func (r *Receiver) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.Add(r); err != nil {
+		return err
+	}
+	return mgr.AddReadyzCheck("receiver", r.Ready)
+}
+
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	log := r.Log.WithValues("path", req.URL.Path)
+
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, HooksPath), "/"), "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		http.Error(w, "expected "+HooksPath+"<namespace>/<scheduler>/<run>", http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxPayload))
+	if err != nil {
+		http.Error(w, "unable to read payload", http.StatusBadRequest)
+		return
+	}
+
+	// each scheduler has its own secret, so one can't start another's runs.
+	// Until the request is signed with it, all it's told is no, so it
+	// can't find what namespaces and schedulers there are
+	namespaced := types.NamespacedName{Namespace: parts[0], Name: parts[1]}
+	scheduler, err := r.authenticate(req.Context(), namespaced, req.Header, body)
+	if err != nil {
+		log.Info("rejecting webhook", "reason", err.Error())
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	push := &pushEvent{}
+	if len(body) > 0 {
+		if err = json.Unmarshal(body, push); err != nil {
+			http.Error(w, fmt.Sprintf("bad payload: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	name, created, err := r.startRun(req.Context(), scheduler, namespaced, parts[2], Delivery(req.Header), push.Variables())
+	if err != nil {
+		apiError(w, log, "unable to start run", err)
+		return
+	}
+
+	log.Info("started run", "schedulerun", name, "created", created)
+
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(w).Encode(map[string]string{"name": name})
+}
+
+// apiError replies with the status of an api error, or a 500
+func apiError(w http.ResponseWriter, log logr.Logger, msg string, err error) {
+	code := http.StatusInternalServerError
+	if status, ok := err.(errors.APIStatus); ok {
+		code = int(status.Status().Code)
+	}
+	log.Error(err, msg)
+	http.Error(w, err.Error(), code)
+}
+
+// Authenticated checks the GitHub HMAC signature of the body or, as GitLab
+// doesn't sign its hooks, its secret token
+func Authenticated(secret []byte, header http.Header, body []byte) bool {
+	if len(secret) == 0 {
+		return false
+	}
+
+	if sig := header.Get("X-Hub-Signature-256"); sig != "" {
+		got, err := hex.DecodeString(strings.TrimPrefix(sig, "sha256="))
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(body)
+		return hmac.Equal(got, mac.Sum(nil))
+	}
+
+	if token := header.Get("X-Gitlab-Token"); token != "" {
+		return subtle.ConstantTimeCompare([]byte(token), secret) == 1
+	}
+	return false
+}
+
+// Delivery is the hook's id for the push, the same on each retry, or else a
+// fresh one
+func Delivery(header http.Header) string {
+	for _, h := range []string{"X-GitHub-Delivery", "X-Gitlab-Event-UUID"} {
+		if id := header.Get(h); id != "" {
+			return id
+		}
+	}
+	return fmt.Sprintf("%d", time.Now().UnixNano())
+}
+
+// authenticate finds the scheduler and checks the body is signed with its
+// secret, or says why not
+func (r *Receiver) authenticate(ctx context.Context, name types.NamespacedName, header http.Header, body []byte) (*hookScheduler, error) {
+	watched, err := r.Scope.Contains(ctx, r, name.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	if !watched {
+		return nil, fmt.Errorf("namespace %v isn't watched", name.Namespace)
+	}
+
+	scheduler, err := r.getScheduler(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := r.webhookSecret(ctx, name.Namespace, scheduler.secret)
+	if err != nil {
+		return nil, err
+	}
+	if !Authenticated(secret, header, body) {
+		return nil, fmt.Errorf("bad signature")
+	}
+	return scheduler, nil
+}
+
+// startRun creates the schedule run for the run under the scheduler, or finds
+// the one an earlier try of the same delivery made
+func (r *Receiver) startRun(ctx context.Context, hook *hookScheduler, scheduler types.NamespacedName, runName string, delivery string, variables map[string]string) (string, bool, error) {
+	owner, envmap := hook.owner, hook.envmap
+
+	if envmap == "" {
+		return "", false, errors.NewServiceUnavailable(fmt.Sprintf("scheduler %v is not ready", scheduler.Name))
+	}
+	if now, ok := owner.(*bythepowerofv1.KmakeNowScheduler); ok && now.IsSuspended() {
+		return "", false, errors.NewConflict(bythepowerofv1.GroupVersion.WithResource("kmakenowschedulers").GroupResource(),
+			scheduler.Name, fmt.Errorf("scheduler is suspended"))
+	}
+
+	run := &bythepowerofv1.KmakeRun{}
+	err := r.Get(ctx, types.NamespacedName{Namespace: scheduler.Namespace, Name: runName}, run)
+	if err != nil {
+		return "", false, err
+	}
+	// the scheduler's secret only starts the runs it monitors
+	if !hook.monitors(run) {
+		return "", false, errors.NewForbidden(bythepowerofv1.GroupVersion.WithResource("kmakeruns").GroupResource(),
+			runName, fmt.Errorf("not monitored by scheduler %v", scheduler.Name))
+	}
+	kmakeName := run.GetKmakeName()
+	if kmakeName == "" {
+		return "", false, fmt.Errorf("run %v not connected to kmake", runName)
+	}
+
+	kmsr := &bythepowerofv1.KmakeScheduleRun{
+		ObjectMeta: controllers.ObjectMetaConcat(owner, scheduler, bythepowerofv1.ScheduleRun, run.GetUID(), delivery),
+		Spec: bythepowerofv1.KmakeScheduleRunSpec{
+			KmakeScheduleRunOperation: bythepowerofv1.KmakeScheduleRunOperation{
+				Start: &bythepowerofv1.KmakeScheduleRunStart{
+					Variables: variables,
+				},
+			},
+		},
+	}
+	ctrl.SetControllerReference(owner, kmsr, r.Scheme)
+	controllers.SetOwnerReference(run, kmsr, r.Scheme)
+
+	kmsr.SetLabels(controllers.ScheduleRunLabels(owner, map[string]string{
+		bythepowerofv1.MakeDomainString(bythepowerofv1.KmakeLabel):          kmakeName,
+		bythepowerofv1.MakeDomainString(bythepowerofv1.KmakeNamespaceLabel): run.GetKmakeNamespace(),
+		bythepowerofv1.MakeDomainString(bythepowerofv1.ScheduleInstLabel):   scheduler.Name,
+		bythepowerofv1.MakeDomainString(bythepowerofv1.ScheduleEnvLabel):    envmap,
+		bythepowerofv1.MakeDomainString(bythepowerofv1.RunLabel):            run.GetName(),
+		bythepowerofv1.MakeDomainString(bythepowerofv1.WorkloadLabel):       "yes",
+		bythepowerofv1.MakeDomainString(bythepowerofv1.StatusLabel):         "Provision",
+	}))
+
+	err = r.Create(ctx, kmsr)
+	if errors.IsAlreadyExists(err) {
+		return kmsr.GetName(), false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return kmsr.GetName(), true, nil
+}
+
+// hookScheduler is what the receiver needs of a now or trigger scheduler
+type hookScheduler struct {
+	owner metav1.Object
+	// envmap is the scheduler's env map, empty until it's ready
+	envmap string
+	// secret names its webhook secret
+	secret string
+	// monitor is the schedule labels of the runs it starts
+	monitor []string
+}
+
+// monitors is true if the run is one the scheduler starts
+func (s *hookScheduler) monitors(run *bythepowerofv1.KmakeRun) bool {
+	label := bythepowerofv1.GetDomainLabel(run.GetLabels(), bythepowerofv1.ScheduleLabel)
+	for _, m := range s.monitor {
+		if label != "" && label == m {
+			return true
+		}
+	}
+	return false
+}
+
+// getScheduler finds the now or trigger scheduler with the name
+func (r *Receiver) getScheduler(ctx context.Context, name types.NamespacedName) (*hookScheduler, error) {
+	now := &bythepowerofv1.KmakeNowScheduler{}
+	err := r.Get(ctx, name, now)
+	if err == nil {
+		return &hookScheduler{
+			owner:   now,
+			envmap:  now.Status.GetSubReference(bythepowerofv1.EnvMap),
+			secret:  now.Spec.WebhookSecret,
+			monitor: now.Spec.Monitor,
+		}, nil
+	}
+	if !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	trigger := &bythepowerofv1.KmakeTriggerScheduler{}
+	err = r.Get(ctx, name, trigger)
+	if err != nil {
+		return nil, err
+	}
+	return &hookScheduler{
+		owner:   trigger,
+		envmap:  trigger.Status.GetSubReference(bythepowerofv1.EnvMap),
+		secret:  trigger.Spec.WebhookSecret,
+		monitor: trigger.Spec.Monitor,
+	}, nil
+}
+
+// webhookSecret is the key of the named secret that signs the webhooks, empty
+// when the scheduler doesn't name one or it isn't there
+func (r *Receiver) webhookSecret(ctx context.Context, namespace string, name string) ([]byte, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	var reader client.Reader = r.Client
+	if r.APIReader != nil {
+		reader = r.APIReader
+	}
+
+	secret := &corev1.Secret{}
+	err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return secret.Data[bythepowerofv1.WebhookSecretKey], nil
+}
@@ -0,0 +1,334 @@
+package receiver
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
+
+	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+	"github.com/bythepowerof/kmake-controller/scope"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+const payload = `{"ref":"refs/heads/feature","after":"0123abcd"}`
+
+func sign(secret string, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+var _ = Describe("Receiver", func() {
+	var (
+		r *Receiver
+		c client.Client
+	)
+
+	post := func(path string, body string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(bythepowerofv1.AddToScheme(scheme)).To(Succeed())
+
+		scheduler := &bythepowerofv1.KmakeNowScheduler{
+			ObjectMeta: metav1.ObjectMeta{Name: "now", Namespace: "default", UID: "1", Labels: map[string]string{"shard": "1"}},
+			Spec:       bythepowerofv1.KmakeNowSchedulerSpec{Monitor: []string{"nightly"}, WebhookSecret: "now-hook"},
+			Status: bythepowerofv1.KmakeNowSchedulerStatus{KmakeStatus: bythepowerofv1.KmakeStatus{
+				Resources: map[string]string{"EnvMap": "now-envmap"},
+			}},
+		}
+		run := &bythepowerofv1.KmakeRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "build",
+				Namespace: "default",
+				UID:       "2",
+				Labels: map[string]string{
+					"bythepowerof.github.io/kmake":     "kmake",
+					"bythepowerof.github.io/scheduler": "nightly",
+				},
+			},
+		}
+		// a run none of the schedulers monitor
+		adhoc := &bythepowerofv1.KmakeRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "adhoc",
+				Namespace: "default",
+				UID:       "5",
+				Labels: map[string]string{
+					"bythepowerof.github.io/kmake":     "kmake",
+					"bythepowerof.github.io/scheduler": "adhoc",
+				},
+			},
+		}
+
+		// another scheduler in the namespace with its own secret, and one
+		// with none
+		other := &bythepowerofv1.KmakeTriggerScheduler{
+			ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default", UID: "3"},
+			Spec:       bythepowerofv1.KmakeTriggerSchedulerSpec{Monitor: []string{"nightly"}, WebhookSecret: "other-hook"},
+			Status: bythepowerofv1.KmakeTriggerSchedulerStatus{KmakeStatus: bythepowerofv1.KmakeStatus{
+				Resources: map[string]string{"EnvMap": "other-envmap"},
+			}},
+		}
+		open := &bythepowerofv1.KmakeNowScheduler{
+			ObjectMeta: metav1.ObjectMeta{Name: "open", Namespace: "default", UID: "4"},
+			Status: bythepowerofv1.KmakeNowSchedulerStatus{KmakeStatus: bythepowerofv1.KmakeStatus{
+				Resources: map[string]string{"EnvMap": "open-envmap"},
+			}},
+		}
+		hook := func(name string, secret string) *corev1.Secret {
+			return &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+				Data:       map[string][]byte{bythepowerofv1.WebhookSecretKey: []byte(secret)},
+			}
+		}
+
+		c = fake.NewClientBuilder().WithScheme(scheme).
+			WithObjects(scheduler, other, open, run, adhoc, hook("now-hook", "s3cret"), hook("other-hook", "0ther")).Build()
+		r = &Receiver{
+			Client: c,
+			Log:    zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)),
+			Scheme: scheme,
+		}
+	})
+
+	Context("Authentication", func() {
+		secret := []byte("s3cret")
+
+		It("should accept a GitHub signature", func() {
+			Expect(Authenticated(secret, http.Header{"X-Hub-Signature-256": []string{sign("s3cret", payload)}}, []byte(payload))).To(BeTrue())
+		})
+
+		It("should reject a signature made with another secret", func() {
+			Expect(Authenticated(secret, http.Header{"X-Hub-Signature-256": []string{sign("other", payload)}}, []byte(payload))).To(BeFalse())
+		})
+
+		It("should reject a signature of another payload", func() {
+			Expect(Authenticated(secret, http.Header{"X-Hub-Signature-256": []string{sign("s3cret", payload)}}, []byte("{}"))).To(BeFalse())
+		})
+
+		It("should accept a GitLab token", func() {
+			Expect(Authenticated(secret, http.Header{"X-Gitlab-Token": []string{"s3cret"}}, []byte(payload))).To(BeTrue())
+			Expect(Authenticated(secret, http.Header{"X-Gitlab-Token": []string{"wrong"}}, []byte(payload))).To(BeFalse())
+		})
+
+		It("should reject everything without a secret", func() {
+			Expect(Authenticated(nil, http.Header{"X-Gitlab-Token": []string{""}}, []byte(payload))).To(BeFalse())
+			Expect(Authenticated(nil, http.Header{}, []byte(payload))).To(BeFalse())
+		})
+	})
+
+	Context("Starting runs", func() {
+		It("should create a schedule run with the push variables", func() {
+			w := post("/hooks/default/now/build", payload, map[string]string{
+				"X-Hub-Signature-256": sign("s3cret", payload),
+				"X-GitHub-Delivery":   "delivery-1",
+			})
+			Expect(w.Code).To(Equal(http.StatusCreated))
+
+			resp := map[string]string{}
+			Expect(json.Unmarshal(w.Body.Bytes(), &resp)).To(Succeed())
+			Expect(resp["name"]).ToNot(BeEmpty())
+
+			kmsr := &bythepowerofv1.KmakeScheduleRun{}
+			Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: resp["name"]}, kmsr)).To(Succeed())
+			Expect(kmsr.Spec.Start.Variables).To(Equal(map[string]string{"BRANCH": "feature", "COMMIT": "0123abcd"}))
+			Expect(kmsr.GetKmakeRunName()).To(Equal("build"))
+			Expect(kmsr.GetKmakeName()).To(Equal("kmake"))
+			Expect(kmsr.GetKmakeScheduleEnvName()).To(Equal("now-envmap"))
+			Expect(bythepowerofv1.GetDomainLabel(kmsr.GetLabels(), bythepowerofv1.ScheduleInstLabel)).To(Equal("now"))
+
+			By("returning the same run for a retried delivery")
+			w = post("/hooks/default/now/build", payload, map[string]string{
+				"X-Hub-Signature-256": sign("s3cret", payload),
+				"X-GitHub-Delivery":   "delivery-1",
+			})
+			Expect(w.Code).To(Equal(http.StatusOK))
+			again := map[string]string{}
+			Expect(json.Unmarshal(w.Body.Bytes(), &again)).To(Succeed())
+			Expect(again["name"]).To(Equal(resp["name"]))
+		})
+
+		It("should refuse unsigned posts", func() {
+			w := post("/hooks/default/now/build", payload, nil)
+			Expect(w.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should refuse posts signed with another scheduler's secret", func() {
+			headers := map[string]string{"X-Hub-Signature-256": sign("s3cret", payload)}
+			Expect(post("/hooks/default/other/build", payload, headers).Code).To(Equal(http.StatusUnauthorized))
+
+			headers = map[string]string{"X-Hub-Signature-256": sign("0ther", payload)}
+			Expect(post("/hooks/default/other/build", payload, headers).Code).To(Equal(http.StatusCreated))
+			Expect(post("/hooks/default/now/build", payload, headers).Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should refuse posts for schedulers without a webhook secret", func() {
+			headers := map[string]string{"X-Gitlab-Token": ""}
+			Expect(post("/hooks/default/open/build", payload, headers).Code).To(Equal(http.StatusUnauthorized))
+
+			By("or whose secret is missing")
+			Expect(c.Delete(context.Background(), &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "now-hook", Namespace: "default"},
+			})).To(Succeed())
+			headers = map[string]string{"X-Hub-Signature-256": sign("s3cret", payload)}
+			Expect(post("/hooks/default/now/build", payload, headers).Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should refuse posts for a suspended scheduler", func() {
+			scheduler := &bythepowerofv1.KmakeNowScheduler{}
+			Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: "now"}, scheduler)).To(Succeed())
+			scheduler.Spec.Suspend = true
+			Expect(c.Update(context.Background(), scheduler)).To(Succeed())
+
+			headers := map[string]string{"X-Hub-Signature-256": sign("s3cret", payload)}
+			Expect(post("/hooks/default/now/build", payload, headers).Code).To(Equal(http.StatusConflict))
+
+			kmsrs := &bythepowerofv1.KmakeScheduleRunList{}
+			Expect(c.List(context.Background(), kmsrs)).To(Succeed())
+			Expect(kmsrs.Items).To(BeEmpty())
+		})
+
+		It("should only take POST", func() {
+			req := httptest.NewRequest(http.MethodGet, "/hooks/default/now/build", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			Expect(w.Code).To(Equal(http.StatusMethodNotAllowed))
+		})
+
+		It("should only start runs in the namespaces watched", func() {
+			var err error
+			r.Scope, err = scope.Options{Namespaces: "team-a,team-b"}.Build()
+			Expect(err).ToNot(HaveOccurred())
+
+			headers := map[string]string{"X-Hub-Signature-256": sign("s3cret", payload)}
+			Expect(post("/hooks/default/now/build", payload, headers).Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should only start the runs the scheduler monitors", func() {
+			headers := map[string]string{"X-Hub-Signature-256": sign("s3cret", payload)}
+			Expect(post("/hooks/default/now/adhoc", payload, headers).Code).To(Equal(http.StatusForbidden))
+
+			kmsrs := &bythepowerofv1.KmakeScheduleRunList{}
+			Expect(c.List(context.Background(), kmsrs)).To(Succeed())
+			Expect(kmsrs.Items).To(BeEmpty())
+		})
+
+		It("should tell unsigned posts nothing about what's there", func() {
+			headers := map[string]string{"X-Hub-Signature-256": sign("wrong", payload)}
+			for _, path := range []string{"/hooks/default/now/build", "/hooks/default/missing/build", "/hooks/elsewhere/now/build"} {
+				w := post(path, payload, headers)
+				Expect(w.Code).To(Equal(http.StatusUnauthorized))
+				Expect(w.Body.String()).To(Equal("unauthorized\n"))
+			}
+		})
+
+		It("should label the run like its scheduler", func() {
+			w := post("/hooks/default/now/build", payload, map[string]string{"X-Hub-Signature-256": sign("s3cret", payload)})
+			Expect(w.Code).To(Equal(http.StatusCreated))
+			resp := map[string]string{}
+			Expect(json.Unmarshal(w.Body.Bytes(), &resp)).To(Succeed())
+
+			kmsr := &bythepowerofv1.KmakeScheduleRun{}
+			Expect(c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: resp["name"]}, kmsr)).To(Succeed())
+			Expect(kmsr.GetLabels()).To(HaveKeyWithValue("shard", "1"))
+			Expect(kmsr.GetLabels()).To(HaveKeyWithValue("bythepowerof.github.io/schedule-instance", "now"))
+		})
+
+		It("should refuse unknown schedulers and report unknown runs", func() {
+			headers := map[string]string{"X-Hub-Signature-256": sign("s3cret", payload)}
+			Expect(post("/hooks/default/missing/build", payload, headers).Code).To(Equal(http.StatusUnauthorized))
+			Expect(post("/hooks/default/now/missing", payload, headers).Code).To(Equal(http.StatusNotFound))
+			Expect(post("/hooks/default/now", payload, headers).Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Context("Readiness", func() {
+		It("should only be ready while listening", func() {
+			r.Addr = "127.0.0.1:0"
+			Expect(r.Ready(nil)).ToNot(Succeed())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- r.Start(ctx) }()
+
+			Eventually(func() error { return r.Ready(nil) }).Should(Succeed())
+
+			cancel()
+			Eventually(done).Should(Receive(BeNil()))
+			Expect(r.Ready(nil)).ToNot(Succeed())
+		})
+
+		It("should register a ready check that fails until it's listening", func() {
+			r.Addr = "127.0.0.1:0"
+			mgr := &checkedManager{}
+			Expect(r.SetupWithManager(mgr)).Should(Succeed())
+			Expect(mgr.runnables).To(ConsistOf(r))
+			Expect(mgr.checks).To(HaveKey("receiver"))
+			Expect(mgr.checks["receiver"](nil)).ToNot(Succeed())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() { _ = mgr.runnables[0].Start(ctx) }()
+			Eventually(func() error { return mgr.checks["receiver"](nil) }).Should(Succeed())
+		})
+
+		It("should run on every replica, not just the leader", func() {
+			var runnable manager.LeaderElectionRunnable = r
+			Expect(runnable.NeedLeaderElection()).To(BeFalse())
+		})
+
+		It("should fail to start on a bad address", func() {
+			r.Addr = "127.0.0.1:-1"
+			Expect(r.Start(context.Background())).ToNot(Succeed())
+			Expect(r.Ready(nil)).ToNot(Succeed())
+		})
+	})
+})
+
+// checkedManager records what's added to it, it's only the part of a manager
+// SetupWithManager uses
+type checkedManager struct {
+	manager.Manager
+	runnables []manager.Runnable
+	checks    map[string]healthz.Checker
+}
+
+func (m *checkedManager) Add(r manager.Runnable) error {
+	m.runnables = append(m.runnables, r)
+	return nil
+}
+
+func (m *checkedManager) AddReadyzCheck(name string, check healthz.Checker) error {
+	if m.checks == nil {
+		m.checks = map[string]healthz.Checker{}
+	}
+	m.checks[name] = check
+	return nil
+}
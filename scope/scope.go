@@ -0,0 +1,194 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package scope limits what a controller watches, by namespace and by label,
+// so several of them can share out a cluster
+package scope
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/namsral/flag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+)
+
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// Options are the flags of what a controller watches
+type Options struct {
+	// Namespaces is all, or a comma separated list of them
+	Namespaces string
+	// NamespaceSelector only watches the namespaces with matching labels
+	NamespaceSelector string
+	// ObjectSelector only watches the kmake objects with matching labels
+	ObjectSelector string
+}
+
+// BindFlags adds --namespace, --namespace-selector and --object-selector to
+// the flag set
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Namespaces, "namespace", "all",
+		"Namespaces to watch, comma separated - use 'all' for all namespaces")
+	fs.StringVar(&o.NamespaceSelector, "namespace-selector", "",
+		"Only watch the namespaces with labels matching this selector - leave empty for any")
+	fs.StringVar(&o.ObjectSelector, "object-selector", "",
+		"Only watch the kmakes, runs, schedulers and schedule runs with labels matching this selector - label the objects of a shard alike")
+}
+
+// Build parses the options
+func (o Options) Build() (*Scope, error) {
+	s := &Scope{}
+
+	if strings.ToLower(strings.TrimSpace(o.Namespaces)) != "all" {
+		for _, ns := range strings.Split(o.Namespaces, ",") {
+			if ns = strings.TrimSpace(ns); ns != "" {
+				s.namespaces = append(s.namespaces, ns)
+			}
+		}
+	}
+
+	var err error
+	if o.NamespaceSelector != "" {
+		if s.namespaceSelector, err = labels.Parse(o.NamespaceSelector); err != nil {
+			return nil, fmt.Errorf("bad namespace selector: %v", err)
+		}
+	}
+	if o.ObjectSelector != "" {
+		if s.objectSelector, err = labels.Parse(o.ObjectSelector); err != nil {
+			return nil, fmt.Errorf("bad object selector: %v", err)
+		}
+	}
+	return s, nil
+}
+
+// Scope is what a controller watches, the namespaces by name or label and the
+// objects in them by label. The reconcilers and webhook receiver share one, a
+// nil Scope watches everything
+type Scope struct {
+	// namespaces is nil for all of them
+	namespaces        []string
+	namespaceSelector labels.Selector
+	objectSelector    labels.Selector
+}
+
+// selected are the kinds the object selector shards
+func selected() []client.Object {
+	return []client.Object{
+		&bythepowerofv1.Kmake{},
+		&bythepowerofv1.KmakeRun{},
+		&bythepowerofv1.KmakeNowScheduler{},
+		&bythepowerofv1.KmakeTriggerScheduler{},
+		&bythepowerofv1.KmakeScheduleRun{},
+	}
+}
+
+// Cache is the cache options that only watch our namespaces, and only our
+// objects of the sharded kinds
+func (s *Scope) Cache() cache.Options {
+	opts := cache.Options{}
+	if s == nil {
+		return opts
+	}
+
+	if len(s.namespaces) > 0 {
+		opts.DefaultNamespaces = map[string]cache.Config{}
+		for _, ns := range s.namespaces {
+			opts.DefaultNamespaces[ns] = cache.Config{}
+		}
+	}
+
+	if s.objectSelector != nil || s.namespaceSelector != nil {
+		opts.ByObject = map[client.Object]cache.ByObject{}
+	}
+	if s.objectSelector != nil {
+		for _, obj := range selected() {
+			opts.ByObject[obj] = cache.ByObject{Label: s.objectSelector}
+		}
+	}
+	if s.namespaceSelector != nil {
+		opts.ByObject[&corev1.Namespace{}] = cache.ByObject{Label: s.namespaceSelector}
+	}
+	return opts
+}
+
+// Contains is whether we watch the namespace, reading its labels with the
+// client when there's a namespace selector
+func (s *Scope) Contains(ctx context.Context, c client.Reader, namespace string) (bool, error) {
+	if s == nil || namespace == "" {
+		return true, nil
+	}
+
+	if len(s.namespaces) > 0 {
+		found := false
+		for _, ns := range s.namespaces {
+			if ns == namespace {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+
+	if s.namespaceSelector == nil {
+		return true, nil
+	}
+
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return s.namespaceSelector.Matches(labels.Set(ns.GetLabels())), nil
+}
+
+// Predicate drops the events of objects in namespaces we don't watch
+func (s *Scope) Predicate(c client.Reader) predicate.Predicate {
+	return predicate.NewPredicateFuncs(func(o client.Object) bool {
+		ok, err := s.Contains(context.Background(), c, o.GetNamespace())
+		return err == nil && ok
+	})
+}
+
+func (s *Scope) String() string {
+	if s == nil {
+		return "all"
+	}
+
+	ret := "all namespaces"
+	if len(s.namespaces) > 0 {
+		ret = "namespaces " + strings.Join(s.namespaces, ",")
+	}
+	if s.namespaceSelector != nil {
+		ret += " labelled " + s.namespaceSelector.String()
+	}
+	if s.objectSelector != nil {
+		ret += ", objects labelled " + s.objectSelector.String()
+	}
+	return ret
+}
@@ -0,0 +1,154 @@
+package scope
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	bythepowerofv1 "github.com/bythepowerof/kmake-controller/api/v1"
+)
+
+func newTestClient() client.Client {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"kmake": "yes"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b", Labels: map[string]string{"kmake": "no"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-c"}},
+	).Build()
+}
+
+func build(t *testing.T, o Options) *Scope {
+	t.Helper()
+
+	s, err := o.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func expectContains(t *testing.T, s *Scope, want map[string]bool) {
+	t.Helper()
+
+	c := newTestClient()
+	for ns, w := range want {
+		got, err := s.Contains(context.Background(), c, ns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != w {
+			t.Errorf("%v: got %v for %v, want %v", s, got, ns, w)
+		}
+	}
+}
+
+func TestAllScope(t *testing.T) {
+	s := build(t, Options{Namespaces: "all"})
+
+	opts := s.Cache()
+	if opts.DefaultNamespaces != nil || opts.ByObject != nil {
+		t.Errorf("got cache options %+v", opts)
+	}
+	expectContains(t, s, map[string]bool{"team-a": true, "team-b": true, "missing": true})
+
+	if s.String() != "all namespaces" {
+		t.Errorf("got %v", s)
+	}
+}
+
+func TestNilScope(t *testing.T) {
+	var s *Scope
+
+	expectContains(t, s, map[string]bool{"team-a": true, "missing": true})
+	if !s.Predicate(nil).Create(event.CreateEvent{Object: &bythepowerofv1.Kmake{}}) {
+		t.Error("nil scope dropped an event")
+	}
+}
+
+func TestNamespacesScope(t *testing.T) {
+	s := build(t, Options{Namespaces: "team-a, team-c,"})
+
+	opts := s.Cache()
+	if len(opts.DefaultNamespaces) != 2 {
+		t.Errorf("got namespaces %v", opts.DefaultNamespaces)
+	}
+	if _, ok := opts.DefaultNamespaces["team-c"]; !ok {
+		t.Errorf("got namespaces %v", opts.DefaultNamespaces)
+	}
+	expectContains(t, s, map[string]bool{"team-a": true, "team-b": false, "team-c": true})
+
+	if s.String() != "namespaces team-a,team-c" {
+		t.Errorf("got %v", s)
+	}
+}
+
+func TestNamespaceSelectorScope(t *testing.T) {
+	s := build(t, Options{Namespaces: "all", NamespaceSelector: "kmake=yes"})
+
+	opts := s.Cache()
+	found := false
+	for obj, by := range opts.ByObject {
+		if _, ok := obj.(*corev1.Namespace); ok {
+			found = by.Label.String() == "kmake=yes"
+		}
+	}
+	if !found {
+		t.Errorf("no namespace selector in %+v", opts.ByObject)
+	}
+	expectContains(t, s, map[string]bool{"team-a": true, "team-b": false, "team-c": false, "missing": false})
+
+	// both narrow it
+	s = build(t, Options{Namespaces: "team-b,team-a", NamespaceSelector: "kmake"})
+	expectContains(t, s, map[string]bool{"team-a": true, "team-b": true, "team-c": false})
+
+	c := newTestClient()
+	in := &bythepowerofv1.Kmake{ObjectMeta: metav1.ObjectMeta{Name: "kmake", Namespace: "team-a"}}
+	out := &bythepowerofv1.Kmake{ObjectMeta: metav1.ObjectMeta{Name: "kmake", Namespace: "team-c"}}
+	if !s.Predicate(c).Create(event.CreateEvent{Object: in}) {
+		t.Error("dropped an event in team-a")
+	}
+	if s.Predicate(c).Update(event.UpdateEvent{ObjectOld: out, ObjectNew: out}) {
+		t.Error("kept an event in team-c")
+	}
+}
+
+func TestObjectSelectorScope(t *testing.T) {
+	s := build(t, Options{Namespaces: "all", ObjectSelector: "shard in (1,2)"})
+
+	opts := s.Cache()
+	kinds := 0
+	for obj, by := range opts.ByObject {
+		if _, ok := obj.(*corev1.Namespace); ok {
+			t.Error("namespaces sharded")
+		}
+		if by.Label.String() != "shard in (1,2)" {
+			t.Errorf("got selector %v", by.Label)
+		}
+		kinds++
+	}
+	if kinds != 5 {
+		t.Errorf("got %v sharded kinds", kinds)
+	}
+
+	if s.String() != "all namespaces, objects labelled shard in (1,2)" {
+		t.Errorf("got %v", s)
+	}
+}
+
+func TestBadSelectorScope(t *testing.T) {
+	if _, err := (Options{NamespaceSelector: "kmake in"}).Build(); err == nil {
+		t.Error("bad namespace selector built")
+	}
+	if _, err := (Options{ObjectSelector: "==="}).Build(); err == nil {
+		t.Error("bad object selector built")
+	}
+}
@@ -0,0 +1,113 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/namsral/flag"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Options are where and how much Setup traces
+type Options struct {
+	// Exporter is none, stdout or otlp
+	Exporter string
+	// Endpoint is the OTLP collector's host:port, empty for the
+	// OTEL_EXPORTER_OTLP_ENDPOINT default
+	Endpoint string
+	// Insecure sends to the collector without TLS
+	Insecure bool
+	// SampleRatio is the fraction of new traces kept, the ones we're
+	// continuing follow their parent
+	SampleRatio float64
+
+	// out is where stdout really goes, set by test code only
+	out io.Writer
+}
+
+// BindFlags adds --trace-exporter, --trace-endpoint, --trace-insecure and
+// --trace-sample-ratio to the flag set
+func (o *Options) BindFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Exporter, "trace-exporter", "none",
+		"Where to send the traces, one of none, stdout or otlp")
+	fs.StringVar(&o.Endpoint, "trace-endpoint", "",
+		"The OTLP collector's host:port - leave empty for OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4317")
+	fs.BoolVar(&o.Insecure, "trace-insecure", false,
+		"Send the traces to the OTLP collector without TLS")
+	fs.Float64Var(&o.SampleRatio, "trace-sample-ratio", 1.0,
+		"The fraction of new traces to keep")
+}
+
+// Setup installs the W3C trace context propagator and, unless the exporter is
+// none, a tracer provider for the service. The func returned flushes and stops
+// the exporter
+func (o Options) Setup(ctx context.Context, service string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch strings.ToLower(o.Exporter) {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		out := o.out
+		if out == nil {
+			out = os.Stdout
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(out))
+	case "otlp":
+		opts := []otlptracegrpc.Option{}
+		if o.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(o.Endpoint))
+		}
+		if o.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %v, use none, stdout or otlp", o.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(service)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(o.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestNoneSetup(t *testing.T) {
+	shutdown, err := Options{Exporter: "none"}.Setup(context.Background(), "kmake-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(context.Background())
+
+	fields := otel.GetTextMapPropagator().Fields()
+	if !slices.Contains(fields, "traceparent") {
+		t.Errorf("got propagator fields %v", fields)
+	}
+}
+
+func TestUnknownSetup(t *testing.T) {
+	_, err := Options{Exporter: "zipkin"}.Setup(context.Background(), "kmake-test")
+	if err == nil || !strings.Contains(err.Error(), "zipkin") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestStdoutSetup(t *testing.T) {
+	out := &bytes.Buffer{}
+	shutdown, err := Options{Exporter: "stdout", SampleRatio: 1, out: out}.Setup(context.Background(), "kmake-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "reconcile")
+	span.End()
+
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if !strings.Contains(carrier["traceparent"], span.SpanContext().TraceID().String()) {
+		t.Errorf("got traceparent %v", carrier["traceparent"])
+	}
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]interface{}{}
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("not json: %v: %s", err, out.String())
+	}
+	if got["Name"] != "reconcile" {
+		t.Errorf("got span %v", got["Name"])
+	}
+	if !strings.Contains(out.String(), "kmake-test") {
+		t.Errorf("no service name in %s", out.String())
+	}
+}